@@ -0,0 +1,70 @@
+// Code generated by simplelang. DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+//line ../in/concurrency.sl:5:1
+func square_worker(jobs chan int, results chan int, quit chan bool, wg *sync.WaitGroup) {
+	/*line ../in/concurrency.sl:6:4*/ defer wg.Done()
+	/*line ../in/concurrency.sl:7:4*/ __loop0:
+	for { /*line ../in/concurrency.sl:8:8*/
+		select {
+		case n := <-jobs:
+			{
+				/*line ../in/concurrency.sl:10:16*/ results <- n * n
+
+			}
+		case <-quit:
+			{
+				/*line ../in/concurrency.sl:13:16*/ break __loop0
+
+			}
+		}
+	}
+}
+
+//line ../in/concurrency.sl:19:1
+func concurrency() {
+	/*line ../in/concurrency.sl:20:4*/ defer fmt.Println("concurrency done")
+	/*line ../in/concurrency.sl:21:4*/ var jobs = make(chan int)
+	/*line ../in/concurrency.sl:22:4*/ var results = make(chan int)
+	/*line ../in/concurrency.sl:23:4*/ var quit = make(chan bool)
+	/*line ../in/concurrency.sl:24:4*/ var wg sync.WaitGroup
+	/*line ../in/concurrency.sl:25:4*/ wg.Add(2)
+	/*line ../in/concurrency.sl:26:4*/ go square_worker(jobs, results, quit, &wg)
+	/*line ../in/concurrency.sl:27:4*/ go square_worker(jobs, results, quit, &wg)
+	/*line ../in/concurrency.sl:28:4*/ go func() {
+		/*line ../in/concurrency.sl:29:8*/ var i = 1
+		/*line ../in/concurrency.sl:30:8*/ for { /*line ../in/concurrency.sl:31:12*/
+			if i > 3 {
+				/*line ../in/concurrency.sl:32:16*/ break
+
+			}
+			/*line ../in/concurrency.sl:34:12*/ jobs <- i
+			/*line ../in/concurrency.sl:35:12*/ i = i + 1
+		}
+	}()
+	/*line ../in/concurrency.sl:38:4*/ var sum = 0
+	/*line ../in/concurrency.sl:39:4*/ var received = 0
+	/*line ../in/concurrency.sl:40:4*/ for { /*line ../in/concurrency.sl:41:8*/
+		sum = sum + <-results
+		/*line ../in/concurrency.sl:42:8*/ received = received + 1
+		/*line ../in/concurrency.sl:43:8*/ if received == 3 {
+			/*line ../in/concurrency.sl:44:12*/ break
+
+		}
+	}
+	/*line ../in/concurrency.sl:47:4*/ close(quit)
+	/*line ../in/concurrency.sl:48:4*/ wg.Wait()
+	/*line ../in/concurrency.sl:49:4*/ fmt.Println("sum of squares:", sum)
+	/*line ../in/concurrency.sl:50:4*/ select {
+	case n := <-results:
+		fmt.Println("unexpected result", n)
+	default:
+		fmt.Println("no more results")
+	}
+}
@@ -0,0 +1,79 @@
+// Code generated by simplelang. DO NOT EDIT.
+
+package geometry
+
+import (
+	"fmt"
+	"math"
+)
+
+//line ../../in/geometry/geometry.sl:5:1
+type Turn int
+
+const (
+	Turn_Left Turn = iota
+	Turn_Right
+)
+
+func (recv Turn) String() string {
+	switch recv {
+	case Turn_Left:
+		return "Left"
+	case Turn_Right:
+		return "Right"
+	}
+	return "Turn(?)"
+}
+
+//line ../../in/geometry/geometry.sl:10:1
+type Step interface {
+	isStep()
+}
+type Step_Forward struct {
+	F0 float64
+}
+
+func (Step_Forward) isStep() {}
+
+type Step_Rotate struct {
+	F0 Turn
+}
+
+func (Step_Rotate) isStep() {}
+
+//line ../../in/geometry/geometry.sl:15:1
+const FullCircle = 360
+
+//line ../../in/geometry/geometry.sl:17:1
+type Meters float64
+
+//line ../../in/geometry/geometry.sl:19:1
+func Walked(steps int) Meters {
+	/*line ../../in/geometry/geometry.sl:20:4*/ return Meters(0.75) * Meters(steps)
+}
+
+//line ../../in/geometry/geometry.sl:23:1
+func Hypot(a float64, b float64) float64 {
+	/*line ../../in/geometry/geometry.sl:24:4*/ return math.Sqrt(square(a) + square(b))
+}
+
+//line ../../in/geometry/geometry.sl:27:1
+func DescribeStep(step Step) string {
+	/*line ../../in/geometry/geometry.sl:28:4*/ var description string
+	switch __match0 := step.(type) {
+	case Step_Forward:
+		distance := __match0.F0
+		description = fmt.Sprintf("forward %v", distance)
+	case Step_Rotate:
+		turn := __match0.F0
+		description = fmt.Sprintf("rotate %v", turn)
+	default:
+		panic("unreachable")
+	}
+	/*line ../../in/geometry/geometry.sl:32:4*/ return description
+}
+
+//line ../../in/geometry/geometry.sl:35:1
+func square(x float64) float64 {
+	/*line ../../in/geometry/geometry.sl:36:4*/ return x * x
+}
@@ -1,96 +1,515 @@
+// Code generated by simplelang. DO NOT EDIT.
+
 package main
 
 import (
+	"errors"
 	"fmt"
-	"math"
 	long_name_for_math "math"
+	"os"
+	"simplelang/out/geometry"
+	"strconv"
+	. "strings"
+)
+
+//line ../in/main.sl:11:1
+const (
+	small = iota
+	medium
+	large
 )
 
+//line ../in/main.sl:17:1
+var size_name string = func() string {
+	var size_name string
+	{
+		/*line ../in/main.sl:18:4*/ var name = "large"
+		/*line ../in/main.sl:19:4*/ if large == small {
+			/*line ../in/main.sl:20:8*/ name = "small"
+
+		}
+		/*line ../in/main.sl:22:4*/ size_name = name
+	}
+	return size_name
+}()
+
+//line ../in/main.sl:24:1
+var size_label string = func() string {
+	var size_label string
+	if large > medium {
+		/*line ../in/main.sl:25:4*/ size_label = "sizes grow"
+	} else {
+		/*line ../in/main.sl:27:4*/ size_label = "sizes shrink"
+	}
+	return size_label
+}()
+
+//line ../in/main.sl:29:1
+var initialized_sizes = 0
+
+//line ../in/main.sl:31:1
+func init() {
+	/*line ../in/main.sl:32:4*/ initialized_sizes = large + 1
+}
+
+//line ../in/main.sl:35:1
+type userID int
+
+//line ../in/main.sl:36:1
+type label = string
+
+//line ../in/main.sl:38:1
+func describe_user(id userID, role label) label {
+	/*line ../in/main.sl:39:4*/ return fmt.Sprintf("user %v: %v", id, role)
+}
+
+//line ../in/main.sl:42:1
 func something() string {
-	return "something"
+	/*line ../in/main.sl:43:4*/ return "something"
 }
+
+//line ../in/main.sl:46:1
 func abs(num float64) float64 {
-	return long_name_for_math.Abs(num)
+	/*line ../in/main.sl:47:4*/ return long_name_for_math.Abs(num)
 }
+
+//line ../in/main.sl:50:1
 func print_any(a any) {
-	fmt.Println(a)
+	/*line ../in/main.sl:51:4*/ fmt.Println(a)
 }
+
+//line ../in/main.sl:54:1
 func print_int_pointee(a *int) {
-	fmt.Println(*a)
+	/*line ../in/main.sl:55:4*/ fmt.Println(*a)
+}
+
+//line ../in/main.sl:58:1
+func describe_first_step(step geometry.Step) string {
+	/*line ../in/main.sl:59:4*/ var description string
+	switch __match0 := step.(type) {
+	case geometry.Step_Forward:
+		distance := __match0.F0
+		description = fmt.Sprintf("first %v", distance)
+	default:
+		description = "first turn"
+	}
+	/*line ../in/main.sl:63:4*/ return description
+}
+
+//line ../in/main.sl:66:1
+func shout(text string) string {
+	/*line ../in/main.sl:67:4*/ return ToUpper(text)
 }
+
+//line ../in/main.sl:70:1
+func fibonacci(n int) int {
+	/*line ../in/main.sl:71:4*/ var previous = 0
+	/*line ../in/main.sl:72:4*/ var current = 1
+	/*line ../in/main.sl:73:4*/ var i = 0
+	/*line ../in/main.sl:74:4*/ for { /*line ../in/main.sl:75:8*/
+		if i == n {
+			/*line ../in/main.sl:76:12*/ break
+
+		}
+		/*line ../in/main.sl:78:8*/ var sum = previous + current
+		/*line ../in/main.sl:79:8*/ previous = current
+		/*line ../in/main.sl:80:8*/ current = sum
+		/*line ../in/main.sl:81:8*/ i = i + 1
+	}
+	/*line ../in/main.sl:83:4*/ return previous
+}
+
+//line ../in/main.sl:86:1
 func main() {
-	var x = 5
-	var y float64 = 7
-	y = 4.200000
-	const prefix = "John says"
-	var text = "hello"
-	fmt.Println(fmt.Sprintf("%v: %v world. x: %v, y: %v", prefix, text, x, y))
-	const pi = 3.140000
-	fmt.Printf("%.2f\n", pi)
-	var some_val = something()
-	fmt.Println(some_val)
-	fmt.Println("hello")
-	fmt.Println(abs(-5))
-	var binary_expression = math.Pow(10, 2) + 1*0
-	fmt.Println(binary_expression)
-	if 3 > 1 && true {
-		fmt.Println("hi")
-	} else {
-		fmt.Println("else")
-	}
-	var _ = "comment: since I haven't implemented a semantic"
-	var _ = "         analyzer, the type can't be inferred"
-	var _ = "         for if expressions"
-	var does_it_work string
-	if true {
-		does_it_work = "yes"
-	} else {
-		does_it_work = "no"
+	/*line ../in/main.sl:87:4*/ fmt.Println(shout("grouped imports"))
+	/*line ../in/main.sl:88:4*/ fmt.Println(size_label, initialized_sizes, "sizes, the last is", size_name)
+	/*line ../in/main.sl:89:4*/ fmt.Println("hypot:", geometry.Hypot(3, 4), "of", geometry.FullCircle)
+	/*line ../in/main.sl:90:4*/ var id userID = userID(42)
+	/*line ../in/main.sl:91:4*/ var distance geometry.Meters = geometry.Walked(4) + geometry.Meters(0.5)
+	/*line ../in/main.sl:92:4*/ fmt.Println(describe_user(id, "admin"), distance)
+	/*line ../in/main.sl:93:4*/ var laps = 3
+	/*line ../in/main.sl:94:4*/ fmt.Println(float64(laps)/2, []byte("go"), float64(distance) > 3)
+	/*line ../in/main.sl:95:4*/ var step geometry.Step = geometry.Step(geometry.Step_Rotate{F0: geometry.Turn_Left})
+	/*line ../in/main.sl:96:4*/ fmt.Println(geometry.DescribeStep(step), describe_first_step(geometry.Step(geometry.Step_Forward{F0: 2})))
+	/*line ../in/main.sl:97:4*/ var x = 5
+	/*line ../in/main.sl:98:4*/ var y float64 = 7
+	/*line ../in/main.sl:99:4*/ y = 4.2
+	/*line ../in/main.sl:100:4*/ const prefix = "John says"
+	/*line ../in/main.sl:101:4*/ var text = "hello"
+	/*line ../in/main.sl:102:4*/ fmt.Println(fmt.Sprintf("John says: %v world. x: %v, y: %v", text, x, y))
+	/*line ../in/main.sl:103:4*/ const pi = 3.14
+	/*line ../in/main.sl:104:4*/ fmt.Printf("%.2f\n", pi)
+	/*line ../in/main.sl:105:4*/ var pi_label = fmt.Sprintf("pi is about %.1f", pi)
+	/*line ../in/main.sl:106:4*/ fmt.Println(pi_label)
+	/*line ../in/main.sl:107:4*/ var some_val = "something"
+	/*line ../in/main.sl:108:4*/ fmt.Println(some_val)
+	/*line ../in/main.sl:109:4*/ fmt.Println("hello")
+	/*line ../in/main.sl:110:4*/ fmt.Println(abs(-5))
+	/*line ../in/main.sl:111:4*/ var binary_expression = 100
+	/*line ../in/main.sl:112:4*/ fmt.Println(binary_expression)
+	/*line ../in/main.sl:113:4*/ fmt.Println("fibonacci(50) is 12586269025, computed at compile time")
+	/*line ../in/main.sl:114:21*/ {
+		/*line ../in/main.sl:115:8*/ fmt.Println("hi")
 	}
-	fmt.Println(does_it_work)
-	var _ = "comment: the same thing applies for block expressions"
-	var another_test string
+	/*line ../in/main.sl:120:4*/ var _ = "comment: the type of if expressions is inferred"
+	/*line ../in/main.sl:121:4*/ var does_it_work string
 	{
-		var nested string
+		/*line ../in/main.sl:122:8*/ does_it_work = "yes"
+	}
+	/*line ../in/main.sl:126:4*/ fmt.Println(does_it_work)
+	/*line ../in/main.sl:128:4*/ var _ = "comment: the same thing applies for block expressions"
+	/*line ../in/main.sl:129:4*/ var another_test string
+	{
+		/*line ../in/main.sl:130:8*/ var nested string
 		{
-			nested = "nested"
+			/*line ../in/main.sl:131:12*/ nested = "nested"
 		}
-		fmt.Println("hi")
-		another_test = nested
+		/*line ../in/main.sl:133:8*/ fmt.Println("hi")
+		/*line ../in/main.sl:134:8*/ another_test = nested
 	}
-	fmt.Println(another_test)
-	var what string
-	if true {
-		what = "true"
-	} else {
-		what = "false"
-	}
-	fmt.Println(what)
-	var pointee = 3
-	var pointer = &pointee
-	print_any(pointee)
-	print_any(&pointee)
-	print_any(pointer)
-	print_int_pointee(pointer)
-	print_int_pointee(&pointee)
-	var count = 10
-	var i = 0
-	for {
+	/*line ../in/main.sl:136:4*/ fmt.Println(another_test)
+	/*line ../in/main.sl:138:4*/ var _ = "comment: or the first value assigned"
+	/*line ../in/main.sl:139:4*/ var assigned_later float64
+	/*line ../in/main.sl:140:4*/ assigned_later = 2.5
+	/*line ../in/main.sl:141:4*/ fmt.Println(assigned_later * 2)
+	/*line ../in/main.sl:143:4*/ var what string
+	{
+		/*line ../in/main.sl:143:24*/ what = "true"
+	}
+	/*line ../in/main.sl:144:4*/ fmt.Println(what)
+	/*line ../in/main.sl:146:4*/ var pointee = 3
+	/*line ../in/main.sl:147:4*/ var pointer = &pointee
+	/*line ../in/main.sl:148:4*/ print_any(pointee)
+	/*line ../in/main.sl:149:4*/ print_any(&pointee)
+	/*line ../in/main.sl:150:4*/ print_any(pointer)
+	/*line ../in/main.sl:152:4*/ print_int_pointee(pointer)
+	/*line ../in/main.sl:153:4*/ print_int_pointee(&pointee)
+	/*line ../in/main.sl:155:4*/ var count = 10
+	/*line ../in/main.sl:156:4*/ var i = 0
+	/*line ../in/main.sl:157:4*/ for { /*line ../in/main.sl:158:8*/
 		i = i + 1
-		var _ = "comment: no switch available :("
-		var ordinal string
+		/*line ../in/main.sl:159:8*/ var _ = "comment: no switch available :("
+		/*line ../in/main.sl:160:8*/ var ordinal string
 		if i == 1 {
-			ordinal = "st"
+			/*line ../in/main.sl:161:12*/ ordinal = "st"
 		} else if i == 2 {
-			ordinal = "nd"
+			/*line ../in/main.sl:163:12*/ ordinal = "nd"
 		} else if i == 3 {
-			ordinal = "rd"
+			/*line ../in/main.sl:165:12*/ ordinal = "rd"
+		} else {
+			/*line ../in/main.sl:167:12*/ ordinal = "th"
+		}
+		/*line ../in/main.sl:169:8*/ fmt.Println(fmt.Sprintf("index (%v): hi for the %v%v time", i-1, i, ordinal))
+		/*line ../in/main.sl:170:8*/ if i == count {
+			/*line ../in/main.sl:171:12*/ break
+
+		}
+	}
+	/*line ../in/main.sl:175:4*/ fmt.Println(area(shape(shape_Circle{_0: 2})), area(shape(shape_Rect{_0: 2, _1: 3})), area(shape(shape_Empty{})))
+	/*line ../in/main.sl:176:4*/ fmt.Println(color_Green, describe(color_Red), describe(color_Blue))
+	/*line ../in/main.sl:178:4*/ fmt.Println(report("42"), report("-1"), report("x"))
+	/*line ../in/main.sl:179:4*/ {
+		__value1, __err2 := sum_of_positives("1", "2")
+		if __err2 != nil {
+			e := __err2
+			fmt.Println(e)
+		} else {
+			sum := __value1
+			fmt.Println("sum:", sum)
+		}
+	}
+	/*line ../in/main.sl:183:4*/ {
+		__value3, __ok4 := first_even(3, 4)
+		if !__ok4 {
+			fmt.Println("no even number")
+		} else {
+			n := __value3
+			fmt.Println("first even:", n)
+		}
+	}
+	/*line ../in/main.sl:187:4*/ fmt.Println(kind_of(1), kind_of(color_Blue), kind_of(2.5))
+	/*line ../in/main.sl:188:4*/ {
+		__value5, __ok6 := as_text("text")
+		if !__ok6 {
+			fmt.Println("no text")
+		} else {
+			text := __value5
+			fmt.Println("got text:", text)
+		}
+	}
+	/*line ../in/main.sl:192:4*/ fmt.Println(fmt.Sprintf("something with %v, nested {{braces}} and %v {escaped}", abs(-2)*2, fmt.Sprintf("%v", describe(color_Red))))
+	/*line ../in/main.sl:193:4*/ var price = 4.5
+	/*line ../in/main.sl:194:4*/ fmt.Println(fmt.Sprintf("price: %.2f, 100%% %05d|%8v|%-8v|%q|%+.1f|{literal}", price, x, text, text, text, y))
+	/*line ../in/main.sl:195:4*/ concurrency()
+	/*line ../in/main.sl:196:4*/ using_demo()
+	/*line ../in/main.sl:197:4*/ prelude_demo()
+}
+
+//line ../in/main.sl:199:1
+type color int
+
+const (
+	color_Red color = iota
+	color_Green
+	color_Blue
+)
+
+func (recv color) String() string {
+	switch recv {
+	case color_Red:
+		return "Red"
+	case color_Green:
+		return "Green"
+	case color_Blue:
+		return "Blue"
+	}
+	return "color(?)"
+}
+
+//line ../in/main.sl:205:1
+type shape interface {
+	isshape()
+}
+type shape_Circle struct {
+	_0 float64
+}
+
+func (shape_Circle) isshape() {}
+
+type shape_Rect struct {
+	_0 float64
+	_1 float64
+}
+
+func (shape_Rect) isshape() {}
+
+type shape_Empty struct {
+}
+
+func (shape_Empty) isshape() {}
+
+//line ../in/main.sl:211:1
+func area(shape shape) float64 {
+	/*line ../in/main.sl:212:4*/ switch __match7 := shape.(type) {
+	case shape_Circle:
+		radius := __match7._0
+		{
+			/*line ../in/main.sl:214:12*/ return 3.14 * radius * radius
+
+		}
+	case shape_Rect:
+		width := __match7._0
+		height := __match7._1
+		{
+			/*line ../in/main.sl:217:12*/ return width * height
+
+		}
+	case shape_Empty:
+		{
+			/*line ../in/main.sl:220:12*/ return 0
+
+		}
+	default:
+		panic("unreachable")
+	}
+}
+
+//line ../in/main.sl:225:1
+func describe(color color) string {
+	/*line ../in/main.sl:226:4*/ var description string
+	switch color {
+	case color_Red:
+		description = "warm"
+	default:
+		description = "cold"
+	}
+	/*line ../in/main.sl:230:4*/ return description
+}
+
+//line ../in/main.sl:235:1
+func parse_positive(s string) (int, error) {
+	/*line ../in/main.sl:236:4*/ __value8, __err9 := strconv.Atoi(s)
+	if __err9 != nil {
+		return 0, __err9
+	}
+	var n = __value8
+	/*line ../in/main.sl:237:4*/ if n < 0 {
+		/*line ../in/main.sl:238:8*/ return 0, errors.New(fmt.Sprintf("%v is negative", n))
+
+	}
+	/*line ../in/main.sl:240:4*/ return n, nil
+}
+
+//line ../in/main.sl:243:1
+func first_even(a int, b int) (int, bool) {
+	/*line ../in/main.sl:244:4*/ if a%2 == 0 {
+		/*line ../in/main.sl:245:8*/ return a, true
+
+	}
+	/*line ../in/main.sl:247:4*/ if b%2 == 0 {
+		/*line ../in/main.sl:248:8*/ return b, true
+
+	}
+	/*line ../in/main.sl:250:4*/ return 0, false
+}
+
+//line ../in/main.sl:253:1
+func sum_of_positives(a string, b string) (int, error) {
+	/*line ../in/main.sl:254:4*/ __value10, __err11 := parse_positive(a)
+	if __err11 != nil {
+		return 0, __err11
+	}
+	__value12, __err13 := parse_positive(b)
+	if __err13 != nil {
+		return 0, __err13
+	}
+	return __value10 + __value12, nil
+}
+
+//line ../in/main.sl:257:1
+func report(s string) string {
+	/*line ../in/main.sl:258:4*/ var text string
+	{
+		__value14, __err15 := parse_positive(s)
+		if __err15 != nil {
+			e := __err15
+			text = fmt.Sprintf("failed: %v", e)
 		} else {
-			ordinal = "th"
+			n := __value14
+			text = fmt.Sprintf("parsed %v", n)
 		}
-		fmt.Println(fmt.Sprintf("index (%v): hi for the %v%v time", i-1, i, ordinal))
-		if i == count {
-			break
+	}
+	/*line ../in/main.sl:262:4*/ return text
+}
+
+//line ../in/main.sl:265:1
+type labeled interface {
+	fmt.Stringer
+	Label(prefix string) string
+}
+
+//line ../in/main.sl:270:1
+func kind_of(value any) string {
+	/*line ../in/main.sl:271:4*/ var kind string
+	switch __match16 := value.(type) {
+	case int:
+		n := __match16
+		kind = fmt.Sprintf("int %v", n)
+	case labeled:
+		l := __match16
+		kind = l.Label("labeled")
+	case fmt.Stringer:
+		s := __match16
+		kind = fmt.Sprintf("stringer %v", s)
+	default:
+		kind = "unknown"
+	}
+	/*line ../in/main.sl:277:4*/ return kind
+}
+
+//line ../in/main.sl:280:1
+func as_text(value any) (string, bool) {
+	/*line ../in/main.sl:281:4*/ __value17, __ok18 := value.(string)
+	if !__ok18 {
+		return "", false
+	}
+	var text = __value17
+	/*line ../in/main.sl:282:4*/ return text, true
+}
+
+//line ../in/main.sl:287:1
+func open_or_panic(path string) *os.File {
+	/*line ../in/main.sl:288:4*/ {
+		__value19, __err20 := os.Open(path)
+		if __err20 != nil {
+			e := __err20
+			panic(e)
+		} else {
+			file := __value19
+			{
+				/*line ../in/main.sl:290:12*/ return file
+
+			}
+		}
+	}
+}
+
+//line ../in/main.sl:296:1
+func write_greeting(path string) (int, error) {
+	/*line ../in/main.sl:297:4*/ __value21, __err22 := os.Create(path)
+	if __err22 != nil {
+		return 0, __err22
+	}
+	var file = __value21
+	defer file.Close()
+	/*line ../in/main.sl:298:4*/ __value23, __err24 := file.WriteString("hello from simplelang\n")
+	if __err24 != nil {
+		return 0, __err24
+	}
+	return __value23, nil
+}
+
+//line ../in/main.sl:301:1
+func using_demo() (int, error) {
+	/*line ../in/main.sl:302:4*/ var path = os.TempDir() + "/simplelang_using.txt"
+	/*line ../in/main.sl:303:4*/ defer func() {
+		/*line ../in/main.sl:304:8*/ os.Remove(path)
+		/*line ../in/main.sl:305:8*/ fmt.Println("removed temporary file")
+	}()
+	/*line ../in/main.sl:307:4*/ __value25, __err26 := write_greeting(path)
+	if __err26 != nil {
+		return 0, __err26
+	}
+	var written = __value25
+	/*line ../in/main.sl:308:4*/ {
+		func() {
+			/*line ../in/main.sl:309:8*/ var file = open_or_panic(path)
+			defer file.Close()
+			/*line ../in/main.sl:310:8*/ fmt.Println("reopened file with", written, "bytes")
+		}()
+	}
+	/*line ../in/main.sl:312:4*/ return written, nil
+}
+
+//line ../in/main.sl:315:1
+func ask_number() (int, error) {
+	/*line ../in/main.sl:316:4*/ __value27, __err28 := __readLine()
+	if __err28 != nil {
+		return 0, __err28
+	}
+	var line = __value27
+	/*line ../in/main.sl:317:4*/ __value29, __err30 := strconv.Atoi(line)
+	if __err30 != nil {
+		return 0, __err30
+	}
+	var number = __value29
+	/*line ../in/main.sl:318:4*/ return number, nil
+}
+
+//line ../in/main.sl:321:1
+func prelude_demo() {
+	/*line ../in/main.sl:322:4*/ var numbers []int
+	/*line ../in/main.sl:323:4*/ numbers = append(numbers, 1, 2, 3)
+	/*line ../in/main.sl:324:4*/ __assert(len(numbers) == 3, "main.sl:324:5", "numbers:", numbers)
+	/*line ../in/main.sl:325:4*/ var doubled int
+	{
+		__value31, __err32 := strconv.Atoi("21")
+		if __err32 != nil {
+			doubled = 0
+		} else {
+			n := __value31
+			doubled = n * 2
+		}
+	}
+	/*line ../in/main.sl:329:4*/ fmt.Fprintln(os.Stderr, fmt.Sprintf("%d numbers, doubled %v", len(numbers), doubled), "(stderr)")
+	/*line ../in/main.sl:330:4*/ {
+		__value33, __err34 := strconv.Atoi("not a number")
+		if __err34 != nil {
+			e := __err34
+			fmt.Println("parse_int failed:", e)
+		} else {
+			n := __value33
+			fmt.Println("parsed", n)
 		}
 	}
 }
@@ -0,0 +1,41 @@
+// Code generated by simplelang. DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func __assert(condition bool, position string, values ...any) {
+	if !condition {
+		message := "assertion failed at " + position
+		if len(values) > 0 {
+			message += ": " + strings.TrimSuffix(fmt.Sprintln(values...), "\n")
+		}
+		panic(message)
+	}
+}
+
+func __readLine() (string, error) {
+	line := []byte{}
+	buffer := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(buffer)
+		if n == 1 {
+			if buffer[0] == '\n' {
+				break
+			}
+			line = append(line, buffer[0])
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				break
+			}
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
@@ -2,8 +2,11 @@ package ast
 
 import (
 	"fmt"
+	"regexp"
+	"simplelang/src/diag"
 	"simplelang/src/token"
 	"strconv"
+	"strings"
 )
 
 // This is what I originally intended for my languages to be capable of,
@@ -27,6 +30,8 @@ type ValueDeclarationVariant int
 const (
 	ValueDeclarationVariant_const ValueDeclarationVariant = iota
 	ValueDeclarationVariant_let
+	// like let, but the value is closed at the end of the block
+	ValueDeclarationVariant_using
 )
 
 type ValueDeclaration struct {
@@ -35,14 +40,33 @@ type ValueDeclaration struct {
 	// TODO: should this just be a string, instead of a string pointer?
 	ExplicitType *string
 	Expression   *Expression
+	// only allowed for declarations in the file body
+	Public bool
 	token.Span
 }
 
 func (recv ValueDeclaration) isStatement() {}
 
+type ConstGroupStatement struct {
+	// the ones without an expression repeat the previous expression
+	Declarations []ValueDeclaration
+	token.Span
+}
+
+func (recv ConstGroupStatement) isStatement() {}
+
+// `init { ... }`, which is only allowed in the file body
+type InitStatement struct {
+	Body BlockExpression
+	token.Span
+}
+
+func (recv InitStatement) isStatement() {}
+
 type Parameter struct {
 	Name string
 	Type string
+	token.Span
 }
 
 type FunctionDeclarationStatement struct {
@@ -53,23 +77,30 @@ type FunctionDeclarationStatement struct {
 	// and generics
 	ReturnTypes []string
 	Statements  []Statement
+	Public      bool
+	token.Span
 }
 
 func (recv FunctionDeclarationStatement) isStatement() {}
 
 type ReturnStatement struct {
-	Expression Expression
+	// empty for a bare `return`
+	Expressions []Expression
+	token.Span
 }
 
 func (recv ReturnStatement) isStatement() {}
 
 type LoopStatement struct {
 	Statements []Statement
+	token.Span
 }
 
 func (recv LoopStatement) isStatement() {}
 
-type BreakStatement struct{}
+type BreakStatement struct {
+	token.Span
+}
 
 func (recv BreakStatement) isStatement() {}
 
@@ -85,11 +116,13 @@ func (recv Assignment) isStatement() {}
 type Expression interface {
 	Statement
 	isExpression()
+	Location() token.Span
 }
 
 type BlockExpression struct {
 	Statements []Statement
 	Expression *Expression
+	token.Span
 }
 
 func (recv BlockExpression) isStatement()  {}
@@ -99,6 +132,7 @@ type IfExpression struct {
 	Condition  Expression
 	Consequent BlockExpression
 	Alternate  *Expression
+	token.Span
 }
 
 func (recv IfExpression) isStatement()  {}
@@ -156,6 +190,197 @@ type ExpressionCall struct {
 func (recv ExpressionCall) isExpression() {}
 func (recv ExpressionCall) isStatement()  {}
 
+// `expression?` returns early from the enclosing function,
+// if the Result holds an error or the Option holds no value
+type ExpressionTry struct {
+	Expression Expression
+	token.Span
+}
+
+func (recv ExpressionTry) isExpression() {}
+func (recv ExpressionTry) isStatement()  {}
+
+// `value as Type` or `Type(value)`
+type ExpressionConversion struct {
+	Expression Expression
+	Type       string
+	token.Span
+}
+
+func (recv ExpressionConversion) isExpression() {}
+func (recv ExpressionConversion) isStatement()  {}
+
+// `value.(Type)`
+type ExpressionTypeAssertion struct {
+	Expression Expression
+	Type       string
+	token.Span
+}
+
+func (recv ExpressionTypeAssertion) isExpression() {}
+func (recv ExpressionTypeAssertion) isStatement()  {}
+
+type InterfaceMethod struct {
+	Identifier  string
+	Parameters  []Parameter
+	ReturnTypes []string
+}
+
+type InterfaceDeclarationStatement struct {
+	Identifier string
+	Methods    []InterfaceMethod
+	// embedded interfaces like `fmt.Stringer`
+	Embedded []string
+	Public   bool
+	token.Span
+}
+
+func (recv InterfaceDeclarationStatement) isStatement() {}
+
+// types used as values, like in `make(chan int)`
+type ExpressionType struct {
+	Type string
+	token.Span
+}
+
+func (recv ExpressionType) isExpression() {}
+func (recv ExpressionType) isStatement()  {}
+
+// `spawn f()` or `spawn { ... }`
+type SpawnStatement struct {
+	Expression Expression
+	token.Span
+}
+
+func (recv SpawnStatement) isStatement() {}
+
+// `defer f()` or `defer { ... }`
+type DeferStatement struct {
+	Expression Expression
+	token.Span
+}
+
+func (recv DeferStatement) isStatement() {}
+
+// `channel <- value`
+type SendStatement struct {
+	Channel Expression
+	Value   Expression
+	token.Span
+}
+
+func (recv SendStatement) isStatement() {}
+
+type SelectArmVariant int
+
+const (
+	// `let value = <-channel => ...` or `<-channel => ...`
+	SelectArmVariant_receive SelectArmVariant = iota
+	// `channel <- value => ...`
+	SelectArmVariant_send
+	// `_ => ...`
+	SelectArmVariant_default
+)
+
+type SelectArm struct {
+	Variant SelectArmVariant
+	// only set for receive arms declaring a variable
+	Binding     string
+	BindingSpan token.Span
+	Channel     Expression
+	// only set for send arms
+	Value      Expression
+	Expression Expression
+}
+
+type SelectStatement struct {
+	Arms []SelectArm
+	token.Span
+}
+
+func (recv SelectStatement) isStatement() {}
+
+type EnumVariant struct {
+	Name string
+	// types of the payload, empty if the variant carries no data
+	Types []string
+}
+
+// `type UserID int` declares a new type, `type Name = string` an alias
+type TypeDeclarationStatement struct {
+	Identifier string
+	Type       string
+	Alias      bool
+	Public     bool
+	token.Span
+}
+
+func (recv TypeDeclarationStatement) isStatement() {}
+
+type EnumDeclarationStatement struct {
+	Identifier string
+	Variants   []EnumVariant
+	Public     bool
+	token.Span
+}
+
+func (recv EnumDeclarationStatement) isStatement() {}
+
+// HasPayload reports whether at least one variant carries data,
+// which decides how the enum is lowered to go
+func (recv EnumDeclarationStatement) HasPayload() bool {
+	for _, variant := range recv.Variants {
+		if len(variant.Types) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type Pattern interface {
+	isPattern()
+	Location() token.Span
+}
+
+// `_`
+type PatternWildcard struct {
+	token.Span
+}
+
+func (recv PatternWildcard) isPattern() {}
+
+// `Shape.Circle(radius)` or `Color.Red`
+type PatternVariant struct {
+	Identifier string
+	Bindings   []string
+	token.Span
+}
+
+func (recv PatternVariant) isPattern() {}
+
+// `radius: float64`, matches if the value has the given type
+type PatternType struct {
+	Binding string
+	Type    string
+	token.Span
+}
+
+func (recv PatternType) isPattern() {}
+
+type MatchArm struct {
+	Pattern    Pattern
+	Expression Expression
+}
+
+type MatchExpression struct {
+	Subject Expression
+	Arms    []MatchArm
+	token.Span
+}
+
+func (recv MatchExpression) isStatement()  {}
+func (recv MatchExpression) isExpression() {}
+
 type Literal interface {
 	isLiteral()
 }
@@ -178,11 +403,154 @@ type FloatLiteral struct {
 
 func (recv FloatLiteral) isLiteral() {}
 
+// String returns the shortest decimal, which go parses as the value, with
+// a decimal point or exponent, so go doesn't take it for an integer
+func (recv FloatLiteral) String() string {
+	str := strconv.FormatFloat(recv.Value, 'g', -1, 64)
+	if !strings.ContainsAny(str, ".eIN") {
+		str += ".0"
+	}
+	return str
+}
+
 type InterpolatedStringLiteral struct {
 	Value       string
 	StringParts []string
-	// TODO: this shouldn't only be an expression, but also a format string (:%s or even :%d02 for padding)
 	Expressions []Expression
+	// one for each expression, `{price:.2f}` has the format `.2f`
+	Formats []FormatSpecifier
+}
+
+// `[align][+][0][width][.precision][verb]`, like in `{name:>10}` or `{n:+05d}`
+type FormatSpecifier struct {
+	// '<', '>' or 0 if not aligned
+	Align   rune
+	Sign    bool
+	ZeroPad bool
+	// -1 if not set
+	Width int
+	// -1 if not set
+	Precision int
+	// the fmt verb, 'v' if not set
+	Verb rune
+}
+
+var format_verbs = "vdfeEgGsqxXobctpU"
+
+// GoVerb translates `{price:.2f}` to `%.2f` or `{name:<10}` to `%-10v`
+func (recv FormatSpecifier) GoVerb() string {
+	str := "%"
+	if recv.Align == '<' {
+		str += "-"
+	}
+	if recv.Sign {
+		str += "+"
+	}
+	if recv.ZeroPad {
+		str += "0"
+	}
+	if recv.Width != -1 {
+		str += fmt.Sprint(recv.Width)
+	}
+	if recv.Precision != -1 {
+		str += "." + fmt.Sprint(recv.Precision)
+	}
+	return str + string(recv.Verb)
+}
+
+func parse_format_specifier(specifier string, position token.Span) FormatSpecifier {
+	format := FormatSpecifier{Width: -1, Precision: -1, Verb: 'v'}
+	fail := func(reason string) {
+		panic(diag.Errorf(position, "invalid format specifier %q: %s", specifier, reason))
+	}
+	runes := []rune(specifier)
+	i := 0
+	read_number := func() int {
+		number := -1
+		for i < len(runes) && runes[i] >= '0' && runes[i] <= '9' {
+			if number == -1 {
+				number = 0
+			}
+			number = number*10 + int(runes[i]-'0')
+			i++
+		}
+		return number
+	}
+	if len(runes) > 1 && (runes[1] == '<' || runes[1] == '>') {
+		fail("custom fill characters are not supported")
+	}
+	if i < len(runes) && (runes[i] == '<' || runes[i] == '>') {
+		format.Align = runes[i]
+		i++
+	}
+	if i < len(runes) && runes[i] == '+' {
+		format.Sign = true
+		i++
+	}
+	if i < len(runes) && runes[i] == '0' {
+		format.ZeroPad = true
+		i++
+	}
+	format.Width = read_number()
+	if i < len(runes) && runes[i] == '.' {
+		i++
+		format.Precision = read_number()
+		if format.Precision == -1 {
+			fail("expected precision after .")
+		}
+	}
+	if i < len(runes) {
+		if !strings.ContainsRune(format_verbs, runes[i]) {
+			fail(fmt.Sprintf("unknown verb %q, expected one of %s", runes[i], format_verbs))
+		}
+		format.Verb = runes[i]
+		i++
+	}
+	if i < len(runes) {
+		fail(fmt.Sprintf("unexpected %q after verb", runes[i]))
+	}
+	if format.ZeroPad && format.Align == '<' {
+		fail("left aligned values can't be padded with zeros")
+	}
+	if format.ZeroPad && format.Width == -1 {
+		fail("zero padding needs a width")
+	}
+	if format.Precision != -1 && strings.ContainsRune("ctpU", format.Verb) {
+		fail(fmt.Sprintf("verb %q doesn't support a precision", format.Verb))
+	}
+	return format
+}
+
+// returns the index of the `:` separating the expression from the format
+// specifier in an interpolation hole or -1, colons nested in parentheses,
+// braces or strings belong to the expression
+func find_format_separator(runes []rune) int {
+	depth := 0
+	separator := -1
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case '"':
+			start := i
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '{' && start > 0 && runes[start-1] == '$' {
+					end, ok := token.FindInterpolationHoleEnd(runes, i)
+					if !ok {
+						return separator
+					}
+					i = end
+				}
+			}
+		case ':':
+			if depth == 0 {
+				separator = i
+			}
+		}
+	}
+	return separator
 }
 
 func (recv InterpolatedStringLiteral) isLiteral() {}
@@ -190,7 +558,10 @@ func (recv InterpolatedStringLiteral) isLiteral() {}
 type Ast struct {
 	tokens        []token.Token
 	current_index int
-	Statements    []Statement
+	// the constructs being parsed, the innermost one is pointed at, if the
+	// file ends before it does, see end_of_file
+	openings   []diag.Label
+	Statements []Statement
 }
 
 func NewAst(tokens []token.Token) Ast {
@@ -198,14 +569,74 @@ func NewAst(tokens []token.Token) Ast {
 		tokens:     tokens,
 		Statements: []Statement{},
 	}
+	defer ast.locate_panic()
 	ast.parse()
 	return ast
 }
 
+var position_prefix = regexp.MustCompile(`^\d+:\d+: `)
+
+// most parser errors don't know their position, so they are reported at
+// the token the parser stopped at
+func (recv *Ast) locate_panic() {
+	recv.locate(recover())
+}
+
+func (recv *Ast) locate(r any) {
+	if r == nil {
+		return
+	}
+	message, is_string := r.(string)
+	if !is_string || position_prefix.MatchString(message) || len(recv.tokens) == 0 {
+		panic(r)
+	}
+	index := recv.current_index
+	if index >= len(recv.tokens) {
+		index = len(recv.tokens) - 1
+	}
+	panic(diag.Errorf(*recv.tokens[index].GetSpan(), "%s", message))
+}
+
 func (recv *Ast) get_current_token() token.Token {
+	if recv.current_index >= len(recv.tokens) {
+		panic(recv.end_of_file())
+	}
 	return recv.tokens[recv.current_index]
 }
 
+// reported right after the last token, which isn't a new line
+func (recv *Ast) end_of_file() diag.Diagnostic {
+	end := token.Span{}
+	for i := len(recv.tokens) - 1; i >= 0; i-- {
+		if _, is_new_line := recv.tokens[i].(*token.NewLine); !is_new_line {
+			last := *recv.tokens[i].GetSpan()
+			end = token.Span{
+				StartIndex:       last.ExcludedEndIndex,
+				ExcludedEndIndex: last.ExcludedEndIndex,
+				StartRowIndex:    last.EndRowIndex,
+				StartColumnIndex: last.EndColumnIndex,
+				EndRowIndex:      last.EndRowIndex,
+				EndColumnIndex:   last.EndColumnIndex,
+			}
+			break
+		}
+	}
+	diagnostic := diag.Errorf(end, "unexpected end of file")
+	if len(recv.openings) > 0 {
+		diagnostic.Secondary = append(diagnostic.Secondary, recv.openings[len(recv.openings)-1])
+	}
+	return diagnostic
+}
+
+// marks the start of a construct, which has to be closed with close_construct
+func (recv *Ast) open_construct(start token.Span, what string) {
+	recv.openings = append(recv.openings, diag.Label{Span: start, Message: "the " + what + " starts here"})
+}
+
+func (recv *Ast) close_construct() {
+	recv.openings = recv.openings[:len(recv.openings)-1]
+}
+
 func (recv *Ast) increment(by int) {
 	recv.current_index += by
 }
@@ -218,6 +649,10 @@ func (recv *Ast) handle_body() []Statement {
 for_label:
 	for {
 		if recv.current_index >= len(recv.tokens) {
+			// only the file body may end with the file
+			if len(recv.openings) > 0 {
+				panic(recv.end_of_file())
+			}
 			break
 		}
 		token_ := recv.tokens[recv.current_index]
@@ -236,24 +671,35 @@ for_label:
 			break for_label
 		case *token.StringLiteral:
 			statement = recv.handle_expression()
+		case *token.Operator:
+			// i.e. `<-channel`
+			statement = recv.handle_expression()
+		case *token.LeftCurlyBrace:
+			statement = recv.handle_expression()
 		default:
-			panic(fmt.Sprintf("unexpected token.Token: %#v", token_))
+			panic(fmt.Sprintf("unexpected %s", token.Describe(token_)))
 		}
 		statements = append(statements, statement)
 	}
 	return statements
 }
 func (recv *Ast) handle_block_expression() BlockExpression {
+	start := *recv.get_current_token().GetSpan()
 	// skip '{'
 	recv.increment(1)
 	statements := recv.handle_body()
 	if len(statements) > 0 {
 		if expr, last_is_expression := statements[len(statements)-1].(Expression); last_is_expression {
 			statements = statements[:len(statements)-1]
-			return BlockExpression{Statements: statements, Expression: &expr}
+			return BlockExpression{Statements: statements, Expression: &expr, Span: recv.span_since(start)}
 		}
 	}
-	return BlockExpression{Statements: statements, Expression: nil}
+	return BlockExpression{Statements: statements, Expression: nil, Span: recv.span_since(start)}
+}
+
+// the span from start up to the end of the last consumed token
+func (recv *Ast) span_since(start token.Span) token.Span {
+	return start.Merge(*recv.tokens[recv.current_index-1].GetSpan())
 }
 
 func (recv *Ast) handle_call_arguments() []Expression {
@@ -281,6 +727,22 @@ func (recv *Ast) handle_call_arguments() []Expression {
 	return arguments
 }
 
+func (recv *Ast) next_is_left_parenthesis() bool {
+	if recv.current_index+1 >= len(recv.tokens) {
+		return false
+	}
+	_, is_left_parenthesis := recv.tokens[recv.current_index+1].(*token.LeftParenthesis)
+	return is_left_parenthesis
+}
+
+func (recv *Ast) next_is_left_square_bracket() bool {
+	if recv.current_index+1 >= len(recv.tokens) {
+		return false
+	}
+	_, is_left_square_bracket := recv.tokens[recv.current_index+1].(*token.LeftSquareBracket)
+	return is_left_square_bracket
+}
+
 // handles identfiers like `a.b.c.d`
 func (recv *Ast) handle_potentially_complex_identifier() string {
 	must_be_identifier := recv.get_current_token()
@@ -291,13 +753,79 @@ func (recv *Ast) handle_potentially_complex_identifier() string {
 	recv.increment(1)
 	might_be_dot := recv.get_current_token()
 	_, is_dot := might_be_dot.(*token.Dot)
-	if is_dot {
+	// `a.(T)` is a type assertion, which is handled by handle_postfix_operators()
+	if is_dot && !recv.next_is_left_parenthesis() {
 		recv.increment(1)
 		return identifer.Name + "." + recv.handle_potentially_complex_identifier()
 	}
 	return identifer.Name
 }
 
+// handles types like `int`, `*int`, `math.Big`, `chan int`, `[]int`,
+// `map[string]int` or `Result[int]`
+func (recv *Ast) handle_type() string {
+	typeStr := ""
+	if keyword, is_keyword := recv.get_current_token().(*token.Keyword); is_keyword && keyword.KeywordVariant == token.KeywordVariant_Chan {
+		recv.increment(1)
+		return "chan " + recv.handle_type()
+	}
+	if _, is_left_square_bracket := recv.get_current_token().(*token.LeftSquareBracket); is_left_square_bracket {
+		recv.increment(1)
+		if _, is_right_square_bracket := recv.get_current_token().(*token.RightSquareBracket); !is_right_square_bracket {
+			panic(fmt.Sprintf("expected ] of slice type but got %s", token.Describe(recv.get_current_token())))
+		}
+		recv.increment(1)
+		return "[]" + recv.handle_type()
+	}
+	if identifier, is_identifier := recv.get_current_token().(*token.Identifier); is_identifier && identifier.Name == "map" {
+		recv.increment(1)
+		if _, is_left_square_bracket := recv.get_current_token().(*token.LeftSquareBracket); !is_left_square_bracket {
+			panic(fmt.Sprintf("expected [ after map but got %s", token.Describe(recv.get_current_token())))
+		}
+		recv.increment(1)
+		keyType := recv.handle_type()
+		if _, is_right_square_bracket := recv.get_current_token().(*token.RightSquareBracket); !is_right_square_bracket {
+			panic(fmt.Sprintf("expected ] after map key type but got %s", token.Describe(recv.get_current_token())))
+		}
+		recv.increment(1)
+		return "map[" + keyType + "]" + recv.handle_type()
+	}
+	might_be_operator := recv.get_current_token()
+	operator, is_operator := might_be_operator.(*token.Operator)
+	if is_operator {
+		// technically not a multiply, but mistakes have been made :)
+		if operator.OperatorVariant == token.OperatorVariant_Multiply {
+			typeStr += "*"
+		} else {
+			panic(fmt.Sprintf("expected '*' or identifier but got operator: '%s'", operator.OperatorVariant))
+		}
+		recv.increment(1)
+		return typeStr + recv.handle_type()
+	}
+	start := *recv.get_current_token().GetSpan()
+	typeStr += recv.handle_potentially_complex_identifier()
+	if _, is_left_square_bracket := recv.get_current_token().(*token.LeftSquareBracket); is_left_square_bracket {
+		recv.open_construct(start, "generic type")
+		defer recv.close_construct()
+		recv.increment(1)
+		typeStr += "["
+		for {
+			typeStr += recv.handle_type()
+			if _, is_comma := recv.get_current_token().(*token.Comma); !is_comma {
+				break
+			}
+			typeStr += ", "
+			recv.increment(1)
+		}
+		if _, is_right_square_bracket := recv.get_current_token().(*token.RightSquareBracket); !is_right_square_bracket {
+			panic("expected ] after type arguments")
+		}
+		recv.increment(1)
+		typeStr += "]"
+	}
+	return typeStr
+}
+
 func (recv *Ast) handle_function_parameters() []Parameter {
 	parameters := []Parameter{}
 
@@ -327,21 +855,9 @@ func (recv *Ast) handle_function_parameters() []Parameter {
 		param.Name = identifer.Name
 		// identifier for type
 		recv.increment(1)
-		typeStr := ""
-		might_be_operator := recv.get_current_token()
-		operator, is_operator := might_be_operator.(*token.Operator)
-		if is_operator {
-			// technically not a multiply, but mistakes have been made :)
-			if operator.OperatorVariant == token.OperatorVariant_Multiply {
-				typeStr += "*"
-			} else {
-				panic(fmt.Sprintf("expected '*' or identifier but got operator: '%s'", operator.OperatorVariant))
-			}
-			recv.increment(1)
-		}
-		typeStr += recv.handle_potentially_complex_identifier()
-		param.Type = typeStr
-		// no need to increment, as "handle_potentially_complex_identifier()" has done it
+		param.Type = recv.handle_type()
+		param.Span = recv.span_since(identifer.Span)
+		// no need to increment, as "handle_type()" has done it
 		current_token = recv.get_current_token()
 		if _, is_comma := current_token.(*token.Comma); is_comma {
 			recv.increment(1)
@@ -364,16 +880,28 @@ func (recv *Ast) handle_function_return_types() []string {
 		return returnTypes
 	}
 	if _, is_left_parenthesis := current_token.(*token.LeftParenthesis); !is_left_parenthesis {
-		identifier := recv.handle_potentially_complex_identifier()
-		returnTypes = append(returnTypes, identifier)
+		returnTypes = append(returnTypes, recv.handle_type())
 		return returnTypes
 	}
-	// TODO: handle multiple return types
+	// skip '('
+	recv.increment(1)
+	for {
+		if _, is_right_parenthesis := recv.get_current_token().(*token.RightParenthesis); is_right_parenthesis {
+			recv.increment(1)
+			break
+		}
+		returnTypes = append(returnTypes, recv.handle_type())
+		if _, is_comma := recv.get_current_token().(*token.Comma); is_comma {
+			recv.increment(1)
+		}
+	}
 	return returnTypes
 }
 
 func (recv *Ast) handle_identifier() Statement {
+	start := *recv.get_current_token().GetSpan()
 	identifier := recv.handle_potentially_complex_identifier()
+	identifier_span := recv.span_since(start)
 
 	current_token := recv.get_current_token()
 	switch current_token := current_token.(type) {
@@ -381,77 +909,243 @@ func (recv *Ast) handle_identifier() Statement {
 	case *token.EqualAssignment:
 		recv.increment(1)
 		expression := recv.handle_expression()
-		return Assignment{Identifier: identifier, Expression: expression}
+		return Assignment{Identifier: identifier, Expression: expression, Span: recv.span_since(start)}
 	case *token.LeftParenthesis:
 		arguments := recv.handle_call_arguments()
-		return ExpressionCall{Identifier: identifier, Arguments: arguments}
-	case *token.NewLine:
-		return ExpressionIdentifier{Identifier: identifier}
+		return recv.handle_postfix_operators(ExpressionCall{Identifier: identifier, Arguments: arguments, Span: recv.span_since(start)})
+	// `{ value }` on one line
+	case *token.NewLine, *token.RightCurlyBrace:
+		return ExpressionIdentifier{Identifier: identifier, Span: identifier_span}
+	case *token.Dot:
+		return recv.handle_postfix_operators(ExpressionIdentifier{Identifier: identifier, Span: identifier_span})
+	case *token.Operator:
+		if current_token.OperatorVariant != token.OperatorVariant_Arrow {
+			panic(fmt.Sprintf("unexpected operator at start of statement: %s", current_token.OperatorVariant))
+		}
+		recv.increment(1)
+		value := recv.handle_expression()
+		return SendStatement{Channel: ExpressionIdentifier{Identifier: identifier, Span: identifier_span}, Value: value, Span: recv.span_since(start)}
 	default:
-		panic(fmt.Sprintf("unexpected token.Token: %#v", current_token))
+		panic(fmt.Sprintf("unexpected %s", token.Describe(current_token)))
+	}
+}
+
+func (recv *Ast) handle_postfix_operators(expression Expression) Expression {
+	for {
+		switch current_token := recv.get_current_token().(type) {
+		case *token.QuestionMark:
+			recv.increment(1)
+			expression = ExpressionTry{Expression: expression, Span: expression.Location().Merge(current_token.Span)}
+		case *token.Dot:
+			if !recv.next_is_left_parenthesis() {
+				return expression
+			}
+			recv.open_construct(expression.Location(), "type assertion")
+			// skipping '.('
+			recv.increment(2)
+			assertion := ExpressionTypeAssertion{Expression: expression, Type: recv.handle_type()}
+			if _, is_right_parenthesis := recv.get_current_token().(*token.RightParenthesis); !is_right_parenthesis {
+				panic("expected ) after type in type assertion")
+			}
+			recv.increment(1)
+			recv.close_construct()
+			assertion.Span = recv.span_since(expression.Location())
+			expression = assertion
+		case *token.Keyword:
+			if current_token.KeywordVariant != token.KeywordVariant_As {
+				return expression
+			}
+			recv.open_construct(expression.Location(), "conversion")
+			recv.increment(1)
+			type_ := recv.handle_type()
+			recv.close_construct()
+			expression = ExpressionConversion{Expression: expression, Type: type_, Span: recv.span_since(expression.Location())}
+		default:
+			return expression
+		}
 	}
 }
 
+// the types go declares, calling them converts the value
+var predeclared_types = map[string]bool{
+	"bool": true, "string": true, "int": true, "int8": true, "int16": true, "int32": true,
+	"int64": true, "uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"uintptr": true, "byte": true, "rune": true, "float32": true, "float64": true,
+	"complex64": true, "complex128": true, "any": true, "error": true,
+}
+
+// `Type(value)` for types, which can't be told apart from functions by
+// their name, like `[]byte(s)`, the current token is the type's first one
+func (recv *Ast) handle_conversion_call() ExpressionConversion {
+	start := *recv.get_current_token().GetSpan()
+	type_ := recv.handle_type()
+	if _, is_left_parenthesis := recv.get_current_token().(*token.LeftParenthesis); !is_left_parenthesis {
+		panic(fmt.Sprintf("expected ( after %s to convert a value but got %s", type_, token.Describe(recv.get_current_token())))
+	}
+	arguments := recv.handle_call_arguments()
+	if len(arguments) != 1 {
+		panic(fmt.Sprintf("conversion to %s takes exactly one value but got %d", type_, len(arguments)))
+	}
+	return ExpressionConversion{Expression: arguments[0], Type: type_, Span: recv.span_since(start)}
+}
+
 func (recv *Ast) handle_identifier_expression() Expression {
+	if identifier, is_identifier := recv.get_current_token().(*token.Identifier); is_identifier {
+		if (identifier.Name == "map" && recv.next_is_left_square_bracket()) || (predeclared_types[identifier.Name] && recv.next_is_left_parenthesis()) {
+			return recv.handle_conversion_call()
+		}
+	}
+	start := *recv.get_current_token().GetSpan()
 	identifier := recv.handle_potentially_complex_identifier()
 	current_token := recv.get_current_token()
 	if _, ok := current_token.(*token.LeftParenthesis); ok {
 		arguments := recv.handle_call_arguments()
-		return ExpressionCall{Identifier: identifier, Arguments: arguments}
+		return ExpressionCall{Identifier: identifier, Arguments: arguments, Span: recv.span_since(start)}
 	}
-	return ExpressionIdentifier{Identifier: identifier}
+	return ExpressionIdentifier{Identifier: identifier, Span: recv.span_since(start)}
 }
 
 func (recv *Ast) handle_variable_declaration_explicit_type() string {
 	// skipping colon
 	recv.increment(1)
-	must_be_identifier := recv.get_current_token()
-	identifier, is_identifer := must_be_identifier.(*token.Identifier)
-	if !is_identifer {
-		panic("expected identifier")
-	}
-
-	recv.increment(1)
+	return recv.handle_type()
+}
 
-	return identifier.Name
+// parses the source code inside of an interpolation hole with the
+// regular expression parser, start is the position of its first rune
+func parse_interpolation_hole(source string, start token.Span) Expression {
+	tokens := token.Tokenize(source)
+	// spans are relative to the hole, so they are moved into the string
+	for _, token_ := range tokens {
+		span := token_.GetSpan()
+		if span.StartRowIndex == 0 {
+			span.StartColumnIndex += start.StartColumnIndex
+		}
+		if span.EndRowIndex == 0 {
+			span.EndColumnIndex += start.StartColumnIndex
+		}
+		span.StartRowIndex += start.StartRowIndex
+		span.EndRowIndex += start.StartRowIndex
+		span.StartIndex += start.StartIndex
+		span.ExcludedEndIndex += start.StartIndex
+	}
+	if len(tokens) == 0 {
+		panic(diag.Errorf(start, "empty interpolation hole"))
+	}
+	// expressions have to be terminated, the new line is placed right
+	// after the last token
+	end := *tokens[len(tokens)-1].GetSpan()
+	end.StartIndex, end.StartRowIndex, end.StartColumnIndex = end.ExcludedEndIndex, end.EndRowIndex, end.EndColumnIndex
+	tokens = append(tokens, &token.NewLine{Span: end})
+
+	hole := Ast{tokens: tokens}
+	defer func() {
+		r := recover()
+		if _, is_string := r.(string); is_string && hole.current_index == len(tokens)-1 {
+			panic(diag.Errorf(end, "the expression in the interpolation hole is incomplete"))
+		}
+		hole.locate(r)
+	}()
+	expression := hole.handle_expression()
+	if hole.current_index != len(tokens)-1 {
+		unexpected := hole.get_current_token()
+		panic(diag.Errorf(*unexpected.GetSpan(), "unexpected %s in interpolation hole", token.Describe(unexpected)))
+	}
+	return expression
 }
 
-func handle_interpolated_string_expression(runes []rune, i *int) Expression {
-	// maybe the lexer could help here to parse more complex expressions?
-	// for now only identifiers (although something like `i + 1`
-	// is interpreted as an identifier and the builder just outputs
-	// it, so free simple expressions :) )
-	raw_expression := ""
-	for {
-		*i++
-		current_rune := runes[*i]
-		if current_rune == '}' {
-			break
+// the span of the text, which starts where start does
+func extend_span(start token.Span, text []rune) token.Span {
+	span := start
+	span.ExcludedEndIndex = span.StartIndex
+	span.EndRowIndex = span.StartRowIndex
+	span.EndColumnIndex = span.StartColumnIndex
+	for _, current_rune := range text {
+		span.ExcludedEndIndex += 1
+		if current_rune == '\n' {
+			span.EndRowIndex += 1
+			span.EndColumnIndex = 0
+		} else {
+			span.EndColumnIndex += 1
 		}
-		raw_expression += string(current_rune)
 	}
-	return ExpressionIdentifier{Identifier: raw_expression}
+	return span
 }
 
-func string_to_interpolated_string(input string) InterpolatedStringLiteral {
-	returnValue := InterpolatedStringLiteral{Value: input}
-	runes := []rune(input)
+// splits the string into its parts and the expressions inside of
+// the `{}` holes, `{{` and `}}` are the escaped braces
+func string_to_interpolated_string(literal *token.StringLiteral) InterpolatedStringLiteral {
+	returnValue := InterpolatedStringLiteral{Value: literal.Value}
+	runes := []rune(literal.Value)
 	parts := []string{}
 	expressions := []Expression{}
+	formats := []FormatSpecifier{}
 	current_part := ""
+
+	// the position of the current rune, the content starts after the quote
+	position := token.Span{
+		StartIndex:       literal.StartIndex + 1,
+		StartRowIndex:    literal.StartRowIndex,
+		StartColumnIndex: literal.StartColumnIndex + 1,
+	}
+	advance := func(current_rune rune) {
+		position.StartIndex += 1
+		if current_rune == '\n' {
+			position.StartRowIndex += 1
+			position.StartColumnIndex = 0
+		} else {
+			position.StartColumnIndex += 1
+		}
+	}
+	is_doubled := func(i int) bool {
+		return i+1 < len(runes) && runes[i+1] == runes[i]
+	}
+
 	for i := 0; i < len(runes); i++ {
 		current_rune := runes[i]
-		if current_rune == '{' {
+		switch {
+		case (current_rune == '{' || current_rune == '}') && is_doubled(i):
+			current_part += string(current_rune)
+			advance(current_rune)
+			advance(current_rune)
+			i++
+		case current_rune == '}':
+			panic(diag.Errorf(extend_span(position, runes[i:i+1]), "unmatched } in interpolated string, use }} for a literal }"))
+		case current_rune == '{':
+			end, ok := token.FindInterpolationHoleEnd(runes, i)
+			if !ok {
+				panic(diag.Errorf(extend_span(position, runes[i:]), "unterminated interpolation hole"))
+			}
 			parts = append(parts, current_part)
 			current_part = ""
-			expressions = append(expressions, handle_interpolated_string_expression(runes, &i))
-		} else {
+			advance(current_rune)
+			hole := runes[i+1 : end]
+			format := FormatSpecifier{Width: -1, Precision: -1, Verb: 'v'}
+			if separator := find_format_separator(hole); separator != -1 {
+				before := extend_span(position, hole[:separator+1])
+				format_start := token.Span{
+					StartIndex:       before.ExcludedEndIndex,
+					StartRowIndex:    before.EndRowIndex,
+					StartColumnIndex: before.EndColumnIndex,
+				}
+				format = parse_format_specifier(string(hole[separator+1:]), extend_span(format_start, hole[separator+1:]))
+				hole = hole[:separator]
+			}
+			expressions = append(expressions, parse_interpolation_hole(string(hole), extend_span(position, hole)))
+			formats = append(formats, format)
+			for j := i + 1; j <= end; j++ {
+				advance(runes[j])
+			}
+			i = end
+		default:
 			current_part += string(current_rune)
+			advance(current_rune)
 		}
 	}
 	parts = append(parts, current_part)
 	returnValue.StringParts = parts
 	returnValue.Expressions = expressions
+	returnValue.Formats = formats
 
 	return returnValue
 }
@@ -461,43 +1155,44 @@ func (recv *Ast) handle_interpolated_string_expression() InterpolatedStringLiter
 	current_token := recv.get_current_token()
 	switch current_token := current_token.(type) {
 	case *token.StringLiteral:
-		value := string_to_interpolated_string(current_token.Value)
+		value := string_to_interpolated_string(current_token)
 		recv.increment(1)
 		return value
 	default:
-		panic(fmt.Sprintf("unexpected token.Token: %#v", current_token))
+		panic(fmt.Sprintf("unexpected %s", token.Describe(current_token)))
 	}
 }
 
 func (recv *Ast) handle_expression() Expression {
 	current_token := recv.get_current_token()
+	start := *current_token.GetSpan()
 
 	var left_expression Expression
 	switch current_token := current_token.(type) {
 	case *token.Dollar:
 		recv.increment(1)
-		left_expression = ExpressionLiteral{Literal: recv.handle_interpolated_string_expression()}
+		left_expression = ExpressionLiteral{Literal: recv.handle_interpolated_string_expression(), Span: recv.span_since(start)}
 	case *token.Identifier:
 		left_expression = recv.handle_identifier_expression()
 	case *token.NumericLiteral:
 		recv.increment(1)
 		// this only allows base 10 ints
 		if int_value, err := strconv.ParseInt(current_token.Value, 10, 64); err == nil {
-			left_expression = ExpressionLiteral{Literal: IntLiteral{Value: int_value}}
+			left_expression = ExpressionLiteral{Literal: IntLiteral{Value: int_value}, Span: start}
 			break
 		}
 		float_value, err := strconv.ParseFloat(current_token.Value, 64)
 		if err != nil {
 			panic(err)
 		}
-		left_expression = ExpressionLiteral{Literal: FloatLiteral{Value: float_value}}
+		left_expression = ExpressionLiteral{Literal: FloatLiteral{Value: float_value}, Span: start}
 	case *token.StringLiteral:
 		recv.increment(1)
-		left_expression = ExpressionLiteral{Literal: StringLiteral{Value: current_token.Value}}
+		left_expression = ExpressionLiteral{Literal: StringLiteral{Value: current_token.Value}, Span: start}
 	case *token.Operator:
 		recv.increment(1)
 		expression := recv.handle_expression()
-		exprUnary := ExpressionUnary{Expression: expression}
+		exprUnary := ExpressionUnary{Expression: expression, Span: recv.span_since(start)}
 		exprUnary.Operator = current_token.OperatorVariant
 		left_expression = exprUnary
 	case *token.LeftParenthesis:
@@ -508,43 +1203,54 @@ func (recv *Ast) handle_expression() Expression {
 			panic("missing right parenthesis")
 		}
 		recv.increment(1)
-		left_expression = ExpressionParenthesized{Expression: expression}
+		left_expression = ExpressionParenthesized{Expression: expression, Span: recv.span_since(start)}
 	case *token.LeftCurlyBrace:
 		left_expression = recv.handle_block_expression()
+	case *token.LeftSquareBracket:
+		left_expression = recv.handle_conversion_call()
 	case *token.Keyword:
 		if current_token.KeywordVariant == token.KeywordVariant_If {
 			left_expression = recv.handle_if_expression()
+		} else if current_token.KeywordVariant == token.KeywordVariant_Match {
+			left_expression = recv.handle_match_expression()
+		} else if current_token.KeywordVariant == token.KeywordVariant_Chan {
+			span := current_token.Span
+			left_expression = ExpressionType{Type: recv.handle_type(), Span: span}
 		} else {
 			panic(fmt.Sprintf("unexpected keyword in expression: %s", current_token.KeywordVariant))
 		}
 	default:
-		panic(fmt.Sprintf("unexpected token.Token: %#v", current_token))
+		panic(fmt.Sprintf("unexpected %s", token.Describe(current_token)))
 	}
+	left_expression = recv.handle_postfix_operators(left_expression)
 
 	if operator_token, is_operator := recv.get_current_token().(*token.Operator); is_operator {
 		recv.increment(1)
 		right := recv.handle_expression()
+		span := start.Merge(right.Location())
 		right_binary_expression, is_binary_expression := right.(ExpressionBinary)
 		if !is_binary_expression {
-			return ExpressionBinary{Left: left_expression, Operator: operator_token.OperatorVariant, Right: right}
+			return ExpressionBinary{Left: left_expression, Operator: operator_token.OperatorVariant, Right: right, Span: span}
 		}
 		right_operator := right_binary_expression.Operator
 		left_operator := operator_token.OperatorVariant
 		left_first := left_operator.HasHigherPrecedenceThan(right_operator)
 		if !left_first {
-			return ExpressionBinary{Left: left_expression, Operator: operator_token.OperatorVariant, Right: right}
+			return ExpressionBinary{Left: left_expression, Operator: operator_token.OperatorVariant, Right: right, Span: span}
 		}
-		new_left_expression := ExpressionBinary{Left: left_expression, Operator: left_operator, Right: right_binary_expression.Left}
+		new_left_expression := ExpressionBinary{Left: left_expression, Operator: left_operator, Right: right_binary_expression.Left, Span: start.Merge(right_binary_expression.Left.Location())}
 		new_right_expression := right_binary_expression.Right
-		return ExpressionBinary{Left: new_left_expression, Operator: right_binary_expression.Operator, Right: new_right_expression}
+		return ExpressionBinary{Left: new_left_expression, Operator: right_binary_expression.Operator, Right: new_right_expression, Span: span}
 	}
 
 	return left_expression
 }
 
 type Import struct {
+	// empty if not renamed, `.` for dot imports and `_` for blank imports
 	Name string
 	Path string
+	token.Span
 }
 type ImportStatement struct {
 	Imports []Import
@@ -552,26 +1258,54 @@ type ImportStatement struct {
 
 func (recv ImportStatement) isStatement() {}
 
+// handles `"math"`, `m "math"`, `. "math"` or `_ "math"`
+func (recv *Ast) handle_import() Import {
+	import_ := Import{}
+	import_.Span = *recv.get_current_token().GetSpan()
+	switch current_token := recv.get_current_token().(type) {
+	case *token.Identifier:
+		import_.Name = current_token.Name
+		recv.increment(1)
+	case *token.Dot:
+		import_.Name = "."
+		recv.increment(1)
+	}
+	importPath, is_string_literal := recv.get_current_token().(*token.StringLiteral)
+	if !is_string_literal {
+		panic(fmt.Sprintf("expected import path but got %s", token.Describe(recv.get_current_token())))
+	}
+	import_.Path = importPath.Value
+	recv.increment(1)
+	import_.Span = recv.span_since(import_.Span)
+	return import_
+}
+
 func (recv *Ast) handle_import_statement() ImportStatement {
-	// this accepts only `import "math"` or `import m "math"`
-	// but not
+	// accepts `import "math"`, `import m "math"` and
 	// `import (
 	// 		"fmt"
 	//		m "math"
 	// )`
 
+	start := *recv.get_current_token().GetSpan()
 	// skip import keyword
 	recv.increment(1)
-	import_ := Import{}
-	current_token := recv.get_current_token()
-	if identifier, is_identifier := current_token.(*token.Identifier); is_identifier {
-		import_.Name = identifier.Name
-		recv.increment(1)
+	if _, is_left_parenthesis := recv.get_current_token().(*token.LeftParenthesis); !is_left_parenthesis {
+		return ImportStatement{Imports: []Import{recv.handle_import()}}
 	}
-	importPath := recv.get_current_token().(*token.StringLiteral)
-	import_.Path = importPath.Value
+	recv.open_construct(start, "import group")
+	defer recv.close_construct()
 	recv.increment(1)
-	return ImportStatement{Imports: []Import{import_}}
+	statement := ImportStatement{Imports: []Import{}}
+	for {
+		recv.skip_new_lines()
+		if _, is_right_parenthesis := recv.get_current_token().(*token.RightParenthesis); is_right_parenthesis {
+			recv.increment(1)
+			break
+		}
+		statement.Imports = append(statement.Imports, recv.handle_import())
+	}
+	return statement
 }
 
 type PackageStatement struct {
@@ -598,10 +1332,22 @@ func (recv *Ast) handle_package_statement() PackageStatement {
 }
 
 func (recv *Ast) handle_value_variable_declaration(declaration_type ValueDeclarationVariant) ValueDeclaration {
-	declaration := ValueDeclaration{Variant: declaration_type}
-
+	start := *recv.get_current_token().GetSpan()
 	// skipping declaration_type token
 	recv.increment(1)
+	declaration := recv.handle_value_declaration_body(declaration_type)
+	// the type of `let x` is inferred from the first value assigned to it
+	if declaration.Expression == nil && declaration_type != ValueDeclarationVariant_let {
+		panic(fmt.Sprintf("%s must be initialized", declaration.Identifier))
+	}
+	declaration.Span = recv.span_since(start)
+	return declaration
+}
+
+// `name: type = expression`, where type and expression are optional
+func (recv *Ast) handle_value_declaration_body(declaration_type ValueDeclarationVariant) ValueDeclaration {
+	declaration := ValueDeclaration{Variant: declaration_type}
+	declaration.Span = *recv.get_current_token().GetSpan()
 	must_be_identifier := recv.get_current_token()
 	identifier, is_identifer := must_be_identifier.(*token.Identifier)
 	if !is_identifer {
@@ -624,29 +1370,91 @@ func (recv *Ast) handle_value_variable_declaration(declaration_type ValueDeclara
 		recv.increment(1)
 		init_expression := recv.handle_expression()
 		declaration.Expression = &init_expression
-	} else {
-		if declaration.ExplicitType == nil {
-			// go does not infer the type, if it is set later
-			//
-			// var test
-			// test = "hi"
-			//
-			// it expects a type after "test"
-			// and we would need a semantic analyzer to do that
-			// so for now just panicking
-			panic("if variable has not init, it must have an explicit type")
+	}
+	declaration.Span = recv.span_since(declaration.Span)
+	return declaration
+}
+
+// handles
+//
+//	const (
+//	    a = iota
+//	    b
+//	)
+//
+// declarations without a value repeat the previous one like in go
+func (recv *Ast) handle_const_group() ConstGroupStatement {
+	group := ConstGroupStatement{Declarations: []ValueDeclaration{}}
+	group.Span = *recv.get_current_token().GetSpan()
+	recv.open_construct(group.Span, "const group")
+	defer recv.close_construct()
+	// skipping const keyword and '('
+	recv.increment(2)
+	for {
+		recv.skip_new_lines()
+		if _, is_right_parenthesis := recv.get_current_token().(*token.RightParenthesis); is_right_parenthesis {
+			recv.increment(1)
+			break
 		}
+		public := false
+		if keyword, is_keyword := recv.get_current_token().(*token.Keyword); is_keyword && keyword.KeywordVariant == token.KeywordVariant_Pub {
+			public = true
+			recv.increment(1)
+		}
+		declaration := recv.handle_value_declaration_body(ValueDeclarationVariant_const)
+		declaration.Public = public
+		if len(group.Declarations) == 0 && declaration.Expression == nil {
+			panic(fmt.Sprintf("the first constant %s of a const group must have a value", declaration.Identifier))
+		}
+		group.Declarations = append(group.Declarations, declaration)
 	}
+	group.Span = recv.span_since(group.Span)
+	return group
+}
 
+func (recv *Ast) handle_type_declaration() TypeDeclarationStatement {
+	declaration := TypeDeclarationStatement{}
+	declaration.Span = *recv.get_current_token().GetSpan()
+	recv.open_construct(declaration.Span, "type declaration")
+	defer recv.close_construct()
+	// skipping type keyword
+	recv.increment(1)
+	identifier, is_identifier := recv.get_current_token().(*token.Identifier)
+	if !is_identifier {
+		panic(fmt.Sprintf("expected identifier after type keyword but got %s", token.Describe(recv.get_current_token())))
+	}
+	declaration.Identifier = identifier.Name
+	recv.increment(1)
+	if _, is_equal_sign := recv.get_current_token().(*token.EqualAssignment); is_equal_sign {
+		declaration.Alias = true
+		recv.increment(1)
+	}
+	declaration.Type = recv.handle_type()
+	declaration.Span = recv.span_since(declaration.Span)
 	return declaration
 }
 
+// `init { ... }` runs when the package is initialized
+func (recv *Ast) handle_init_block() InitStatement {
+	start := *recv.get_current_token().GetSpan()
+	recv.open_construct(start, "init block")
+	defer recv.close_construct()
+	// skipping init keyword
+	recv.increment(1)
+	if _, is_left_curly_brace := recv.get_current_token().(*token.LeftCurlyBrace); !is_left_curly_brace {
+		panic(fmt.Sprintf("expected left curly brace after init but got %s", token.Describe(recv.get_current_token())))
+	}
+	body := recv.handle_block_expression()
+	return InitStatement{Body: body, Span: recv.span_since(start)}
+}
+
 // should function declaration `fn test()` and function expression `let test = fn()`
 // handled by different functions (that should share code of course)?
 // I think yes, because `var test = func hi()` is not allowed
 // `var test = func(recv *Abc)` is allowed, however Abc can't use it as method...
 func (recv *Ast) handle_function_declaration() FunctionDeclarationStatement {
 	declaration := FunctionDeclarationStatement{}
+	declaration.Span = *recv.get_current_token().GetSpan()
 
 	// skipping func token
 	recv.increment(1)
@@ -677,33 +1485,102 @@ func (recv *Ast) handle_function_declaration() FunctionDeclarationStatement {
 	}
 	recv.increment(1)
 	declaration.Statements = recv.handle_body()
+	declaration.Span = recv.span_since(declaration.Span)
 	return declaration
 }
 
+// `pub` exports the following declaration, independent of its case
+func (recv *Ast) handle_pub_declaration() Statement {
+	start := *recv.get_current_token().GetSpan()
+	recv.open_construct(start, "pub declaration")
+	defer recv.close_construct()
+	// skipping pub keyword
+	recv.increment(1)
+	keyword, is_keyword := recv.get_current_token().(*token.Keyword)
+	if !is_keyword {
+		panic(fmt.Sprintf("expected declaration after pub but got %s", token.Describe(recv.get_current_token())))
+	}
+	switch keyword.KeywordVariant {
+	case token.KeywordVariant_Fn:
+		declaration := recv.handle_function_declaration()
+		declaration.Public = true
+		declaration.Span = start.Merge(declaration.Span)
+		return declaration
+	case token.KeywordVariant_Enum:
+		declaration := recv.handle_enum_declaration()
+		declaration.Public = true
+		declaration.Span = start.Merge(declaration.Span)
+		return declaration
+	case token.KeywordVariant_Interface:
+		declaration := recv.handle_interface_declaration()
+		declaration.Public = true
+		declaration.Span = start.Merge(declaration.Span)
+		return declaration
+	case token.KeywordVariant_Type:
+		declaration := recv.handle_type_declaration()
+		declaration.Public = true
+		declaration.Span = start.Merge(declaration.Span)
+		return declaration
+	case token.KeywordVariant_Const, token.KeywordVariant_Let:
+		switch declaration := recv.handle_keyword(keyword).(type) {
+		case ConstGroupStatement:
+			for i := range declaration.Declarations {
+				declaration.Declarations[i].Public = true
+			}
+			declaration.Span = start.Merge(declaration.Span)
+			return declaration
+		case ValueDeclaration:
+			declaration.Public = true
+			declaration.Span = start.Merge(declaration.Span)
+			return declaration
+		default:
+			panic(fmt.Sprintf("unexpected declaration: %#v", declaration))
+		}
+	default:
+		panic(fmt.Sprintf("%s declarations can't be pub", keyword.KeywordVariant))
+	}
+}
+
 func (recv *Ast) handle_return_statement() ReturnStatement {
+	start := *recv.get_current_token().GetSpan()
 	// skipping return keyword
 	recv.increment(1)
 
-	expression := recv.handle_expression()
-	return ReturnStatement{Expression: expression}
+	statement := ReturnStatement{Expressions: []Expression{}, Span: start}
+	switch recv.get_current_token().(type) {
+	case *token.NewLine, *token.RightCurlyBrace:
+		return statement
+	}
+	for {
+		statement.Expressions = append(statement.Expressions, recv.handle_expression())
+		if _, is_comma := recv.get_current_token().(*token.Comma); !is_comma {
+			break
+		}
+		recv.increment(1)
+	}
+	statement.Span = recv.span_since(start)
+	return statement
 }
 
 func (recv *Ast) handle_loop_statement() LoopStatement {
+	start := *recv.get_current_token().GetSpan()
 	// skipping loop keyword and LeftCurlyBrace
 	recv.increment(2)
 
 	statements := recv.handle_body()
-	return LoopStatement{Statements: statements}
+	return LoopStatement{Statements: statements, Span: recv.span_since(start)}
 }
 
 func (recv *Ast) handle_break_statement() BreakStatement {
+	span := *recv.get_current_token().GetSpan()
 	// skipping break keyword
 	recv.increment(1)
 
-	return BreakStatement{}
+	return BreakStatement{Span: span}
 }
 
 func (recv *Ast) handle_if_expression() IfExpression {
+	start := *recv.get_current_token().GetSpan()
 	// skipping if keyword
 	recv.increment(1)
 
@@ -715,7 +1592,7 @@ func (recv *Ast) handle_if_expression() IfExpression {
 	}
 	block := recv.handle_block_expression()
 
-	ifExpression := IfExpression{Condition: condition, Consequent: block}
+	ifExpression := IfExpression{Condition: condition, Consequent: block, Span: start}
 	might_be_else := recv.get_current_token()
 	next_keyword, next_is_keyword := might_be_else.(*token.Keyword)
 
@@ -734,9 +1611,290 @@ func (recv *Ast) handle_if_expression() IfExpression {
 		}
 	}
 
+	ifExpression.Span = recv.span_since(start)
 	return ifExpression
 }
 
+func (recv *Ast) skip_new_lines() {
+	for {
+		if _, is_new_line := recv.get_current_token().(*token.NewLine); !is_new_line {
+			return
+		}
+		recv.increment(1)
+	}
+}
+
+func (recv *Ast) handle_enum_declaration() EnumDeclarationStatement {
+	declaration := EnumDeclarationStatement{}
+	declaration.Span = *recv.get_current_token().GetSpan()
+	recv.open_construct(declaration.Span, "enum")
+	defer recv.close_construct()
+
+	// skipping enum keyword
+	recv.increment(1)
+	must_be_identifier := recv.get_current_token()
+	identifier, is_identifer := must_be_identifier.(*token.Identifier)
+	if !is_identifer {
+		panic("expected identifier after enum keyword")
+	}
+	declaration.Identifier = identifier.Name
+	recv.increment(1)
+
+	if _, is_left_curly_brace := recv.get_current_token().(*token.LeftCurlyBrace); !is_left_curly_brace {
+		panic("expected left curly brace after enum name")
+	}
+	recv.increment(1)
+
+	// variants are separated by commas and/or new lines
+	for {
+		recv.skip_new_lines()
+		current_token := recv.get_current_token()
+		if _, is_right_curly_brace := current_token.(*token.RightCurlyBrace); is_right_curly_brace {
+			recv.increment(1)
+			break
+		}
+		variant_identifier, is_identifier := current_token.(*token.Identifier)
+		if !is_identifier {
+			panic(fmt.Sprintf("expected enum variant name but got %s", token.Describe(current_token)))
+		}
+		variant := EnumVariant{Name: variant_identifier.Name, Types: []string{}}
+		recv.increment(1)
+		if _, is_left_parenthesis := recv.get_current_token().(*token.LeftParenthesis); is_left_parenthesis {
+			recv.increment(1)
+			for {
+				if _, is_right_parenthesis := recv.get_current_token().(*token.RightParenthesis); is_right_parenthesis {
+					recv.increment(1)
+					break
+				}
+				variant.Types = append(variant.Types, recv.handle_type())
+				if _, is_comma := recv.get_current_token().(*token.Comma); is_comma {
+					recv.increment(1)
+				}
+			}
+		}
+		for _, existing := range declaration.Variants {
+			if existing.Name == variant.Name {
+				panic(fmt.Sprintf("enum variant %s.%s declared twice", declaration.Identifier, variant.Name))
+			}
+		}
+		declaration.Variants = append(declaration.Variants, variant)
+		if _, is_comma := recv.get_current_token().(*token.Comma); is_comma {
+			recv.increment(1)
+		}
+	}
+	if len(declaration.Variants) == 0 {
+		panic(fmt.Sprintf("enum %s needs at least one variant", declaration.Identifier))
+	}
+	return declaration
+}
+
+func (recv *Ast) handle_interface_declaration() InterfaceDeclarationStatement {
+	declaration := InterfaceDeclarationStatement{Methods: []InterfaceMethod{}, Embedded: []string{}}
+	declaration.Span = *recv.get_current_token().GetSpan()
+	recv.open_construct(declaration.Span, "interface")
+	defer recv.close_construct()
+
+	// skipping interface keyword
+	recv.increment(1)
+	must_be_identifier := recv.get_current_token()
+	identifier, is_identifer := must_be_identifier.(*token.Identifier)
+	if !is_identifer {
+		panic("expected identifier after interface keyword")
+	}
+	declaration.Identifier = identifier.Name
+	recv.increment(1)
+
+	if _, is_left_curly_brace := recv.get_current_token().(*token.LeftCurlyBrace); !is_left_curly_brace {
+		panic("expected left curly brace after interface name")
+	}
+	recv.increment(1)
+
+	for {
+		recv.skip_new_lines()
+		current_token := recv.get_current_token()
+		if _, is_right_curly_brace := current_token.(*token.RightCurlyBrace); is_right_curly_brace {
+			recv.increment(1)
+			break
+		}
+		keyword, is_keyword := current_token.(*token.Keyword)
+		if !is_keyword || keyword.KeywordVariant != token.KeywordVariant_Fn {
+			// `fmt.Stringer`
+			declaration.Embedded = append(declaration.Embedded, recv.handle_type())
+			continue
+		}
+		// `fn area() float64`
+		recv.increment(1)
+		method_identifier, is_identifier := recv.get_current_token().(*token.Identifier)
+		if !is_identifier {
+			panic("expected method name after fn keyword")
+		}
+		recv.increment(1)
+		method := InterfaceMethod{Identifier: method_identifier.Name}
+		method.Parameters = recv.handle_function_parameters()
+		switch recv.get_current_token().(type) {
+		case *token.NewLine, *token.RightCurlyBrace:
+			method.ReturnTypes = []string{}
+		default:
+			method.ReturnTypes = recv.handle_function_return_types()
+		}
+		for _, existing := range declaration.Methods {
+			if existing.Identifier == method.Identifier {
+				panic(fmt.Sprintf("method %s declared twice in interface %s", method.Identifier, declaration.Identifier))
+			}
+		}
+		declaration.Methods = append(declaration.Methods, method)
+	}
+	return declaration
+}
+
+func (recv *Ast) handle_select_arm() SelectArm {
+	current_token := recv.get_current_token()
+	if keyword, is_keyword := current_token.(*token.Keyword); is_keyword && keyword.KeywordVariant == token.KeywordVariant_Let {
+		recv.increment(1)
+		binding, is_identifier := recv.get_current_token().(*token.Identifier)
+		if !is_identifier {
+			panic("expected identifier after let in select arm")
+		}
+		recv.increment(1)
+		if _, is_equal_assignment := recv.get_current_token().(*token.EqualAssignment); !is_equal_assignment {
+			panic("expected = after identifier in select arm")
+		}
+		recv.increment(1)
+		arm := recv.handle_select_arm()
+		if arm.Variant != SelectArmVariant_receive {
+			panic("only receiving select arms can declare a variable")
+		}
+		arm.Binding = binding.Name
+		arm.BindingSpan = binding.Span
+		return arm
+	}
+	if operator, is_operator := current_token.(*token.Operator); is_operator {
+		if operator.OperatorVariant != token.OperatorVariant_Arrow {
+			panic(fmt.Sprintf("unexpected operator in select arm: %s", operator.OperatorVariant))
+		}
+		recv.increment(1)
+		channel := recv.handle_identifier_expression()
+		return SelectArm{Variant: SelectArmVariant_receive, Channel: channel}
+	}
+	span := *recv.get_current_token().GetSpan()
+	identifier := recv.handle_potentially_complex_identifier()
+	span = recv.span_since(span)
+	if identifier == "_" {
+		return SelectArm{Variant: SelectArmVariant_default}
+	}
+	operator, is_operator := recv.get_current_token().(*token.Operator)
+	if !is_operator || operator.OperatorVariant != token.OperatorVariant_Arrow {
+		panic(fmt.Sprintf("expected <- after channel in select arm but got %s", token.Describe(recv.get_current_token())))
+	}
+	recv.increment(1)
+	value := recv.handle_expression()
+	return SelectArm{Variant: SelectArmVariant_send, Channel: ExpressionIdentifier{Identifier: identifier, Span: span}, Value: value}
+}
+
+func (recv *Ast) handle_select_statement() SelectStatement {
+	statement := SelectStatement{Arms: []SelectArm{}}
+	statement.Span = *recv.get_current_token().GetSpan()
+	recv.open_construct(statement.Span, "select")
+	defer recv.close_construct()
+
+	// skipping select keyword
+	recv.increment(1)
+	if _, is_left_curly_brace := recv.get_current_token().(*token.LeftCurlyBrace); !is_left_curly_brace {
+		panic("select body needs to start with {")
+	}
+	recv.increment(1)
+
+	for {
+		recv.skip_new_lines()
+		if _, is_right_curly_brace := recv.get_current_token().(*token.RightCurlyBrace); is_right_curly_brace {
+			recv.increment(1)
+			break
+		}
+		arm := recv.handle_select_arm()
+		if _, is_fat_arrow := recv.get_current_token().(*token.FatArrow); !is_fat_arrow {
+			panic(fmt.Sprintf("expected => after select arm but got %s", token.Describe(recv.get_current_token())))
+		}
+		recv.increment(1)
+		arm.Expression = recv.handle_expression()
+		statement.Arms = append(statement.Arms, arm)
+		if _, is_comma := recv.get_current_token().(*token.Comma); is_comma {
+			recv.increment(1)
+		}
+	}
+	return statement
+}
+
+func (recv *Ast) handle_pattern() Pattern {
+	span := *recv.get_current_token().GetSpan()
+	identifier := recv.handle_potentially_complex_identifier()
+	if _, is_colon := recv.get_current_token().(*token.Colon); is_colon {
+		recv.increment(1)
+		type_ := recv.handle_type()
+		return PatternType{Binding: identifier, Type: type_, Span: recv.span_since(span)}
+	}
+	if identifier == "_" {
+		return PatternWildcard{Span: span}
+	}
+	pattern := PatternVariant{Identifier: identifier, Bindings: []string{}, Span: recv.span_since(span)}
+	if _, is_left_parenthesis := recv.get_current_token().(*token.LeftParenthesis); !is_left_parenthesis {
+		return pattern
+	}
+	recv.increment(1)
+	for {
+		current_token := recv.get_current_token()
+		if _, is_right_parenthesis := current_token.(*token.RightParenthesis); is_right_parenthesis {
+			recv.increment(1)
+			break
+		}
+		binding, is_identifier := current_token.(*token.Identifier)
+		if !is_identifier {
+			panic(fmt.Sprintf("expected identifier in pattern but got %s", token.Describe(current_token)))
+		}
+		pattern.Bindings = append(pattern.Bindings, binding.Name)
+		recv.increment(1)
+		if _, is_comma := recv.get_current_token().(*token.Comma); is_comma {
+			recv.increment(1)
+		}
+	}
+	pattern.Span = recv.span_since(span)
+	return pattern
+}
+
+func (recv *Ast) handle_match_expression() MatchExpression {
+	match := MatchExpression{}
+	match.Span = *recv.get_current_token().GetSpan()
+	recv.open_construct(match.Span, "match")
+	defer recv.close_construct()
+
+	// skipping match keyword
+	recv.increment(1)
+	match.Subject = recv.handle_expression()
+	if _, is_left_curly_brace := recv.get_current_token().(*token.LeftCurlyBrace); !is_left_curly_brace {
+		panic("match body needs to start with {")
+	}
+	recv.increment(1)
+
+	for {
+		recv.skip_new_lines()
+		if _, is_right_curly_brace := recv.get_current_token().(*token.RightCurlyBrace); is_right_curly_brace {
+			recv.increment(1)
+			break
+		}
+		arm := MatchArm{Pattern: recv.handle_pattern()}
+		if _, is_fat_arrow := recv.get_current_token().(*token.FatArrow); !is_fat_arrow {
+			panic(fmt.Sprintf("expected => after match pattern but got %s", token.Describe(recv.get_current_token())))
+		}
+		recv.increment(1)
+		arm.Expression = recv.handle_expression()
+		match.Arms = append(match.Arms, arm)
+		if _, is_comma := recv.get_current_token().(*token.Comma); is_comma {
+			recv.increment(1)
+		}
+	}
+	match.Span = recv.span_since(match.Span)
+	return match
+}
+
 func (recv *Ast) handle_keyword(keyword *token.Keyword) Statement {
 	switch keyword.KeywordVariant {
 	case token.KeywordVariant_Package:
@@ -744,9 +1902,18 @@ func (recv *Ast) handle_keyword(keyword *token.Keyword) Statement {
 	case token.KeywordVariant_Import:
 		return recv.handle_import_statement()
 	case token.KeywordVariant_Const:
+		if recv.next_is_left_parenthesis() {
+			return recv.handle_const_group()
+		}
 		return recv.handle_value_variable_declaration(ValueDeclarationVariant_const)
 	case token.KeywordVariant_Let:
 		return recv.handle_value_variable_declaration(ValueDeclarationVariant_let)
+	case token.KeywordVariant_Using:
+		declaration := recv.handle_value_variable_declaration(ValueDeclarationVariant_using)
+		if declaration.Expression == nil {
+			panic("using declarations must be initialized")
+		}
+		return declaration
 	case token.KeywordVariant_Fn:
 		// functions are expressions
 		return recv.handle_function_declaration()
@@ -758,6 +1925,30 @@ func (recv *Ast) handle_keyword(keyword *token.Keyword) Statement {
 		return recv.handle_loop_statement()
 	case token.KeywordVariant_Break:
 		return recv.handle_break_statement()
+	case token.KeywordVariant_Enum:
+		return recv.handle_enum_declaration()
+	case token.KeywordVariant_Match:
+		return recv.handle_match_expression()
+	case token.KeywordVariant_Interface:
+		return recv.handle_interface_declaration()
+	case token.KeywordVariant_Spawn:
+		recv.open_construct(keyword.Span, "spawn")
+		defer recv.close_construct()
+		recv.increment(1)
+		return SpawnStatement{Expression: recv.handle_expression(), Span: keyword.Span}
+	case token.KeywordVariant_Defer:
+		recv.open_construct(keyword.Span, "defer")
+		defer recv.close_construct()
+		recv.increment(1)
+		return DeferStatement{Expression: recv.handle_expression(), Span: keyword.Span}
+	case token.KeywordVariant_Select:
+		return recv.handle_select_statement()
+	case token.KeywordVariant_Pub:
+		return recv.handle_pub_declaration()
+	case token.KeywordVariant_Init:
+		return recv.handle_init_block()
+	case token.KeywordVariant_Type:
+		return recv.handle_type_declaration()
 	default:
 		panic(fmt.Sprintf("unexpected token.KeywordVariant: %s", keyword.KeywordVariant))
 	}
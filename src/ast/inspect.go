@@ -0,0 +1,99 @@
+package ast
+
+import "fmt"
+
+// Inspect traverses the statement and all statements and expressions
+// nested in it in depth-first order. The children of a statement are
+// only visited if visit returns true for it.
+func Inspect(statement Statement, visit func(Statement) bool) {
+	if statement == nil || !visit(statement) {
+		return
+	}
+	inspectAll := func(statements []Statement) {
+		for _, statement := range statements {
+			Inspect(statement, visit)
+		}
+	}
+	inspectExpressions := func(expressions []Expression) {
+		for _, expression := range expressions {
+			Inspect(expression, visit)
+		}
+	}
+	switch statement := statement.(type) {
+	case ValueDeclaration:
+		if statement.Expression != nil {
+			Inspect(*statement.Expression, visit)
+		}
+	case ConstGroupStatement:
+		for _, declaration := range statement.Declarations {
+			Inspect(declaration, visit)
+		}
+	case InitStatement:
+		Inspect(statement.Body, visit)
+	case FunctionDeclarationStatement:
+		inspectAll(statement.Statements)
+	case ReturnStatement:
+		inspectExpressions(statement.Expressions)
+	case LoopStatement:
+		inspectAll(statement.Statements)
+	case Assignment:
+		Inspect(statement.Expression, visit)
+	case BlockExpression:
+		inspectAll(statement.Statements)
+		if statement.Expression != nil {
+			Inspect(*statement.Expression, visit)
+		}
+	case IfExpression:
+		Inspect(statement.Condition, visit)
+		Inspect(statement.Consequent, visit)
+		if statement.Alternate != nil {
+			Inspect(*statement.Alternate, visit)
+		}
+	case ExpressionLiteral:
+		if literal, isInterpolated := statement.Literal.(InterpolatedStringLiteral); isInterpolated {
+			inspectExpressions(literal.Expressions)
+		}
+	case ExpressionUnary:
+		Inspect(statement.Expression, visit)
+	case ExpressionBinary:
+		Inspect(statement.Left, visit)
+		Inspect(statement.Right, visit)
+	case ExpressionParenthesized:
+		Inspect(statement.Expression, visit)
+	case ExpressionCall:
+		inspectExpressions(statement.Arguments)
+	case ExpressionTry:
+		Inspect(statement.Expression, visit)
+	case ExpressionTypeAssertion:
+		Inspect(statement.Expression, visit)
+	case ExpressionConversion:
+		Inspect(statement.Expression, visit)
+	case MatchExpression:
+		Inspect(statement.Subject, visit)
+		for _, arm := range statement.Arms {
+			Inspect(arm.Expression, visit)
+		}
+	case SpawnStatement:
+		Inspect(statement.Expression, visit)
+	case DeferStatement:
+		Inspect(statement.Expression, visit)
+	case SendStatement:
+		Inspect(statement.Channel, visit)
+		Inspect(statement.Value, visit)
+	case SelectStatement:
+		for _, arm := range statement.Arms {
+			if arm.Channel != nil {
+				Inspect(arm.Channel, visit)
+			}
+			if arm.Value != nil {
+				Inspect(arm.Value, visit)
+			}
+			Inspect(arm.Expression, visit)
+		}
+	case ExpressionIdentifier, ExpressionType, BreakStatement, ImportStatement, PackageStatement,
+		EnumDeclarationStatement, InterfaceDeclarationStatement, TypeDeclarationStatement:
+		// no children
+	default:
+		panic(fmt.Sprintf("unexpected ast.Statement: %#v", statement))
+	}
+}
@@ -2,36 +2,30 @@ package builder
 
 import (
 	"fmt"
+	"path"
 	"simplelang/src/ast"
+	"simplelang/src/check"
+	"simplelang/src/diag"
+	"simplelang/src/gotypes"
+	"simplelang/src/module"
+	"simplelang/src/optimize"
 	"simplelang/src/token"
 	"strings"
 )
 
-func (recv *Builder) add_import_module(name string, path string) {
-	if recv.Imports == nil {
-		recv.Imports = []Import{}
-	}
-	for _, import_ := range recv.Imports {
-		if import_.Path == path && import_.Name == name {
-			// already in here -> return
-			return
-		}
-		if name != "" && import_.Name == name {
-			panic("import redeclared")
+func (recv *Builder) handle_interpolated_string_literal(literal ast.InterpolatedStringLiteral) string {
+	str := recv.importName("fmt") + ".Sprintf("
+	string_arg := `"`
+	for i, part := range literal.StringParts {
+		string_arg += strings.ReplaceAll(part, "%", "%%")
+		if i < len(literal.Formats) {
+			string_arg += literal.Formats[i].GoVerb()
 		}
 	}
-	recv.Imports = append(recv.Imports, Import{Name: name, Path: path})
-}
-
-func (recv *Builder) handle_interpolated_string_literal(literal ast.InterpolatedStringLiteral) string {
-	recv.add_import_module("", "fmt")
-	str := "fmt.Sprintf("
-	// TODO: currently this uses %v, as this is the easiest
-	// should we use %d, %s, if we can infer the type?
-	string_arg := `"` + strings.Join(literal.StringParts, "%v") + `"`
+	string_arg += `"`
 	str += string_arg
-	for _, expression := range literal.Expressions {
-		str += ", " + recv.handleExpression(expression)
+	for _, expression := range recv.handleOperands(literal.Expressions...) {
+		str += ", " + expression
 	}
 	str += ")"
 	return str
@@ -40,7 +34,7 @@ func (recv *Builder) handle_interpolated_string_literal(literal ast.Interpolated
 func (recv *Builder) handleLiteral(literal ast.Literal) string {
 	switch literal := literal.(type) {
 	case ast.FloatLiteral:
-		return fmt.Sprintf("%f", literal.Value)
+		return literal.String()
 	case ast.IntLiteral:
 		return fmt.Sprintf("%d", literal.Value)
 	case ast.InterpolatedStringLiteral:
@@ -54,29 +48,37 @@ func (recv *Builder) handleLiteral(literal ast.Literal) string {
 
 func (recv *Builder) handleExpressionCall(call ast.ExpressionCall) string {
 	identifer := call.Identifier
-	switch identifer {
-	case "print":
-		identifer = "fmt.Println"
-		recv.add_import_module("", "fmt")
-	case "printf":
-		identifer = "fmt.Printf"
-		recv.add_import_module("", "fmt")
-	// this was a simple trick I used before there were binary expressions
-	// I left it in, to show how simple one problem could be solved by using
-	// a different way
-	case "add":
-		return recv.handleExpression(call.Arguments[0]) + " + " + recv.handleExpression(call.Arguments[1])
-	}
-	str := identifer + "("
-	for i, expression := range call.Arguments {
-		if i > 0 {
-			str += ", "
+	if enum, variant, isEnumVariant := recv.lookupEnumVariant(identifer, call.Span); isEnumVariant {
+		if len(call.Arguments) != len(variant.Types) {
+			diagnostic := diag.Errorf(call.Span, "%s takes %d values but got %d", call.Identifier, len(variant.Types), len(call.Arguments))
+			diagnostic.Code = "argument-count"
+			panic(diagnostic)
 		}
-		str += recv.handleExpression(expression)
+		return recv.handleEnumConstructor(enum, variant, call.Arguments)
+	}
+	if conversion, isConversion := recv.conversionCall(call); isConversion {
+		return recv.handleExpressionConversion(conversion)
 	}
+	if builtin, isBuiltin := recv.lookupBuiltin(identifer); isBuiltin {
+		return recv.handleBuiltinCall(builtin, call)
+	}
+	str := recv.goIdentifier(identifer) + "("
+	str += strings.Join(recv.handleOperands(call.Arguments...), ", ")
 	str += ")"
 	return str
 }
+func (recv *Builder) handleExpressionIdentifier(expression ast.ExpressionIdentifier) string {
+	if enum, variant, isEnumVariant := recv.lookupEnumVariant(expression.Identifier, expression.Span); isEnumVariant {
+		if len(variant.Types) > 0 {
+			diagnostic := diag.Errorf(expression.Span, "%s carries %d values and must be called with them", expression.Identifier, len(variant.Types))
+			diagnostic.Code = "argument-count"
+			panic(diagnostic)
+		}
+		return recv.handleEnumConstructor(enum, variant, nil)
+	}
+	return recv.goIdentifier(expression.Identifier)
+}
+
 func (recv *Builder) handleExpressionLiteral(literal ast.ExpressionLiteral) string {
 	return recv.handleLiteral(literal.Literal)
 }
@@ -94,27 +96,52 @@ func (recv *Builder) handleExpressionBinary(expression ast.ExpressionBinary) str
 	str := ""
 	// ** has to be handled differently
 	if expression.Operator == token.OperatorVariant_PowerOf {
-		recv.add_import_module("", "math")
-		str += "math.Pow("
-		str += recv.handleExpression(expression.Left)
-		str += ", "
-		str += recv.handleExpression(expression.Right)
-		str += ")"
-		return str
+		return recv.handlePower(expression)
 	}
+	if expression.Operator == token.OperatorVariant_LogicalAnd || expression.Operator == token.OperatorVariant_LogicalOr {
+		return recv.handleShortCircuit(expression)
+	}
+	operands := recv.handleOperands(expression.Left, expression.Right)
 	// str += "("
-	str += recv.handleExpression(expression.Left)
+	str += operands[0]
 	str += " " + expression.Operator.String() + " "
-	str += recv.handleExpression(expression.Right)
+	str += operands[1]
 	// str += ")"
 
 	return str
 }
+
+// && and || only evaluate their right operand if the left one doesn't
+// decide the result, a right operand with statements hoisted before it,
+// like the early return of a `?`, is lowered to an if, so they only run
+// in this case
+func (recv *Builder) handleShortCircuit(expression ast.ExpressionBinary) string {
+	left := recv.handleExpression(expression.Left)
+	right, hoisted := recv.collectPreStatements(func() string {
+		return recv.handleExpression(expression.Right)
+	})
+	if len(hoisted) == 0 {
+		return left + " " + expression.Operator.String() + " " + right
+	}
+	result := recv.tempName("condition")
+	str := result + " := " + left + "\n"
+	if expression.Operator == token.OperatorVariant_LogicalAnd {
+		str += "if " + result + " {\n"
+	} else {
+		str += "if !" + result + " {\n"
+	}
+	str += strings.Join(hoisted, "")
+	str += result + " = " + right + "\n"
+	str += "}\n"
+	recv.preStatements = append(recv.preStatements, str)
+	return result
+}
+
 func (recv *Builder) handleExpression(expression ast.Expression) string {
 	str := ""
 	switch expression := expression.(type) {
 	case ast.ExpressionIdentifier:
-		str = expression.Identifier
+		str = recv.handleExpressionIdentifier(expression)
 	case ast.ExpressionLiteral:
 		str = recv.handleLiteral(expression.Literal)
 	case ast.ExpressionCall:
@@ -129,17 +156,20 @@ func (recv *Builder) handleExpression(expression ast.Expression) string {
 		str += ")"
 	case ast.BlockExpression:
 		str = "{\n"
-		str += recv.handleStatements(expression.Statements)
-		if expression.Expression != nil {
-			potentialIdentifier, hasIdentifier := recv.identifierStack.peek()
-			if hasIdentifier {
-				str += potentialIdentifier + " = "
-			}
-			str += recv.handleExpression(*expression.Expression)
-		}
+		str += recv.handleBlockBody(expression)
 		str += "\n}"
 	case ast.IfExpression:
 		str += recv.handleIfExpression(expression)
+	case ast.MatchExpression:
+		str += recv.handleMatchExpression(expression)
+	case ast.ExpressionTry:
+		str += recv.handleExpressionTry(expression)
+	case ast.ExpressionTypeAssertion:
+		str += recv.handleExpressionTypeAssertion(expression)
+	case ast.ExpressionConversion:
+		str += recv.handleExpressionConversion(expression)
+	case ast.ExpressionType:
+		str += recv.goType(expression.Type)
 	default:
 		panic(fmt.Sprintf("unexpected ast.Expression: %#v", expression))
 	}
@@ -147,34 +177,86 @@ func (recv *Builder) handleExpression(expression ast.Expression) string {
 }
 
 func (recv *Builder) handleFunctionDeclarationStatement(declaration ast.FunctionDeclarationStatement) string {
-	str := "func " + declaration.Identifier + "("
-	for _, param := range declaration.Parameters {
-		str += param.Name + " " + param.Type + ","
+	return recv.handleFunction(recv.declaredName(declaration.Identifier), declaration)
+}
+
+func (recv *Builder) handleFunction(goName string, declaration ast.FunctionDeclarationStatement) string {
+	recv.currentFunction = &declaration
+	recv.locals = functionLocals(declaration)
+	recv.checkLocalNames(declaration)
+	defer func() {
+		recv.currentFunction = nil
+		recv.locals = nil
+	}()
+
+	str := "func " + goName
+	str += recv.handleSignature(declaration.Parameters, declaration.ReturnTypes) + "{\n"
+	str += recv.handleStatements(declaration.Statements)
+	str += "}"
+	return str
+}
+
+// `(a int, b int) (int, error)`
+func (recv *Builder) handleSignature(parameters []ast.Parameter, returnTypes []string) string {
+	str := "("
+	for _, param := range parameters {
+		str += recv.localName(param.Name) + " " + recv.goType(param.Type) + ","
 	}
+	returnTypes = recv.goTypes(lowerReturnTypes(returnTypes))
 	returnTypesStr := ""
-	if len(declaration.ReturnTypes) > 1 {
+	if len(returnTypes) > 1 {
 		returnTypesStr += "("
 	}
-	for _, returnType := range declaration.ReturnTypes {
-		returnTypesStr += returnType
-	}
-	if len(declaration.ReturnTypes) > 1 {
+	returnTypesStr += strings.Join(returnTypes, ", ")
+	if len(returnTypes) > 1 {
 		returnTypesStr += ")"
 	}
-	str += ")" + returnTypesStr + "{\n"
-	str += recv.handleStatements(declaration.Statements)
+	return str + ")" + returnTypesStr
+}
+
+func (recv *Builder) handleInterfaceDeclaration(declaration ast.InterfaceDeclarationStatement) string {
+	str := "type " + recv.declaredName(declaration.Identifier) + " interface {\n"
+	for _, embedded := range declaration.Embedded {
+		str += recv.goType(embedded) + "\n"
+	}
+	// the method names are kept, since they have to match the methods of go types
+	for _, method := range declaration.Methods {
+		str += method.Identifier + recv.handleSignature(method.Parameters, method.ReturnTypes) + "\n"
+	}
 	str += "}"
 	return str
 }
 
-func (recv *Builder) handleImportStatement(importStatment ast.ImportStatement) {
-	for _, importStatement := range importStatment.Imports {
-		recv.add_import_module(importStatement.Name, importStatement.Path)
+// defined types and aliases are the same in go
+func (recv *Builder) handleTypeDeclaration(declaration ast.TypeDeclarationStatement) string {
+	str := "type " + recv.declaredName(declaration.Identifier)
+	if declaration.Alias {
+		str += " ="
 	}
+	return str + " " + recv.goType(declaration.Type)
+}
+
+func (recv *Builder) handleExpressionTypeAssertion(assertion ast.ExpressionTypeAssertion) string {
+	str := recv.handleExpression(assertion.Expression)
+	switch assertion.Expression.(type) {
+	case ast.ExpressionIdentifier, ast.ExpressionCall, ast.ExpressionParenthesized, ast.ExpressionTypeAssertion:
+	default:
+		str = "(" + str + ")"
+	}
+	return str + ".(" + recv.goType(assertion.Type) + ")"
 }
 
 func (recv *Builder) handleReturnStatement(returnStatement ast.ReturnStatement) string {
-	return "return " + recv.handleExpression(returnStatement.Expression)
+	if len(returnStatement.Expressions) == 1 {
+		if str, isFallible := recv.handleFallibleReturn(returnStatement.Expressions[0]); isFallible {
+			return str
+		}
+	}
+	values := []string{}
+	for _, expression := range returnStatement.Expressions {
+		values = append(values, recv.handleExpression(expression))
+	}
+	return recv.returnValues(values)
 }
 
 func (recv *Builder) handleBlockAssignment(expression ast.Expression) string {
@@ -188,6 +270,8 @@ func isBlockExpression(expression ast.Expression) bool {
 		return true
 	case ast.IfExpression:
 		return true
+	case ast.MatchExpression:
+		return true
 	default:
 		return false
 	}
@@ -197,13 +281,25 @@ func (recv *Builder) handleDeclaration(declaration ast.ValueDeclaration) string
 	str := ""
 	switch declaration.Variant {
 	case ast.ValueDeclarationVariant_const:
-		str += "const"
-	case ast.ValueDeclarationVariant_let:
+		// consts go can't evaluate at compile time are immutable variables
+		if recv.types.IsConstant(recv.file, declaration) {
+			str += "const"
+		} else {
+			str += "var"
+		}
+	case ast.ValueDeclarationVariant_let, ast.ValueDeclarationVariant_using:
 		str += "var"
 	}
-	str += " " + declaration.Identifier
-	if declaration.ExplicitType != nil {
-		str += " " + *declaration.ExplicitType
+	if declaration.Public && recv.currentFunction != nil {
+		panic(diag.Errorf(declaration.Span, "local variable %s can't be pub", declaration.Identifier))
+	}
+	if recv.currentFunction == nil && declaration.Expression != nil && isBlockExpression(*declaration.Expression) {
+		return recv.handlePackageLevelBlockDeclaration(declaration)
+	}
+	str += " " + recv.valueName(declaration)
+	// go can't infer the type of variables assigned by blocks
+	if declaration.ExplicitType != nil || declaration.Expression == nil || isBlockExpression(*declaration.Expression) {
+		str += " " + recv.declarationType(declaration)
 	}
 	if declaration.Expression != nil {
 		if isBlockExpression(*declaration.Expression) {
@@ -212,10 +308,29 @@ func (recv *Builder) handleDeclaration(declaration ast.ValueDeclaration) string
 			str += " = " + recv.handleExpression(*declaration.Expression)
 		}
 	}
+	if declaration.Variant == ast.ValueDeclarationVariant_using {
+		str += "\ndefer " + recv.valueName(declaration) + ".Close()"
+	}
 	return str
 }
+
+// the go type of the variable, which is inferred, if it has no explicit type
+func (recv *Builder) declarationType(declaration ast.ValueDeclaration) string {
+	if declaration.ExplicitType != nil {
+		return recv.goType(*declaration.ExplicitType)
+	}
+	type_ := recv.types.DeclarationType(recv.file, declaration)
+	if type_ == "" {
+		diagnostic := diag.Errorf(declaration.Span, "the type of %s can't be inferred", declaration.Identifier)
+		diagnostic.Code = "missing-type"
+		diagnostic.Notes = []string{"add an explicit type"}
+		panic(diagnostic)
+	}
+	return recv.goType(type_)
+}
+
 func (recv *Builder) handleAssignment(assignment ast.Assignment) string {
-	str := assignment.Identifier
+	str := recv.goIdentifier(assignment.Identifier)
 	if isBlockExpression(assignment.Expression) {
 		str += recv.handleBlockAssignment(assignment.Expression)
 	} else {
@@ -228,38 +343,302 @@ func (recv *Builder) handleIfExpression(ifExpression ast.IfExpression) string {
 	str := "if "
 	str += recv.handleExpression(ifExpression.Condition)
 	str += "{\n"
-	for _, statement := range ifExpression.Consequent.Statements {
-		str += recv.handleStatement(statement)
+	str += recv.handleBlockBody(ifExpression.Consequent)
+	str += "\n}"
+	if ifExpression.Alternate == nil {
+		return str
 	}
-	if ifExpression.Consequent.Expression != nil {
-		potentialIdentifier, hasIdentifier := recv.identifierStack.peek()
-		if hasIdentifier {
-			str += potentialIdentifier + " = "
+	// the statements hoisted before the condition of an else if, like
+	// the early return of a `?`, must only run if it is reached, so they
+	// go into an else block
+	alternate, hoisted := recv.collectPreStatements(func() string {
+		return recv.handleExpression(*ifExpression.Alternate)
+	})
+	if len(hoisted) == 0 {
+		return str + " else " + alternate
+	}
+	return str + " else {\n" + strings.Join(hoisted, "") + alternate + "\n}"
+}
+
+// the statements of the block followed by the assignment of its value
+func (recv *Builder) handleBlockBody(block ast.BlockExpression) string {
+	return recv.scopeUsing(block.Statements, func() string {
+		str := recv.handleStatements(block.Statements)
+		if block.Expression != nil {
+			str += recv.lineDirective(*block.Expression) + recv.withPreStatements(func() string {
+				str := ""
+				potentialIdentifier, hasIdentifier := recv.identifierStack.peek()
+				// nested block expressions assign the identifier themselves
+				if hasIdentifier && !isBlockExpression(*block.Expression) {
+					str += potentialIdentifier + " = "
+				}
+				return str + recv.handleExpression(*block.Expression)
+			})
 		}
-		str += recv.handleExpression(*ifExpression.Consequent.Expression)
+		return str
+	})
+}
+
+func (recv *Builder) handleLoop(loopStatement ast.LoopStatement) string {
+	// the breaks of the loop stay breaks inside of a using closure
+	if closure, isInside := recv.usingClosure(); isInside {
+		closure.loops++
+		defer func() { closure.loops-- }()
 	}
-	str += "\n}"
-	if ifExpression.Alternate != nil {
-		str += " else "
-		str += recv.handleExpression(*ifExpression.Alternate)
+	loop := &loop{}
+	recv.loops = append(recv.loops, loop)
+	body := recv.scopeUsing(loopStatement.Statements, func() string {
+		return recv.handleStatements(loopStatement.Statements)
+	})
+	recv.loops = recv.loops[:len(recv.loops)-1]
+	str := ""
+	if loop.label != "" {
+		str += loop.label + ":\n"
 	}
+	str += "for {" + body + "}"
 	return str
 }
 
-func (recv *Builder) handleLoop(loopStatement ast.LoopStatement) string {
-	str := "for {"
-	str += recv.handleStatements(loopStatement.Statements)
+// a loop being built, a break inside of a switch would only leave the
+// switch in go, so it breaks the label of the loop instead
+type loop struct {
+	// empty, unless one of its breaks needs it, go rejects unused labels
+	label string
+	// the switches and selects between the loop and the statement being
+	// built
+	switches int
+}
+
+// the innermost loop of the function being built
+func (recv *Builder) loop() (*loop, bool) {
+	if len(recv.loops) == 0 {
+		return nil, false
+	}
+	return recv.loops[len(recv.loops)-1], true
+}
+
+// builds the arms of a switch or select, see loop
+func (recv *Builder) insideSwitch(build func() string) string {
+	if loop, isInside := recv.loop(); isInside {
+		loop.switches++
+		defer func() { loop.switches-- }()
+	}
+	return build()
+}
+
+func declaresUsing(statements []ast.Statement) bool {
+	for _, statement := range statements {
+		if declaration, isDeclaration := statement.(ast.ValueDeclaration); isDeclaration && declaration.Variant == ast.ValueDeclarationVariant_using {
+			return true
+		}
+	}
+	return false
+}
+
+// reports whether the statements contain a break of a surrounding loop
+// and whether they contain a return or a `?`
+func earlyExits(statements []ast.Statement) (breaks bool, returns bool) {
+	for _, statement := range statements {
+		ast.Inspect(statement, func(statement ast.Statement) bool {
+			switch statement := statement.(type) {
+			case ast.ReturnStatement, ast.ExpressionTry:
+				returns = true
+			case ast.BreakStatement:
+				breaks = true
+			case ast.LoopStatement:
+				// its breaks end the nested loop
+				_, loopReturns := earlyExits(statement.Statements)
+				returns = returns || loopReturns
+				return false
+			case ast.SpawnStatement, ast.DeferStatement:
+				// these are closures of their own
+				return false
+			}
+			return true
+		})
+	}
+	return breaks, returns
+}
+
+// a block declaring using values, which is wrapped in a closure, see
+// scopeUsing, its breaks and returns return how the closure is left
+type usingClosure struct {
+	// the go types of the function's results, if the block returns
+	results []string
+	// the loops inside of the block, whose breaks stay breaks
+	loops int
+}
+
+// how a using closure is left
+const (
+	exitNormal = "0"
+	exitBreak  = "1"
+	exitReturn = "2"
+)
+
+// `return exit`, followed by the zero values of the results
+func (recv *usingClosure) exit(exit string, results []string) string {
+	if results == nil {
+		for _, type_ := range recv.results {
+			results = append(results, zeroValue(type_))
+		}
+	}
+	return "return " + strings.Join(append([]string{exit}, results...), ", ")
+}
+
+// the innermost using closure of the function being built
+func (recv *Builder) usingClosure() (*usingClosure, bool) {
+	if len(recv.usingClosures) == 0 {
+		return nil, false
+	}
+	return recv.usingClosures[len(recv.usingClosures)-1], true
+}
+
+// go only runs deferred calls when the function returns, so blocks
+// declaring `using` values are wrapped in a closure, to close the values
+// at the end of the block
+//
+// the closure returns how it is left, so breaks and returns inside of it
+// are repeated after it:
+//
+//	if __exit0, __result1 := func() (int, error) {
+//	    ...
+//	    return 0, nil
+//	}(); __exit0 == 1 {
+//	    break
+//	} else if __exit0 == 2 {
+//	    return __result1
+//	}
+//
+// the body of a function is not a block in this sense and doesn't need this
+func (recv *Builder) scopeUsing(statements []ast.Statement, build func() string) string {
+	if !declaresUsing(statements) {
+		return build()
+	}
+	breaks, returns := earlyExits(statements)
+	if !breaks && !returns {
+		return "func() {\n" + build() + "}()"
+	}
+	closure := &usingClosure{}
+	if returns && recv.currentFunction != nil {
+		closure.results = recv.goTypes(lowerReturnTypes(recv.currentFunction.ReturnTypes))
+	}
+	recv.usingClosures = append(recv.usingClosures, closure)
+	body := build()
+	recv.usingClosures = recv.usingClosures[:len(recv.usingClosures)-1]
+
+	exit := recv.tempName("exit")
+	results := []string{}
+	for range closure.results {
+		results = append(results, recv.tempName("result"))
+	}
+	str := "if " + strings.Join(append([]string{exit}, results...), ", ") + " := func() (" + strings.Join(append([]string{"int"}, closure.results...), ", ") + ") {\n"
+	str += body
+	str += "\n" + closure.exit(exitNormal, nil) + "\n"
+	str += "}(); "
+	conditions := []string{}
+	if breaks {
+		conditions = append(conditions, exit+" == "+exitBreak+" {\n"+recv.handleBreak(ast.BreakStatement{})+"\n")
+	}
+	if returns {
+		conditions = append(conditions, exit+" == "+exitReturn+" {\n"+recv.returnValues(results)+"\n")
+	}
+	str += strings.Join(conditions, "} else if ")
 	str += "}"
 	return str
 }
 
+// `return values`, which is returned through the using closure the return
+// is inside of
+func (recv *Builder) returnValues(values []string) string {
+	if closure, isInside := recv.usingClosure(); isInside {
+		return closure.exit(exitReturn, values)
+	}
+	return "return " + strings.Join(values, ", ")
+}
+
 func (recv *Builder) handleBreak(ast.BreakStatement) string {
+	if closure, isInside := recv.usingClosure(); isInside && closure.loops == 0 {
+		return closure.exit(exitBreak, nil)
+	}
+	if loop, isInside := recv.loop(); isInside && loop.switches > 0 {
+		if loop.label == "" {
+			loop.label = recv.tempName("loop")
+		}
+		return "break " + loop.label
+	}
 	return "break"
 }
 
-type Import struct {
-	Name string
-	Path string
+// `func() { ... }()`, the value of the block is discarded
+func (recv *Builder) handleImmediateClosure(block ast.BlockExpression) string {
+	// its returns leave the closure, not the block it is in
+	usingClosures, loops := recv.usingClosures, recv.loops
+	recv.usingClosures, recv.loops = nil, nil
+	defer func() { recv.usingClosures, recv.loops = usingClosures, loops }()
+	str := "func() {\n"
+	str += recv.handleStatements(block.Statements)
+	if block.Expression != nil {
+		str += recv.handleStatements([]ast.Statement{*block.Expression})
+	}
+	str += "}()"
+	return str
+}
+
+func (recv *Builder) handleSpawn(spawn ast.SpawnStatement) string {
+	switch expression := spawn.Expression.(type) {
+	case ast.ExpressionCall:
+		return "go " + recv.handleExpressionCall(expression)
+	case ast.BlockExpression:
+		return "go " + recv.handleImmediateClosure(expression)
+	default:
+		panic(diag.Errorf(expression.Location(), "spawn expects a call or a block"))
+	}
+}
+
+func (recv *Builder) handleDefer(defer_ ast.DeferStatement) string {
+	switch expression := defer_.Expression.(type) {
+	case ast.ExpressionCall:
+		return "defer " + recv.handleExpressionCall(expression)
+	case ast.BlockExpression:
+		return "defer " + recv.handleImmediateClosure(expression)
+	default:
+		panic(diag.Errorf(expression.Location(), "defer expects a call or a block"))
+	}
+}
+
+func (recv *Builder) handleSend(send ast.SendStatement) string {
+	return recv.handleExpression(send.Channel) + " <- " + recv.handleExpression(send.Value)
+}
+
+func (recv *Builder) handleSelect(select_ ast.SelectStatement) string {
+	str := "select {\n"
+	str += recv.insideSwitch(func() string {
+		arms := ""
+		hasDefault := false
+		for _, arm := range select_.Arms {
+			switch arm.Variant {
+			case ast.SelectArmVariant_receive:
+				arms += "case "
+				if arm.Binding != "" {
+					arms += recv.localName(arm.Binding) + " := "
+				}
+				arms += "<-" + recv.handleExpression(arm.Channel) + ":\n"
+			case ast.SelectArmVariant_send:
+				arms += "case " + recv.handleExpression(arm.Channel) + " <- " + recv.handleExpression(arm.Value) + ":\n"
+			case ast.SelectArmVariant_default:
+				if hasDefault {
+					panic(diag.Errorf(select_.Span, "select can only have one default arm"))
+				}
+				hasDefault = true
+				arms += "default:\n"
+			}
+			arms += recv.handleMatchArmExpression(arm.Expression) + "\n"
+		}
+		return arms
+	})
+	str += "}"
+	return str
 }
 
 type identifierStack struct {
@@ -287,39 +666,184 @@ func (recv *identifierStack) peek() (string, bool) {
 	return last, true
 }
 
+type Options struct {
+	// translates snake_case names to go's camelCase, see camelCase
+	GoNames bool
+	// the directory of the simplelang sources relative to the output
+	// directory, line directives pointing at them are only emitted if
+	// it is set, see lineDirective
+	SourceDir string
+	// leaves out the imports the builder added itself, which end up unused,
+	// see pruneImplicitImports
+	PruneImports bool
+	// the declarations of go packages, calls of their functions are only
+	// checked, if it is set
+	GoPackages *gotypes.Loader
+	// folds constants and evaluates pure functions at compile time, see
+	// optimize.Package
+	Optimize bool
+}
+
 type Builder struct {
-	Package         string
-	Imports         []Import
+	Package string
+	Imports []Import
+	// the problems, which don't stop the build
+	Diagnostics []diag.Diagnostic
+	module_     module.Module
+	options     Options
+	// the package level declarations of the package by their simplelang name
+	declarations map[string]declaration
+	// the names declared in the current function, see functionLocals
+	locals map[string]bool
+	// shared by all files of the package, see helpers
+	usedHelpers map[string]bool
+	// the inferred types of the package
+	types check.Info
+	// the path of the file being built, relative to the module's root
+	file            string
 	identifierStack identifierStack
+	enums           map[string]ast.EnumDeclarationStatement
+	functions       map[string]ast.FunctionDeclarationStatement
+	// nil while building the file body
+	currentFunction *ast.FunctionDeclarationStatement
+	// statements that have to be placed before the statement
+	// that is currently being built, see withPreStatements
+	preStatements []string
+	// used to generate unique names for temporary variables
+	tempCounter int
+	// the blocks being built, which are wrapped in closures, see scopeUsing
+	usingClosures []*usingClosure
+	// the loops being built, see loop
+	loops []*loop
+}
+
+// collects the statements hoisted while building a statement,
+// so they can be placed right before it
+func (recv *Builder) withPreStatements(build func() string) string {
+	str, preStatements := recv.collectPreStatements(build)
+	return strings.Join(preStatements, "") + str
+}
+
+// like withPreStatements, but returns the hoisted statements separately
+func (recv *Builder) collectPreStatements(build func() string) (string, []string) {
+	saved := recv.preStatements
+	recv.preStatements = nil
+	str := build()
+	preStatements := recv.preStatements
+	recv.preStatements = saved
+	return str, preStatements
+}
+
+// builds operands, which go evaluates from left to right, statements
+// hoisted by an operand, like the early return of a `?`, would run before
+// the operands on its left, so the ones with side effects are stored in
+// temporaries first:
+//
+//	noisy() + strconv.Itoa(parse(s)?)
+//
+//	__operand0 := noisy()
+//	__value1, __err2 := parse(s)
+//	...
+//	__operand0 + strconv.Itoa(__value1)
+func (recv *Builder) handleOperands(operands ...ast.Expression) []string {
+	built := make([]string, len(operands))
+	hoisted := make([][]string, len(operands))
+	for i, operand := range operands {
+		built[i], hoisted[i] = recv.collectPreStatements(func() string {
+			return recv.handleExpression(operand)
+		})
+	}
+	hoistsAfter := false
+	for i := len(operands) - 1; i >= 0; i-- {
+		if hoistsAfter && hasSideEffects(operands[i]) {
+			temporary := recv.tempName("operand")
+			hoisted[i] = append(hoisted[i], temporary+" := "+built[i]+"\n")
+			built[i] = temporary
+		}
+		hoistsAfter = hoistsAfter || len(hoisted[i]) > 0
+	}
+	for _, statements := range hoisted {
+		recv.preStatements = append(recv.preStatements, statements...)
+	}
+	return built
+}
+
+// whether the expression calls a function or receives from a channel
+func hasSideEffects(expression ast.Expression) bool {
+	found := false
+	ast.Inspect(expression, func(statement ast.Statement) bool {
+		switch statement := statement.(type) {
+		case ast.ExpressionTry:
+			// hoisted itself, only its value is left
+			return false
+		case ast.ExpressionCall:
+			found = true
+		case ast.ExpressionUnary:
+			found = found || statement.Operator == token.OperatorVariant_Arrow
+		}
+		return !found
+	})
+	return found
+}
+
+func (recv *Builder) tempName(prefix string) string {
+	name := fmt.Sprintf("__%s%d", prefix, recv.tempCounter)
+	recv.tempCounter++
+	return name
 }
 
 func (recv *Builder) handleStatement(statement ast.Statement) string {
 	switch statement := statement.(type) {
-	// TODO: should this be moved to BuildProgram?
 	case ast.ImportStatement:
-		recv.handleImportStatement(statement)
-		return ""
+		panic(insideOfFunction("imports", statement.Imports[0].Span))
 	case ast.FunctionDeclarationStatement:
-		panic("FunctionDeclarationStatement is only allowed in file body")
+		panic(insideOfFunction("functions", statement.Span))
 	case ast.ReturnStatement:
 		return recv.handleReturnStatement(statement)
 	case ast.ValueDeclaration:
-		recv.identifierStack.push(statement.Identifier)
+		recv.identifierStack.push(recv.valueName(statement))
 		defer recv.identifierStack.pop()
 		return recv.handleDeclaration(statement)
 	case ast.ExpressionCall:
 		return recv.handleExpressionCall(statement)
+	case ast.ExpressionTry:
+		return recv.handleStatementTry(statement)
+	case ast.ExpressionUnary:
+		return recv.handleExpressionUnary(statement)
+	case ast.SpawnStatement:
+		return recv.handleSpawn(statement)
+	case ast.DeferStatement:
+		return recv.handleDefer(statement)
+	case ast.SendStatement:
+		return recv.handleSend(statement)
+	case ast.SelectStatement:
+		return recv.handleSelect(statement)
+	case ast.BlockExpression:
+		return recv.handleExpression(statement)
 	case ast.ExpressionIdentifier:
-		// TODO: implement
-		panic("not implemented")
+		diagnostic := diag.Errorf(statement.Span, "%s is evaluated but not used", statement.Identifier)
+		diagnostic.Code = "unused-value"
+		panic(diagnostic)
 	case ast.ExpressionLiteral:
 		return recv.handleExpressionLiteral(statement)
 	case ast.Assignment:
-		recv.identifierStack.push(statement.Identifier)
+		recv.identifierStack.push(recv.goIdentifier(statement.Identifier))
 		defer recv.identifierStack.pop()
 		return recv.handleAssignment(statement)
 	case ast.IfExpression:
 		return recv.handleIfExpression(statement)
+	case ast.MatchExpression:
+		return recv.handleMatchExpression(statement)
+	case ast.EnumDeclarationStatement:
+		panic(insideOfFunction("enums", statement.Span))
+	case ast.InitStatement:
+		panic(insideOfFunction("init blocks", statement.Span))
+	case ast.TypeDeclarationStatement:
+		panic(insideOfFunction("type declarations", statement.Span))
+	case ast.ConstGroupStatement:
+		return recv.handleConstGroup(statement)
+	case ast.InterfaceDeclarationStatement:
+		panic(insideOfFunction("interfaces", statement.Span))
 	case ast.LoopStatement:
 		return recv.handleLoop(statement)
 	case ast.BreakStatement:
@@ -332,44 +856,501 @@ func (recv *Builder) handleStatement(statement ast.Statement) string {
 func (recv *Builder) handleStatements(statements []ast.Statement) string {
 	body := ""
 	for _, statement := range statements {
-		body += recv.handleStatement(statement) + "\n"
+		body += recv.lineDirective(statement) + recv.withPreStatements(func() string {
+			return recv.handleStatement(statement)
+		}) + "\n"
 	}
 	return body
 }
 
-func BuildProgram(ast_ ast.Ast) string {
+// builds every file of the package into a go file of the same name,
+// the files share their enums and functions like in go
+func BuildPackage(module_ module.Module, package_ module.Package, options Options) (map[string]string, []diag.Diagnostic) {
+	enums := map[string]ast.EnumDeclarationStatement{}
+	functions := map[string]ast.FunctionDeclarationStatement{}
+	declarations := packageDeclarations(package_, options)
+	types := check.Package(module_, package_, builtinReturnTypes(), options.GoPackages)
+	if options.Optimize {
+		package_ = optimize.Package(package_, types)
+	}
 
-	builder := Builder{}
+	// enums and functions may be used before they are declared
+	for _, file := range package_.Files {
+		module.WithFile(file.Path, func() {
+			for _, statement := range file.Ast.Statements {
+				switch statement := statement.(type) {
+				case ast.EnumDeclarationStatement:
+					if _, exists := enums[statement.Identifier]; exists {
+						panic(diag.Errorf(statement.Span, "enum %s is declared twice", statement.Identifier))
+					}
+					enums[statement.Identifier] = statement
+				case ast.FunctionDeclarationStatement:
+					functions[statement.Identifier] = statement
+				}
+			}
+		})
+	}
+
+	goFiles := map[string]string{}
+	diagnostics := types.Diagnostics
+	usedHelpers := map[string]bool{}
+	for _, file := range package_.Files {
+		builder := Builder{
+			module_:      module_,
+			options:      options,
+			declarations: declarations,
+			usedHelpers:  usedHelpers,
+			types:        types,
+			file:         file.Path,
+			enums:        enums,
+			functions:    functions,
+		}
+		module.WithFile(file.Path, func() {
+			goFiles[strings.TrimSuffix(file.Path, ".sl")+".go"] = builder.buildFile(file.Ast)
+		})
+		diagnostics = append(diagnostics, builder.Diagnostics...)
+	}
+
+	helpersBuilder := Builder{Package: package_.Name, usedHelpers: usedHelpers}
+	if helpersFile := helpersBuilder.buildHelpers(); helpersFile != "" {
+		helpersPath := path.Join(package_.Path, HelpersFile)
+		if _, exists := goFiles[helpersPath]; exists {
+			diagnostic := diag.Errorf(token.Span{}, "%s is reserved for the helper functions of package %q", helpersPath, package_.Path)
+			diagnostic.Notes = []string{"rename the file"}
+			panic(diagnostic.InFile(strings.TrimSuffix(helpersPath, ".go") + ".sl"))
+		}
+		goFiles[helpersPath] = helpersFile
+	}
+	return goFiles, diagnostics
+}
+
+func (recv *Builder) buildFile(ast_ ast.Ast) string {
+	// imports are registered before anything else, so the
+	// builder can reuse them instead of adding its own
+	for _, statement := range ast_.Statements {
+		if statement, isImport := statement.(ast.ImportStatement); isImport {
+			for _, import_ := range statement.Imports {
+				recv.add_import_module(import_)
+			}
+		}
+	}
+	recv.reportUnusedImports(ast_.Statements)
 
 	mainBody := ""
 	for _, statement := range ast_.Statements {
+		mainBody += recv.lineDirective(statement)
 		switch statement := statement.(type) {
 		case ast.PackageStatement:
-			builder.Package = statement.Name
+			recv.Package = statement.Name
+		case ast.ImportStatement:
+			continue
 		case ast.FunctionDeclarationStatement:
-			mainBody += builder.handleFunctionDeclarationStatement(statement)
+			mainBody += recv.handleFunctionDeclarationStatement(statement)
+		case ast.EnumDeclarationStatement:
+			mainBody += recv.handleEnumDeclaration(statement)
+		case ast.InterfaceDeclarationStatement:
+			mainBody += recv.handleInterfaceDeclaration(statement)
+		case ast.TypeDeclarationStatement:
+			mainBody += recv.handleTypeDeclaration(statement)
+		case ast.InitStatement:
+			mainBody += recv.handleInit(statement)
+		case ast.ValueDeclaration, ast.ConstGroupStatement:
+			mainBody += recv.handleStatement(statement)
 		default:
-			mainBody += builder.handleStatement(statement)
+			panicOutsideOfFunction(statement)
 		}
 		mainBody += "\n"
 	}
 
-	importStr := ""
-	if len(builder.Imports) > 0 {
-		importStr = "import ("
-		for _, import_ := range builder.Imports {
-			importStr += "\n\t"
-			if import_.Name != "" {
-				importStr += import_.Name + " "
+	if recv.Package == "" {
+		diagnostic := diag.Errorf(token.Span{}, "package name has not been supplied")
+		diagnostic.Notes = []string{"start the file with a package clause like `package main`"}
+		panic(diagnostic)
+	}
+	return recv.render(mainBody)
+}
+
+// puts the header, package clause and imports in front of the body
+func (recv *Builder) render(body string) string {
+	if recv.options.PruneImports {
+		recv.pruneImplicitImports(body)
+	}
+	importStr := recv.handleImports()
+	packageStr := "package " + recv.Package
+	return fmt.Sprintf("%s\n\n%s\n\n%s\n\n%s\n", GeneratedHeader, packageStr, importStr, body)
+}
+
+func enumVariantTypeName(enum ast.EnumDeclarationStatement, variant ast.EnumVariant) string {
+	return enum.Identifier + "_" + variant.Name
+}
+
+// the fields of pub enums are exported, so other packages can match on them
+func enumPayloadFieldName(enum ast.EnumDeclarationStatement, index int) string {
+	if enum.Public {
+		return fmt.Sprintf("F%d", index)
+	}
+	return fmt.Sprintf("_%d", index)
+}
+
+// resolves identifiers like `Shape.Circle` or `geometry.Shape.Circle`,
+// the identifier of the returned enum is its (qualified) go name
+func (recv *Builder) lookupEnumVariant(identifier string, span token.Span) (ast.EnumDeclarationStatement, ast.EnumVariant, bool) {
+	segments := strings.Split(identifier, ".")
+	var enum ast.EnumDeclarationStatement
+	switch len(segments) {
+	case 2:
+		if recv.locals[segments[0]] {
+			return ast.EnumDeclarationStatement{}, ast.EnumVariant{}, false
+		}
+		localEnum, isEnum := recv.enums[segments[0]]
+		if !isEnum {
+			return ast.EnumDeclarationStatement{}, ast.EnumVariant{}, false
+		}
+		enum = localEnum
+		enum.Identifier = recv.declaredName(enum.Identifier)
+	case 3:
+		package_, isLocalImport := recv.localImport(segments[0])
+		if !isLocalImport {
+			return ast.EnumDeclarationStatement{}, ast.EnumVariant{}, false
+		}
+		importedEnum, isEnum := importedEnum(*package_, segments[1])
+		if !isEnum {
+			return ast.EnumDeclarationStatement{}, ast.EnumVariant{}, false
+		}
+		enum = importedEnum
+		enum.Identifier = segments[0] + "." + recv.importedDeclaration(segments[0], *package_, segments[1]).GoName
+	default:
+		return ast.EnumDeclarationStatement{}, ast.EnumVariant{}, false
+	}
+	variantName := segments[len(segments)-1]
+	for _, variant := range enum.Variants {
+		if variant.Name == variantName {
+			return enum, variant, true
+		}
+	}
+	diagnostic := diag.Errorf(span, "enum %s has no variant %s", strings.Join(segments[:len(segments)-1], "."), variantName)
+	diagnostic.Code = "undefined"
+	panic(diagnostic)
+}
+
+func importedEnum(package_ module.Package, name string) (ast.EnumDeclarationStatement, bool) {
+	for _, file := range package_.Files {
+		for _, statement := range file.Ast.Statements {
+			if enum, isEnum := statement.(ast.EnumDeclarationStatement); isEnum && enum.Identifier == name {
+				return enum, true
+			}
+		}
+	}
+	return ast.EnumDeclarationStatement{}, false
+}
+
+// enums without any payload are lowered to iota constants,
+// all others to a sealed interface with one struct per variant
+func (recv *Builder) handleEnumDeclaration(enum ast.EnumDeclarationStatement) string {
+	enum.Identifier = recv.declaredName(enum.Identifier)
+	str := ""
+	if !enum.HasPayload() {
+		str += "type " + enum.Identifier + " int\n"
+		str += "const (\n"
+		for i, variant := range enum.Variants {
+			str += enumVariantTypeName(enum, variant)
+			if i == 0 {
+				str += " " + enum.Identifier + " = iota"
+			}
+			str += "\n"
+		}
+		str += ")\n"
+		str += "func (recv " + enum.Identifier + ") String() string {\n"
+		str += "switch recv {\n"
+		for _, variant := range enum.Variants {
+			str += "case " + enumVariantTypeName(enum, variant) + ":\n"
+			str += `return "` + variant.Name + `"` + "\n"
+		}
+		str += "}\n"
+		str += `return "` + enum.Identifier + `(?)"` + "\n"
+		str += "}"
+		return str
+	}
+
+	sealingMethod := "is" + enum.Identifier + "()"
+	str += "type " + enum.Identifier + " interface {\n"
+	str += sealingMethod + "\n"
+	str += "}\n"
+	for _, variant := range enum.Variants {
+		typeName := enumVariantTypeName(enum, variant)
+		str += "type " + typeName + " struct {\n"
+		for i, type_ := range variant.Types {
+			str += enumPayloadFieldName(enum, i) + " " + recv.goType(type_) + "\n"
+		}
+		str += "}\n"
+		str += "func (" + typeName + ") " + sealingMethod + " {}\n"
+	}
+	return str
+}
+
+func (recv *Builder) handleEnumConstructor(enum ast.EnumDeclarationStatement, variant ast.EnumVariant, arguments []ast.Expression) string {
+	if !enum.HasPayload() {
+		return enumVariantTypeName(enum, variant)
+	}
+	// keyed, since go vet rejects unkeyed fields of structs from other
+	// packages, and converted to the interface, so `let s = Shape.Rect(1, 2)`
+	// declares a Shape, which can be matched, and not a struct
+	str := enum.Identifier + "(" + enumVariantTypeName(enum, variant) + "{"
+	for i, argument := range recv.handleOperands(arguments...) {
+		if i > 0 {
+			str += ", "
+		}
+		str += enumPayloadFieldName(enum, i) + ": " + argument
+	}
+	str += "})"
+	return str
+}
+
+func isTypeMatch(match ast.MatchExpression) bool {
+	for _, arm := range match.Arms {
+		if _, isType := arm.Pattern.(ast.PatternType); isType {
+			return true
+		}
+	}
+	return false
+}
+
+// lowers
+//
+//	match value {
+//	    n: int => ...
+//	    s: fmt.Stringer => ...
+//	    _ => ...
+//	}
+//
+// to a type switch
+func (recv *Builder) handleTypeMatch(match ast.MatchExpression) string {
+	var wildcard ast.Pattern
+	covered := map[string]ast.Pattern{}
+	needsBinding := false
+	for _, arm := range match.Arms {
+		if wildcard != nil {
+			panicUnreachableArm(arm, wildcard)
+		}
+		switch pattern := arm.Pattern.(type) {
+		case ast.PatternWildcard:
+			wildcard = pattern
+		case ast.PatternType:
+			if existing, isCovered := covered[pattern.Type]; isCovered {
+				panicMatchedTwice(pattern.Type, pattern.Span, existing)
+			}
+			covered[pattern.Type] = pattern
+			if pattern.Binding != "_" {
+				needsBinding = true
 			}
-			importStr += `"` + import_.Path + `"`
+		default:
+			diagnostic := diag.Errorf(pattern.Location(), "enum variants can't be mixed with type patterns")
+			diagnostic.Code = "pattern-mismatch"
+			panic(diagnostic)
 		}
-		importStr += "\n)"
 	}
 
-	if builder.Package == "" {
-		panic("package name has not been supplied")
+	matchVariable := ""
+	str := "switch "
+	if needsBinding {
+		matchVariable = recv.tempName("match")
+		str += matchVariable + " := "
 	}
-	packageStr := "package " + builder.Package
-	return fmt.Sprintf("%s\n\n%s\n\n%s\n", packageStr, importStr, mainBody)
+	str += recv.handleExpression(match.Subject) + ".(type) {\n"
+	str += recv.insideSwitch(func() string {
+		arms := ""
+		for _, arm := range match.Arms {
+			switch pattern := arm.Pattern.(type) {
+			case ast.PatternWildcard:
+				arms += "default:\n"
+			case ast.PatternType:
+				arms += "case " + recv.goType(pattern.Type) + ":\n"
+				if pattern.Binding != "_" {
+					arms += recv.localName(pattern.Binding) + " := " + matchVariable + "\n"
+				}
+			}
+			arms += recv.handleMatchArmExpression(arm.Expression) + "\n"
+		}
+		return arms
+	})
+	str += "}"
+	return str
+}
+
+// emits the value of a match arm, assigning it if the match is used as a value
+func (recv *Builder) handleMatchArmExpression(expression ast.Expression) string {
+	if block, isBlock := expression.(ast.BlockExpression); isBlock {
+		return recv.handleExpression(block)
+	}
+	return recv.withPreStatements(func() string {
+		potentialIdentifier, hasIdentifier := recv.identifierStack.peek()
+		if hasIdentifier && !isBlockExpression(expression) {
+			return potentialIdentifier + " = " + recv.handleExpression(expression)
+		}
+		return recv.handleStatement(expression)
+	})
+}
+
+func panicUnreachableArm(arm ast.MatchArm, wildcard ast.Pattern) {
+	diagnostic := diag.Errorf(arm.Pattern.Location(), "unreachable match arm after wildcard pattern")
+	diagnostic.Code = "unreachable"
+	diagnostic.Secondary = []diag.Label{{Span: wildcard.Location(), Message: "this matches everything"}}
+	panic(diagnostic)
+}
+
+func panicMatchedTwice(what string, span token.Span, existing ast.Pattern) {
+	diagnostic := diag.Errorf(span, "%s is matched twice", what)
+	diagnostic.Code = "unreachable"
+	diagnostic.Secondary = []diag.Label{{Span: existing.Location(), Message: "matched here"}}
+	panic(diagnostic)
+}
+
+func panicBindingCount(pattern ast.PatternVariant, expected int) {
+	diagnostic := diag.Errorf(pattern.Span, "%s has %d values but the pattern binds %d", pattern.Identifier, expected, len(pattern.Bindings))
+	diagnostic.Code = "argument-count"
+	panic(diagnostic)
+}
+
+func (recv *Builder) handleMatchExpression(match ast.MatchExpression) string {
+	// the bindings are declared inside of the arms, one named like the
+	// variable the match assigns would shadow it, so it is assigned
+	// through a pointer instead
+	if target, hasTarget := recv.identifierStack.peek(); hasTarget && recv.bindsName(match, strings.Split(target, ".")[0]) {
+		pointer := recv.tempName("target")
+		recv.identifierStack.push("*" + pointer)
+		defer recv.identifierStack.pop()
+		return pointer + " := &" + target + "\n" + recv.handleMatch(match)
+	}
+	return recv.handleMatch(match)
+}
+
+// whether a pattern of the match binds the go name
+func (recv *Builder) bindsName(match ast.MatchExpression, name string) bool {
+	for _, arm := range match.Arms {
+		bindings := []string{}
+		switch pattern := arm.Pattern.(type) {
+		case ast.PatternVariant:
+			bindings = pattern.Bindings
+		case ast.PatternType:
+			bindings = append(bindings, pattern.Binding)
+		}
+		for _, binding := range bindings {
+			if binding != "_" && recv.localName(binding) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (recv *Builder) handleMatch(match ast.MatchExpression) string {
+	if isFallibleMatch(match) {
+		return recv.handleFallibleMatch(match)
+	}
+	if isTypeMatch(match) {
+		return recv.handleTypeMatch(match)
+	}
+	var enum *ast.EnumDeclarationStatement
+	// the enum as it is written in the patterns, i.e. `geometry.Shape`
+	enumName := ""
+	covered := map[string]ast.Pattern{}
+	var wildcard ast.Pattern
+	needsBinding := false
+	for _, arm := range match.Arms {
+		if wildcard != nil {
+			panicUnreachableArm(arm, wildcard)
+		}
+		switch pattern := arm.Pattern.(type) {
+		case ast.PatternWildcard:
+			wildcard = pattern
+		case ast.PatternVariant:
+			armEnum, variant, isEnumVariant := recv.lookupEnumVariant(pattern.Identifier, pattern.Span)
+			if !isEnumVariant {
+				diagnostic := diag.Errorf(pattern.Span, "%s is not an enum variant", pattern.Identifier)
+				diagnostic.Code = "pattern-mismatch"
+				panic(diagnostic)
+			}
+			armEnumName := strings.TrimSuffix(pattern.Identifier, "."+variant.Name)
+			if enum != nil && enum.Identifier != armEnum.Identifier {
+				diagnostic := diag.Errorf(pattern.Span, "match mixes variants of enum %s and %s", enumName, armEnumName)
+				diagnostic.Code = "pattern-mismatch"
+				panic(diagnostic)
+			}
+			enum, enumName = &armEnum, armEnumName
+			if existing, isCovered := covered[variant.Name]; isCovered {
+				panicMatchedTwice(pattern.Identifier, pattern.Span, existing)
+			}
+			covered[variant.Name] = pattern
+			if len(pattern.Bindings) != len(variant.Types) {
+				panicBindingCount(pattern, len(variant.Types))
+			}
+			for _, binding := range pattern.Bindings {
+				if binding != "_" {
+					needsBinding = true
+				}
+			}
+		default:
+			panic(fmt.Sprintf("unexpected ast.Pattern: %#v", pattern))
+		}
+	}
+	if enum == nil {
+		diagnostic := diag.Errorf(match.Span, "match needs at least one enum variant pattern")
+		diagnostic.Code = "pattern-mismatch"
+		panic(diagnostic)
+	}
+	hasWildcard := wildcard != nil
+	if !hasWildcard {
+		missing := []string{}
+		for _, variant := range enum.Variants {
+			if _, isCovered := covered[variant.Name]; !isCovered {
+				missing = append(missing, enumName+"."+variant.Name)
+			}
+		}
+		if len(missing) > 0 {
+			diagnostic := diag.Errorf(match.Span, "non-exhaustive match on enum %s, missing: %s", enumName, strings.Join(missing, ", "))
+			diagnostic.Code = "non-exhaustive"
+			diagnostic.Notes = []string{"add the missing arms or a `_` arm"}
+			panic(diagnostic)
+		}
+	}
+
+	subject := recv.handleExpression(match.Subject)
+	matchVariable := ""
+	str := "switch "
+	if enum.HasPayload() {
+		if needsBinding {
+			matchVariable = recv.tempName("match")
+			str += matchVariable + " := "
+		}
+		str += subject + ".(type) {\n"
+	} else {
+		str += subject + " {\n"
+	}
+	str += recv.insideSwitch(func() string {
+		arms := ""
+		for _, arm := range match.Arms {
+			switch pattern := arm.Pattern.(type) {
+			case ast.PatternWildcard:
+				arms += "default:\n"
+			case ast.PatternVariant:
+				_, variant, _ := recv.lookupEnumVariant(pattern.Identifier, pattern.Span)
+				arms += "case " + enumVariantTypeName(*enum, variant) + ":\n"
+				for i, binding := range pattern.Bindings {
+					if binding == "_" {
+						continue
+					}
+					arms += recv.localName(binding) + " := " + matchVariable + "." + enumPayloadFieldName(*enum, i) + "\n"
+				}
+			}
+			arms += recv.handleMatchArmExpression(arm.Expression) + "\n"
+		}
+		return arms
+	})
+	if !hasWildcard {
+		// makes the switch a terminating statement for go
+		str += "default:\n"
+		str += `panic("unreachable")` + "\n"
+	}
+	str += "}"
+	return str
 }
@@ -0,0 +1,318 @@
+package builder
+
+import (
+	"fmt"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// a function every simplelang file can call without importing anything,
+// unless it declares a function with the same name
+type builtin struct {
+	Name string
+	// `any` accepts every value, a leading `...` makes the last parameter variadic
+	Parameters []string
+	// the kinds of values `any` parameters accept, like `slice` or `map`,
+	// see valueKind, every value if it is empty
+	Accepts []string
+	// empty if nothing is returned, `Result[T]` and `Option[T]` work with `?` and match
+	ReturnTypes []string
+	// the go packages the lowering uses
+	Imports []string
+	// the helper functions the lowering calls, see helpers
+	Helpers []string
+	Lower   func(call builtinCall) string
+	Doc     string
+}
+
+type builtinCall struct {
+	// the already built arguments
+	Arguments []string
+	// the qualifiers of the builtin's imports by their path
+	Packages map[string]string
+	// the position of the call in the source, like `main.sl:3:5`
+	Position string
+}
+
+func (recv builtinCall) joinedArguments() string {
+	return strings.Join(recv.Arguments, ", ")
+}
+
+func (recv builtin) Signature() string {
+	str := "fn " + recv.Name + "(" + strings.Join(recv.Parameters, ", ") + ")"
+	if len(recv.ReturnTypes) > 0 {
+		str += " " + strings.Join(recv.ReturnTypes, ", ")
+	}
+	return str
+}
+
+var builtins = map[string]builtin{}
+
+func registerBuiltin(builtin builtin) {
+	if _, exists := builtins[builtin.Name]; exists {
+		panic(fmt.Sprintf("builtin %s registered twice", builtin.Name))
+	}
+	builtins[builtin.Name] = builtin
+}
+
+// the builtins ordered by name, for documentation
+func Builtins() []string {
+	names := []string{}
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	docs := []string{}
+	for _, name := range names {
+		docs = append(docs, builtins[name].Signature()+"\n    "+builtins[name].Doc)
+	}
+	return docs
+}
+
+// the prelude
+func init() {
+	registerBuiltin(builtin{
+		Name:       "print",
+		Parameters: []string{"...any"},
+		Imports:    []string{"fmt"},
+		Lower: func(call builtinCall) string {
+			return call.Packages["fmt"] + ".Println(" + call.joinedArguments() + ")"
+		},
+		Doc: "writes the values separated by spaces and a new line to stdout",
+	})
+	registerBuiltin(builtin{
+		Name:       "printf",
+		Parameters: []string{"string", "...any"},
+		Imports:    []string{"fmt"},
+		Lower: func(call builtinCall) string {
+			return call.Packages["fmt"] + ".Printf(" + call.joinedArguments() + ")"
+		},
+		Doc: "writes the values formatted like fmt.Printf to stdout",
+	})
+	registerBuiltin(builtin{
+		Name:       "println",
+		Parameters: []string{"...any"},
+		Imports:    []string{"fmt", "os"},
+		Lower: func(call builtinCall) string {
+			arguments := append([]string{call.Packages["os"] + ".Stderr"}, call.Arguments...)
+			return call.Packages["fmt"] + ".Fprintln(" + strings.Join(arguments, ", ") + ")"
+		},
+		Doc: "writes the values separated by spaces and a new line to stderr",
+	})
+	registerBuiltin(builtin{
+		Name:        "format",
+		Parameters:  []string{"string", "...any"},
+		ReturnTypes: []string{"string"},
+		Imports:     []string{"fmt"},
+		Lower: func(call builtinCall) string {
+			return call.Packages["fmt"] + ".Sprintf(" + call.joinedArguments() + ")"
+		},
+		Doc: "formats the values like fmt.Sprintf",
+	})
+	registerBuiltin(builtin{
+		Name:        "len",
+		Parameters:  []string{"any"},
+		Accepts:     []string{"string", "slice", "map", "channel"},
+		ReturnTypes: []string{"int"},
+		Lower: func(call builtinCall) string {
+			return "len(" + call.joinedArguments() + ")"
+		},
+		Doc: "the length of a string, slice, map or channel",
+	})
+	registerBuiltin(builtin{
+		Name:        "append",
+		Parameters:  []string{"any", "...any"},
+		ReturnTypes: []string{"any"},
+		Lower: func(call builtinCall) string {
+			return "append(" + call.joinedArguments() + ")"
+		},
+		Doc: "the slice with the values appended",
+	})
+	registerBuiltin(builtin{
+		Name:       "panic",
+		Parameters: []string{"any"},
+		Lower: func(call builtinCall) string {
+			return "panic(" + call.joinedArguments() + ")"
+		},
+		Doc: "stops the program with the value as the reason",
+	})
+	registerBuiltin(builtin{
+		Name:       "assert",
+		Parameters: []string{"bool", "...any"},
+		Helpers:    []string{"__assert"},
+		Lower: func(call builtinCall) string {
+			arguments := append([]string{call.Arguments[0], `"` + call.Position + `"`}, call.Arguments[1:]...)
+			return "__assert(" + strings.Join(arguments, ", ") + ")"
+		},
+		Doc: "panics with the position of the assert and the values, if the condition is false",
+	})
+	registerBuiltin(builtin{
+		Name:        "read_line",
+		ReturnTypes: []string{"Result[string]"},
+		Helpers:     []string{"__readLine"},
+		Lower: func(call builtinCall) string {
+			return "__readLine()"
+		},
+		Doc: "reads a line from stdin without the line break, fails at the end of the input",
+	})
+	registerBuiltin(builtin{
+		Name:        "parse_int",
+		Parameters:  []string{"string"},
+		ReturnTypes: []string{"Result[int]"},
+		Imports:     []string{"strconv"},
+		Lower: func(call builtinCall) string {
+			return call.Packages["strconv"] + ".Atoi(" + call.joinedArguments() + ")"
+		},
+		Doc: "parses a decimal integer",
+	})
+	// this was a simple trick I used before there were binary expressions
+	// I left it in, to show how simple one problem could be solved by using
+	// a different way
+	registerBuiltin(builtin{
+		Name:        "add",
+		Parameters:  []string{"any", "any"},
+		ReturnTypes: []string{"any"},
+		Lower: func(call builtinCall) string {
+			return call.Arguments[0] + " + " + call.Arguments[1]
+		},
+		Doc: "the sum of both values, like +",
+	})
+}
+
+// the return types of the builtins by their name, for the type checker
+func builtinReturnTypes() map[string][]string {
+	returnTypes := map[string][]string{}
+	for name, builtin := range builtins {
+		returnTypes[name] = builtin.ReturnTypes
+	}
+	return returnTypes
+}
+
+// returns the builtin the call refers to, declarations of the
+// package and local variables shadow builtins
+func (recv *Builder) lookupBuiltin(identifier string) (builtin, bool) {
+	if recv.locals[identifier] {
+		return builtin{}, false
+	}
+	if _, isDeclared := recv.declarations[identifier]; isDeclared {
+		return builtin{}, false
+	}
+	builtin, isBuiltin := builtins[identifier]
+	return builtin, isBuiltin
+}
+
+// checks the number of arguments and the types of the arguments, whose
+// type is known
+func (recv *Builder) checkBuiltinArguments(builtin builtin, call ast.ExpressionCall) {
+	parameters := builtin.Parameters
+	variadic := ""
+	if len(parameters) > 0 && strings.HasPrefix(parameters[len(parameters)-1], "...") {
+		variadic = strings.TrimPrefix(parameters[len(parameters)-1], "...")
+		parameters = parameters[:len(parameters)-1]
+	}
+	if len(call.Arguments) < len(parameters) || (variadic == "" && len(call.Arguments) > len(parameters)) {
+		expected := fmt.Sprint(len(parameters))
+		if variadic != "" {
+			expected = fmt.Sprintf("at least %d", len(parameters))
+		}
+		diagnostic := diag.Errorf(call.Span, "%s takes %s arguments but got %d", builtin.Name, expected, len(call.Arguments))
+		diagnostic.Code = "argument-count"
+		diagnostic.Notes = []string{builtin.Signature()}
+		panic(diagnostic)
+	}
+	for i, argument := range call.Arguments {
+		parameter := variadic
+		if i < len(parameters) {
+			parameter = parameters[i]
+		}
+		type_ := recv.types.TypeOf(recv.file, argument)
+		// go would pass both values, which isn't what `print(parse_int(s))` means
+		if name, _, isGeneric := splitGenericType(type_); isGeneric && (name == "Result" || name == "Option") {
+			diagnostic := diag.Errorf(argument.Location(), "a %s can't be passed to %s, it is two values in go", name, builtin.Name)
+			diagnostic.Code = "stored-fallible"
+			diagnostic.Primary.Message = "this is " + type_
+			diagnostic.Notes = []string{"match the call or unwrap it with ?, like `" + builtin.Name + "(parse_int(s)?)`"}
+			panic(diagnostic)
+		}
+		if expected, accepts := recv.acceptsArgument(builtin, parameter, type_); !accepts {
+			diagnostic := diag.Errorf(argument.Location(), "argument %d of %s must be %s but got %s", i+1, builtin.Name, expected, strings.TrimPrefix(type_, "untyped "))
+			diagnostic.Code = "type-mismatch"
+			diagnostic.Primary.Message = "this is " + type_
+			diagnostic.Notes = []string{builtin.Signature()}
+			panic(diagnostic)
+		}
+	}
+}
+
+// whether a value of the type can be passed as the parameter and what the
+// parameter expects, values of unknown types are accepted and left to go
+func (recv *Builder) acceptsArgument(builtin builtin, parameter string, type_ string) (string, bool) {
+	if type_ == "" {
+		return "", true
+	}
+	if parameter == "any" {
+		if len(builtin.Accepts) == 0 {
+			return "", true
+		}
+		expected := "a " + builtin.Accepts[0]
+		if len(builtin.Accepts) > 1 {
+			expected = "a " + strings.Join(builtin.Accepts[:len(builtin.Accepts)-1], ", ") + " or " + builtin.Accepts[len(builtin.Accepts)-1]
+		}
+		kind, isKnown := recv.valueKind(type_)
+		return expected, !isKnown || slices.Contains(builtin.Accepts, kind)
+	}
+	if type_ == "untyped int" || type_ == "untyped float" {
+		kind, isKnown := recv.kindOf(parameter)
+		return parameter, !isKnown || kind == "int" || kind == "float"
+	}
+	// a declared type with the same underlying type might be an alias,
+	// which is left to go
+	underlying, isKnown := recv.underlyingType(type_)
+	return parameter, !isKnown || underlying == parameter
+}
+
+// describes the kind of values like builtin.Accepts, false if the type is unknown
+func (recv *Builder) valueKind(type_ string) (string, bool) {
+	for prefix, kind := range map[string]string{"[]": "slice", "map[": "map", "chan ": "channel", "chan<- ": "channel", "<-chan ": "channel", "*": "pointer", "func(": "function"} {
+		if strings.HasPrefix(type_, prefix) {
+			return kind, true
+		}
+	}
+	if type_ == "untyped int" || type_ == "untyped float" {
+		return "number", true
+	}
+	underlying, isKnown := recv.underlyingType(type_)
+	if !isKnown {
+		return "", false
+	}
+	if underlying == "string" || underlying == "bool" || underlying == "interface" {
+		return underlying, true
+	}
+	if strings.HasPrefix(underlying, "[]") {
+		return "slice", true
+	}
+	if _, isBasic := basicTypes[underlying]; isBasic {
+		return "number", true
+	}
+	return "", false
+}
+
+func (recv *Builder) handleBuiltinCall(builtin builtin, call ast.ExpressionCall) string {
+	recv.checkBuiltinArguments(builtin, call)
+	builtinCall := builtinCall{
+		Arguments: []string{},
+		Packages:  map[string]string{},
+		Position:  recv.file + ":" + position(call.Span),
+	}
+	builtinCall.Arguments = append(builtinCall.Arguments, recv.handleOperands(call.Arguments...)...)
+	for _, path := range builtin.Imports {
+		builtinCall.Packages[path] = recv.importName(path)
+	}
+	for _, name := range builtin.Helpers {
+		recv.useHelper(name)
+	}
+	return builtin.Lower(builtinCall)
+}
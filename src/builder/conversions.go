@@ -0,0 +1,230 @@
+package builder
+
+import (
+	"fmt"
+	"math/big"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/token"
+	"strings"
+)
+
+// the predeclared go types, a constant can be converted to, by their kind
+var basicTypes = map[string]string{
+	"bool": "bool", "string": "string",
+	"int": "int", "int8": "int", "int16": "int", "int32": "int", "int64": "int", "rune": "int",
+	"uint": "int", "uint8": "int", "uint16": "int", "uint32": "int", "uint64": "int", "uintptr": "int", "byte": "int",
+	"float32": "float", "float64": "float", "complex64": "float", "complex128": "float",
+}
+
+// the values the integer types can hold, int and uint are assumed to
+// have 64 bits
+var integerRanges = map[string][2]*big.Int{
+	"int": signedRange(64), "int8": signedRange(8), "int16": signedRange(16),
+	"int32": signedRange(32), "rune": signedRange(32), "int64": signedRange(64),
+	"uint": unsignedRange(64), "uint8": unsignedRange(8), "byte": unsignedRange(8),
+	"uint16": unsignedRange(16), "uint32": unsignedRange(32), "uint64": unsignedRange(64),
+	"uintptr": unsignedRange(64),
+}
+
+func signedRange(bits uint) [2]*big.Int {
+	max := new(big.Int).Lsh(big.NewInt(1), bits-1)
+	min := new(big.Int).Neg(max)
+	return [2]*big.Int{min, max.Sub(max, big.NewInt(1))}
+}
+
+func unsignedRange(bits uint) [2]*big.Int {
+	max := new(big.Int).Lsh(big.NewInt(1), bits)
+	return [2]*big.Int{big.NewInt(0), max.Sub(max, big.NewInt(1))}
+}
+
+// looks up the package level declaration of this or an imported simplelang
+// package, an identifier refers to, local names shadow them
+func (recv *Builder) lookupDeclaration(identifier string) (declaration, bool) {
+	segments := strings.Split(identifier, ".")
+	if recv.locals[segments[0]] {
+		return declaration{}, false
+	}
+	switch len(segments) {
+	case 1:
+		declaration, isDeclared := recv.declarations[identifier]
+		return declaration, isDeclared
+	case 2:
+		if package_, isLocalImport := recv.localImport(segments[0]); isLocalImport {
+			return recv.importedDeclaration(segments[0], *package_, segments[1]), true
+		}
+	}
+	return declaration{}, false
+}
+
+// `UserID(5)` is a conversion, if UserID is a type declared in this or an
+// imported simplelang package
+func (recv *Builder) conversionCall(call ast.ExpressionCall) (ast.ExpressionConversion, bool) {
+	declaration, isDeclared := recv.lookupDeclaration(call.Identifier)
+	if !isDeclared || !(declaration.is("type") || declaration.is("interface") || declaration.is("enum")) {
+		return ast.ExpressionConversion{}, false
+	}
+	if len(call.Arguments) != 1 {
+		diagnostic := diag.Errorf(call.Span, "conversion to %s takes exactly one value but got %d", call.Identifier, len(call.Arguments))
+		diagnostic.Code = "argument-count"
+		panic(diagnostic)
+	}
+	return ast.ExpressionConversion{Expression: call.Arguments[0], Type: call.Identifier, Span: call.Span}, true
+}
+
+// resolves declared types to the type they stand for, `interface` for
+// interfaces, false if the type is unknown like the types of go packages
+func (recv *Builder) underlyingType(type_ string) (string, bool) {
+	seen := map[string]bool{}
+	for {
+		if _, isBasic := basicTypes[type_]; isBasic || strings.HasPrefix(type_, "[]") || type_ == "any" || type_ == "error" {
+			return type_, true
+		}
+		declaration, isDeclared := recv.lookupDeclaration(type_)
+		if !isDeclared {
+			return "", false
+		}
+		if declaration.is("interface") {
+			return "interface", true
+		}
+		if !declaration.is("type") || seen[type_] {
+			return "", false
+		}
+		seen[type_] = true
+		// the types of imported packages are named relative to their package
+		if strings.Contains(type_, ".") {
+			_, isBasic := basicTypes[declaration.Type]
+			return declaration.Type, isBasic
+		}
+		type_ = declaration.Type
+	}
+}
+
+// the kind (`int`, `float` or `string`) and value of literals, which
+// may be negated, since they are untyped constants in go, the value of
+// strings is nil
+func constantOf(expression ast.Expression) (string, *big.Float, bool) {
+	switch expression := expression.(type) {
+	case ast.ExpressionLiteral:
+		switch literal := expression.Literal.(type) {
+		case ast.IntLiteral:
+			return "int", new(big.Float).SetInt64(literal.Value), true
+		case ast.FloatLiteral:
+			return "float", big.NewFloat(literal.Value), true
+		case ast.StringLiteral:
+			return "string", nil, true
+		}
+	case ast.ExpressionUnary:
+		kind, value, isConstant := constantOf(expression.Expression)
+		if isConstant && kind != "string" && expression.Operator == token.OperatorVariant_Minus {
+			return kind, value.Neg(value), true
+		}
+	case ast.ExpressionParenthesized:
+		return constantOf(expression.Expression)
+	}
+	return "", nil, false
+}
+
+// conversions of constants and of values, whose type the checker inferred,
+// are checked against the target type, values of unknown types are left
+// to go
+func (recv *Builder) checkConversion(conversion ast.ExpressionConversion) {
+	if declaration, isDeclared := recv.lookupDeclaration(conversion.Type); isDeclared && declaration.is("enum") {
+		diagnostic := diag.Errorf(conversion.Span, "can't convert to %s, its values are created by its variants", declaration.Kind)
+		diagnostic.Code = "conversion"
+		panic(diagnostic)
+	}
+	target, isKnown := recv.underlyingType(conversion.Type)
+	if !isKnown || target == "interface" || target == "any" || target == "error" {
+		return
+	}
+	kind, value, isConstant := constantOf(conversion.Expression)
+	// how the value is described in the error
+	operand := kind + " constant"
+	if !isConstant {
+		type_ := recv.types.TypeOf(recv.file, conversion.Expression)
+		switch type_ {
+		case "untyped int":
+			kind, operand = "int", "int constant"
+		case "untyped float":
+			kind, operand = "float", "float constant"
+		default:
+			underlying, isKnown := recv.underlyingType(type_)
+			if !isKnown {
+				return
+			}
+			kind, operand = basicTypes[underlying], type_
+			if kind == "" {
+				// slices and interfaces
+				kind = underlying
+			}
+		}
+	}
+	illegal := func(hint string) {
+		diagnostic := diag.Errorf(conversion.Span, "can't convert %s to %s", operand, conversion.Type)
+		diagnostic.Code = "conversion"
+		if conversion.Type != target {
+			diagnostic.Message += " (" + target + ")"
+		}
+		if hint != "" {
+			diagnostic.Notes = []string{hint}
+		}
+		panic(diagnostic)
+	}
+	if kind == "interface" || kind == "any" || kind == "error" {
+		illegal("use a type assertion like `x.(" + conversion.Type + ")` to get the value inside of it")
+	}
+	switch basicTypes[target] {
+	case "int":
+		if kind == "string" {
+			illegal("use parse_int to parse it")
+		}
+		if kind != "int" && kind != "float" {
+			illegal("")
+		}
+		if value == nil {
+			return
+		}
+		if !value.IsInt() {
+			illegal("it would be truncated")
+		}
+		integer, _ := value.Int(nil)
+		if bounds := integerRanges[target]; integer.Cmp(bounds[0]) < 0 || integer.Cmp(bounds[1]) > 0 {
+			illegal(fmt.Sprintf("it overflows, %s holds values from %s to %s", target, bounds[0], bounds[1]))
+		}
+	case "float":
+		if kind != "int" && kind != "float" {
+			illegal("")
+		}
+	case "string":
+		switch {
+		case kind == "string", kind == "[]byte", kind == "[]rune":
+		// go vet only accepts runes and bytes, whose value is a character
+		case kind == "int" && (operand == "rune" || operand == "byte" || operand == "int32" || operand == "uint8"):
+		case kind == "int" || kind == "float":
+			illegal("use format to get its digits")
+		default:
+			illegal("")
+		}
+	case "bool":
+		if kind != "bool" {
+			illegal("")
+		}
+	default:
+		// slices, of which only []byte and []rune can be converted to
+		// from strings, other slices are left to go
+		if kind != "string" && !strings.HasPrefix(kind, "[]") || kind == "string" && target != "[]byte" && target != "[]rune" {
+			illegal("")
+		}
+	}
+}
+
+func (recv *Builder) handleExpressionConversion(conversion ast.ExpressionConversion) string {
+	recv.checkConversion(conversion)
+	type_ := recv.goType(conversion.Type)
+	// `*T(x)` would dereference the converted value
+	if strings.HasPrefix(type_, "*") || strings.HasPrefix(type_, "<-") || strings.HasPrefix(type_, "func") {
+		type_ = "(" + type_ + ")"
+	}
+	return type_ + "(" + recv.handleExpression(conversion.Expression) + ")"
+}
@@ -0,0 +1,96 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+)
+
+// the file the helper functions of a package are declared in
+const HelpersFile = "simplelang_helpers.go"
+
+// a go function the generated code calls, which is declared once per
+// package in HelpersFile, if any file of the package uses it
+type helper struct {
+	Name string
+	// the declaration, the builder is only used to import packages
+	Source func(recv *Builder) string
+}
+
+var helpers = map[string]helper{}
+
+func registerHelper(helper helper) {
+	if _, exists := helpers[helper.Name]; exists {
+		panic(fmt.Sprintf("helper %s registered twice", helper.Name))
+	}
+	helpers[helper.Name] = helper
+}
+
+func (recv *Builder) useHelper(name string) {
+	if _, exists := helpers[name]; !exists {
+		panic(fmt.Sprintf("unknown helper %s", name))
+	}
+	recv.usedHelpers[name] = true
+}
+
+// declares the used helpers, the returned file is empty if none are used
+func (recv *Builder) buildHelpers() string {
+	if len(recv.usedHelpers) == 0 {
+		return ""
+	}
+	names := []string{}
+	for name := range recv.usedHelpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	body := ""
+	for _, name := range names {
+		body += helpers[name].Source(recv) + "\n\n"
+	}
+	return recv.render(body)
+}
+
+func init() {
+	registerHelper(helper{
+		Name: "__assert",
+		Source: func(recv *Builder) string {
+			str := "func __assert(condition bool, position string, values ...any) {\n"
+			str += "if !condition {\n"
+			str += `message := "assertion failed at " + position` + "\n"
+			str += "if len(values) > 0 {\n"
+			str += `message += ": " + ` + recv.importName("strings") + ".TrimSuffix(" + recv.importName("fmt") + `.Sprintln(values...), "\n")` + "\n"
+			str += "}\n"
+			str += "panic(message)\n"
+			str += "}\n"
+			str += "}"
+			return str
+		},
+	})
+	registerHelper(helper{
+		Name: "__readLine",
+		Source: func(recv *Builder) string {
+			// reads byte by byte, since a buffered reader would
+			// swallow the input following the line
+			str := "func __readLine() (string, error) {\n"
+			str += "line := []byte{}\n"
+			str += "buffer := make([]byte, 1)\n"
+			str += "for {\n"
+			str += "n, err := " + recv.importName("os") + ".Stdin.Read(buffer)\n"
+			str += "if n == 1 {\n"
+			str += "if buffer[0] == '\\n' {\n"
+			str += "break\n"
+			str += "}\n"
+			str += "line = append(line, buffer[0])\n"
+			str += "}\n"
+			str += "if err != nil {\n"
+			str += "if err == " + recv.importName("io") + ".EOF && len(line) > 0 {\n"
+			str += "break\n"
+			str += "}\n"
+			str += `return "", err` + "\n"
+			str += "}\n"
+			str += "}\n"
+			str += "return " + recv.importName("strings") + `.TrimSuffix(string(line), "\r"), nil` + "\n"
+			str += "}"
+			return str
+		},
+	})
+}
@@ -0,0 +1,219 @@
+package builder
+
+import (
+	"fmt"
+	"regexp"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/token"
+	"strings"
+)
+
+type Import struct {
+	// empty if not renamed, `.` for dot imports and `_` for blank imports
+	Name string
+	Path string
+	// added by the builder, i.e. `fmt` for print
+	Implicit bool
+	// a simplelang package of the same module
+	Local bool
+	// only set for imports written by the user
+	token.Span
+}
+
+// the name the members of the package are accessed by
+func (recv Import) LocalName() string {
+	if recv.Name != "" {
+		return recv.Name
+	}
+	return recv.Path[strings.LastIndex(recv.Path, "/")+1:]
+}
+
+// reports a problem in the source code, which doesn't stop the build
+func (recv *Builder) report(diagnostic diag.Diagnostic) {
+	recv.Diagnostics = append(recv.Diagnostics, diagnostic.InFile(recv.file))
+}
+
+func position(span token.Span) string {
+	return fmt.Sprintf("%d:%d", span.StartRowIndex+1, span.StartColumnIndex+1)
+}
+
+// registers an import written by the user
+func (recv *Builder) add_import_module(import_ ast.Import) {
+	new := Import{Name: import_.Name, Path: import_.Path, Span: import_.Span}
+	if package_, isLocal := recv.module_.Lookup(import_.Path); isLocal {
+		// simplelang packages are imported relative to the output directory
+		new.Path = recv.module_.GoPath(*package_)
+		new.Local = true
+		if new.Name == "" && package_.Name != new.LocalName() {
+			new.Name = package_.Name
+		}
+	}
+	for _, existing := range recv.Imports {
+		if existing.Path == new.Path && existing.Name == new.Name {
+			diagnostic := diag.Errorf(new.Span, "%q has already been imported", new.Path)
+			diagnostic.Code = "duplicate-import"
+			diagnostic.Secondary = []diag.Label{{Span: existing.Span, Message: "imported here"}}
+			diagnostic.Suggestions = []diag.Suggestion{{Label: diag.Label{Span: new.Span, Message: "remove the second import"}}}
+			panic(diagnostic)
+		}
+		if new.Name == "_" || new.Name == "." {
+			continue
+		}
+		if existing.LocalName() == new.LocalName() {
+			diagnostic := diag.Errorf(new.Span, "import %s is redeclared", new.LocalName())
+			diagnostic.Code = "redeclared"
+			diagnostic.Secondary = []diag.Label{{Span: existing.Span, Message: fmt.Sprintf("%s is imported here", existing.LocalName())}}
+			diagnostic.Notes = []string{"one of the imports can be renamed, like `import other \"" + new.Path + "\"`"}
+			panic(diagnostic)
+		}
+		if existing.Path == new.Path && existing.Name != "_" && existing.Name != "." {
+			warning := diag.Warningf(new.Span, "%q is imported twice, as %s and %s", new.Path, existing.LocalName(), new.LocalName())
+			warning.Code = "duplicate-import"
+			warning.Secondary = []diag.Label{{Span: existing.Span, Message: "imported here"}}
+			recv.report(warning)
+		}
+	}
+	recv.Imports = append(recv.Imports, new)
+}
+
+// returns the name, by which the members of the package with the given
+// path can be accessed, the package is imported if the user hasn't already
+func (recv *Builder) importName(path string) string {
+	for _, import_ := range recv.Imports {
+		if import_.Path == path && import_.Name != "_" && import_.Name != "." {
+			return import_.LocalName()
+		}
+	}
+	new := Import{Path: path, Implicit: true}
+	isTaken := func(name string) bool {
+		for _, import_ := range recv.Imports {
+			if import_.LocalName() == name {
+				return true
+			}
+		}
+		return false
+	}
+	for isTaken(new.LocalName()) {
+		new.Name = "_" + new.LocalName()
+	}
+	recv.Imports = append(recv.Imports, new)
+	return new.LocalName()
+}
+
+var qualifierRegexp = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\.`)
+
+// collects the `math` of `math.Abs` in identifiers and types
+func addQualifiers(qualifiers map[string]bool, identifierOrType string) {
+	for _, match := range qualifierRegexp.FindAllStringSubmatch(identifierOrType, -1) {
+		qualifiers[match[1]] = true
+	}
+}
+
+func usedQualifiers(statements []ast.Statement) map[string]bool {
+	qualifiers := map[string]bool{}
+	addParameters := func(parameters []ast.Parameter, returnTypes []string) {
+		for _, parameter := range parameters {
+			addQualifiers(qualifiers, parameter.Type)
+		}
+		for _, returnType := range returnTypes {
+			addQualifiers(qualifiers, returnType)
+		}
+	}
+	for _, statement := range statements {
+		ast.Inspect(statement, func(statement ast.Statement) bool {
+			switch statement := statement.(type) {
+			case ast.ExpressionIdentifier:
+				addQualifiers(qualifiers, statement.Identifier)
+			case ast.ExpressionCall:
+				addQualifiers(qualifiers, statement.Identifier)
+			case ast.ExpressionType:
+				addQualifiers(qualifiers, statement.Type)
+			case ast.ExpressionTypeAssertion:
+				addQualifiers(qualifiers, statement.Type)
+			case ast.ExpressionConversion:
+				addQualifiers(qualifiers, statement.Type)
+			case ast.TypeDeclarationStatement:
+				addQualifiers(qualifiers, statement.Type)
+			case ast.ValueDeclaration:
+				if statement.ExplicitType != nil {
+					addQualifiers(qualifiers, *statement.ExplicitType)
+				}
+			case ast.FunctionDeclarationStatement:
+				addParameters(statement.Parameters, statement.ReturnTypes)
+			case ast.EnumDeclarationStatement:
+				for _, variant := range statement.Variants {
+					for _, type_ := range variant.Types {
+						addQualifiers(qualifiers, type_)
+					}
+				}
+			case ast.InterfaceDeclarationStatement:
+				for _, embedded := range statement.Embedded {
+					addQualifiers(qualifiers, embedded)
+				}
+				for _, method := range statement.Methods {
+					addParameters(method.Parameters, method.ReturnTypes)
+				}
+			case ast.MatchExpression:
+				for _, arm := range statement.Arms {
+					if pattern, isType := arm.Pattern.(ast.PatternType); isType {
+						addQualifiers(qualifiers, pattern.Type)
+					}
+				}
+			}
+			return true
+		})
+	}
+	return qualifiers
+}
+
+// go refuses to compile unused imports, so they are reported
+// before the go compiler has a chance to complain about them
+func (recv *Builder) reportUnusedImports(statements []ast.Statement) {
+	qualifiers := usedQualifiers(statements)
+	for _, import_ := range recv.Imports {
+		// dot imports can't be tracked and blank imports are never used
+		if import_.Name == "." || import_.Name == "_" {
+			continue
+		}
+		if !qualifiers[import_.LocalName()] {
+			diagnostic := diag.Errorf(import_.Span, "%q is imported but not used", import_.Path)
+			diagnostic.Code = "unused-import"
+			diagnostic.Suggestions = []diag.Suggestion{{Label: diag.Label{Span: import_.Span, Message: "remove the import"}}}
+			recv.report(diagnostic)
+		}
+	}
+}
+
+// removes the imports the builder added, which the generated code doesn't
+// use, because the code needing them has been left out, a qualifier in
+// a string or comment keeps the import
+func (recv *Builder) pruneImplicitImports(body string) {
+	imports := []Import{}
+	for _, import_ := range recv.Imports {
+		if import_.Implicit && !regexp.MustCompile(`\b`+regexp.QuoteMeta(import_.LocalName())+`\.`).MatchString(body) {
+			continue
+		}
+		imports = append(imports, import_)
+	}
+	recv.Imports = imports
+}
+
+// marks files the driver may overwrite or remove
+const GeneratedHeader = "// Code generated by simplelang. DO NOT EDIT."
+
+func (recv *Builder) handleImports() string {
+	if len(recv.Imports) == 0 {
+		return ""
+	}
+	str := "import ("
+	for _, import_ := range recv.Imports {
+		str += "\n\t"
+		if import_.Name != "" {
+			str += import_.Name + " "
+		}
+		str += `"` + import_.Path + `"`
+	}
+	str += "\n)"
+	return str
+}
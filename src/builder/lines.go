@@ -0,0 +1,42 @@
+package builder
+
+import (
+	"fmt"
+	"path"
+	"simplelang/src/ast"
+	"simplelang/src/token"
+	"strings"
+)
+
+// the path of the simplelang file being built, as seen from the go file
+// generated for it, since go resolves the file names of line directives
+// relative to the directory of the file containing them
+func (recv *Builder) sourcePath() string {
+	if path.IsAbs(recv.options.SourceDir) {
+		return path.Join(recv.options.SourceDir, recv.file)
+	}
+	return path.Join(strings.Repeat("../", strings.Count(recv.file, "/")), recv.options.SourceDir, recv.file)
+}
+
+// a line directive, which makes go report the code following it at the
+// position of the statement in the simplelang file, so errors of the go
+// tools and stack traces of panics point at the source
+//
+// `//line` has to start a line, but gofmt indents the comments in
+// function bodies, so `/*line */` is used there, which may be anywhere
+func (recv *Builder) lineDirective(statement ast.Statement) string {
+	located, isLocated := statement.(interface{ Location() token.Span })
+	if recv.options.SourceDir == "" || !isLocated {
+		return ""
+	}
+	span := located.Location()
+	if recv.currentFunction == nil {
+		return fmt.Sprintf("//line %s:%d:%d\n", recv.sourcePath(), span.StartRowIndex+1, span.StartColumnIndex+1)
+	}
+	// the position is the one of the space, gofmt puts after the comment
+	column := span.StartColumnIndex
+	if column == 0 {
+		column = 1
+	}
+	return fmt.Sprintf("/*line %s:%d:%d*/ ", recv.sourcePath(), span.StartRowIndex+1, column)
+}
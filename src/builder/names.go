@@ -0,0 +1,430 @@
+package builder
+
+import (
+	"fmt"
+	"regexp"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/module"
+	"simplelang/src/token"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// go exports by capitalization, simplelang by `pub`, so the names of
+// package level declarations are mangled:
+//
+//	pub fn parse_line -> ParseLine
+//	fn ParseLine      -> parseLine
+type declaration struct {
+	// the name in the simplelang source
+	Name   string
+	GoName string
+	Public bool
+	// describes the declaration in error messages, i.e. `pub fn parse_line`
+	Kind string
+	// the type a type declaration stands for, i.e. `int` for `type UserID int`
+	Type string
+	// relative to the module's root
+	File string
+	token.Span
+}
+
+// whether the declaration is of the kind, i.e. `fn` or `type`
+func (recv declaration) is(kind string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(recv.Kind, "pub "), kind+" ")
+}
+
+// `parse_line` -> `ParseLine`
+func exportedName(name string) string {
+	goName := ""
+	for _, part := range strings.Split(name, "_") {
+		first, size := utf8.DecodeRuneInString(part)
+		if size == 0 {
+			continue
+		}
+		goName += string(unicode.ToUpper(first)) + part[size:]
+	}
+	if goName == "" {
+		panic(fmt.Sprintf("%s can't be exported", name))
+	}
+	return goName
+}
+
+// `ParseLine` -> `parseLine`
+func unexportedName(name string) string {
+	first, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(first)) + name[size:]
+}
+
+func newDeclaration(name string, public bool, kind string, file string, span token.Span, options Options) declaration {
+	goName := unexportedName(name)
+	if options.GoNames {
+		goName = camelCase(name, public)
+	} else if public {
+		goName = exportedName(name)
+	}
+	if public {
+		kind = "pub " + kind
+	}
+	return declaration{Name: name, GoName: goName, Public: public, Kind: kind + " " + name, File: file, Span: span}
+}
+
+// the package level declarations of the package by their simplelang name,
+// two declarations ending up with the same go name are reported
+func packageDeclarations(package_ module.Package, options Options) map[string]declaration {
+	declarations := map[string]declaration{}
+	byGoName := map[string]declaration{}
+	add := func(declaration declaration) {
+		if existing, exists := byGoName[declaration.GoName]; exists {
+			diagnostic := diag.Errorf(declaration.Span, "%s and %s are both called %s in go", existing.Kind, declaration.Kind, declaration.GoName)
+			diagnostic.Code = "redeclared"
+			diagnostic.Primary.File = declaration.File
+			diagnostic.Secondary = []diag.Label{{File: existing.File, Span: existing.Span, Message: "also called " + declaration.GoName}}
+			panic(diagnostic)
+		}
+		byGoName[declaration.GoName] = declaration
+	}
+	for _, file := range package_.Files {
+		for _, statement := range file.Ast.Statements {
+			var declaration declaration
+			switch statement := statement.(type) {
+			case ast.FunctionDeclarationStatement:
+				if statement.Identifier == "main" && statement.Public {
+					panic(diag.Errorf(statement.Span, "main can't be pub").InFile(file.Path))
+				}
+				declaration = newDeclaration(statement.Identifier, statement.Public, "fn", file.Path, statement.Span, options)
+			case ast.EnumDeclarationStatement:
+				declaration = newDeclaration(statement.Identifier, statement.Public, "enum", file.Path, statement.Span, options)
+				// the variants are declared next to the enum in go
+				for _, variant := range statement.Variants {
+					add(newVariantDeclaration(declaration, variant))
+				}
+			case ast.InterfaceDeclarationStatement:
+				declaration = newDeclaration(statement.Identifier, statement.Public, "interface", file.Path, statement.Span, options)
+			case ast.TypeDeclarationStatement:
+				declaration = newDeclaration(statement.Identifier, statement.Public, "type", file.Path, statement.Span, options)
+				declaration.Type = statement.Type
+			case ast.ValueDeclaration:
+				kind := "let"
+				if statement.Variant == ast.ValueDeclarationVariant_const {
+					kind = "const"
+				}
+				declaration = newDeclaration(statement.Identifier, statement.Public, kind, file.Path, statement.Span, options)
+			case ast.ConstGroupStatement:
+				for _, constant := range statement.Declarations {
+					declaration := newDeclaration(constant.Identifier, constant.Public, "const", file.Path, constant.Span, options)
+					if existing, exists := declarations[declaration.Name]; exists {
+						panic(declaredAgain(existing, declaration))
+					}
+					declarations[declaration.Name] = declaration
+					add(declaration)
+				}
+				continue
+			default:
+				continue
+			}
+			if existing, exists := declarations[declaration.Name]; exists {
+				panic(declaredAgain(existing, declaration))
+			}
+			declarations[declaration.Name] = declaration
+			add(declaration)
+		}
+	}
+	return declarations
+}
+
+func declaredAgain(existing declaration, declaration declaration) diag.Diagnostic {
+	diagnostic := diag.Errorf(declaration.Span, "%s is declared again", existing.Kind)
+	diagnostic.Code = "redeclared"
+	diagnostic.Primary.File = declaration.File
+	diagnostic.Secondary = []diag.Label{{File: existing.File, Span: existing.Span, Message: "previously declared here"}}
+	return diagnostic
+}
+
+func newVariantDeclaration(enum declaration, variant ast.EnumVariant) declaration {
+	return declaration{
+		Name:   enum.Name + "." + variant.Name,
+		GoName: enum.GoName + "_" + variant.Name,
+		Public: enum.Public,
+		Kind:   "variant " + variant.Name + " of " + enum.Kind,
+		File:   enum.File,
+		Span:   enum.Span,
+	}
+}
+
+// the simplelang package imported as qualifier, like `geometry` in `geometry.hypot`
+func (recv *Builder) localImport(qualifier string) (*module.Package, bool) {
+	for _, import_ := range recv.Imports {
+		if import_.Local && import_.LocalName() == qualifier {
+			for _, package_ := range recv.module_.Packages {
+				if recv.module_.GoPath(*package_) == import_.Path {
+					return package_, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// looks up `name` in the imported package and makes sure it is pub
+func (recv *Builder) importedDeclaration(qualifier string, package_ module.Package, name string) declaration {
+	// the checker reports the uses in expressions, the ones in types are
+	// only found here
+	declaration, exists := packageDeclarations(package_, recv.options)[name]
+	if !exists {
+		diagnostic := diag.Errorf(token.Span{}, "undefined: %s.%s", qualifier, name)
+		diagnostic.Code = "undefined"
+		panic(diagnostic)
+	}
+	if !declaration.Public {
+		diagnostic := diag.Errorf(token.Span{}, "%s.%s can't be used, since %s is not pub", qualifier, name, declaration.Kind)
+		diagnostic.Code = "not-pub"
+		diagnostic.Secondary = []diag.Label{{File: declaration.File, Span: declaration.Span, Message: "declared here without pub"}}
+		panic(diagnostic)
+	}
+	return declaration
+}
+
+// translates a reference to a package level declaration of this or an
+// imported simplelang package to its go name, i.e. `geometry.hypot`
+// to `geometry.Hypot`, everything else is left untouched
+func (recv *Builder) goIdentifier(identifier string) string {
+	segments := strings.Split(identifier, ".")
+	if recv.locals[segments[0]] {
+		segments[0] = recv.localName(segments[0])
+		return strings.Join(segments, ".")
+	}
+	if package_, isLocalImport := recv.localImport(segments[0]); isLocalImport && len(segments) > 1 {
+		segments[1] = recv.importedDeclaration(segments[0], *package_, segments[1]).GoName
+	} else if declaration, isDeclared := recv.declarations[segments[0]]; isDeclared {
+		segments[0] = declaration.GoName
+	}
+	return strings.Join(segments, ".")
+}
+
+// the name a declaration of the file body is declared with in go
+func (recv *Builder) declaredName(name string) string {
+	return recv.declarations[name].GoName
+}
+
+var typeIdentifierRegexp = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?`)
+
+// translates the declared names in a type like `[]geometry.point` to go
+func (recv *Builder) goType(type_ string) string {
+	return typeIdentifierRegexp.ReplaceAllStringFunc(type_, func(identifier string) string {
+		qualifier, name, isQualified := strings.Cut(identifier, ".")
+		if package_, isLocalImport := recv.localImport(qualifier); isLocalImport && isQualified {
+			return qualifier + "." + recv.importedDeclaration(qualifier, *package_, name).GoName
+		}
+		if declaration, isDeclared := recv.declarations[identifier]; isDeclared {
+			return declaration.GoName
+		}
+		return identifier
+	})
+}
+
+// collects the names declared inside of the function, since they shadow
+// package level declarations, this ignores the scope of the local names
+func functionLocals(function ast.FunctionDeclarationStatement) map[string]bool {
+	locals := map[string]bool{}
+	for _, parameter := range function.Parameters {
+		locals[parameter.Name] = true
+	}
+	for _, statement := range function.Statements {
+		ast.Inspect(statement, func(statement ast.Statement) bool {
+			switch statement := statement.(type) {
+			case ast.ValueDeclaration:
+				locals[statement.Identifier] = true
+			case ast.MatchExpression:
+				for _, arm := range statement.Arms {
+					switch pattern := arm.Pattern.(type) {
+					case ast.PatternVariant:
+						for _, binding := range pattern.Bindings {
+							locals[binding] = true
+						}
+					case ast.PatternType:
+						locals[pattern.Binding] = true
+					}
+				}
+			case ast.SelectStatement:
+				for _, arm := range statement.Arms {
+					if arm.Binding != "" {
+						locals[arm.Binding] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+	return locals
+}
+
+func (recv *Builder) goTypes(types []string) []string {
+	goTypes := []string{}
+	for _, type_ := range types {
+		goTypes = append(goTypes, recv.goType(type_))
+	}
+	return goTypes
+}
+
+// variables in the file body are mangled, local ones are kept as they are
+func (recv *Builder) valueName(declaration ast.ValueDeclaration) string {
+	if recv.currentFunction == nil {
+		return recv.declaredName(declaration.Identifier)
+	}
+	return recv.localName(declaration.Identifier)
+}
+
+// initialisms golint expects to be written in a consistent case
+var initialisms = map[string]bool{
+	"API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true, "EOF": true,
+	"GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true,
+	"JSON": true, "LHS": true, "QPS": true, "RAM": true, "RHS": true, "RPC": true,
+	"SLA": true, "SMTP": true, "SQL": true, "SSH": true, "TCP": true, "TLS": true,
+	"TTL": true, "UDP": true, "UI": true, "UID": true, "UUID": true, "URI": true,
+	"URL": true, "UTF8": true, "VM": true, "XML": true, "XMPP": true, "XSRF": true,
+	"XSS": true,
+}
+
+var goKeywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true,
+	"func": true, "go": true, "goto": true, "if": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+}
+
+// `user_id` -> `userID`, `parse_url` -> `ParseURL` if exported,
+// names starting with an underscore are kept, like the go keywords
+// the conversion would produce (`type_`)
+func camelCase(name string, exported bool) string {
+	if strings.HasPrefix(name, "_") {
+		return name
+	}
+	goName := ""
+	for i, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if upper := strings.ToUpper(part); initialisms[upper] {
+			if i == 0 && !exported {
+				goName += strings.ToLower(part)
+			} else {
+				goName += upper
+			}
+			continue
+		}
+		first, size := utf8.DecodeRuneInString(part)
+		if i == 0 && !exported {
+			goName += string(unicode.ToLower(first)) + part[size:]
+		} else {
+			goName += string(unicode.ToUpper(first)) + part[size:]
+		}
+	}
+	if goKeywords[goName] {
+		return name
+	}
+	return goName
+}
+
+// the go name of a parameter, variable or binding of the current function
+func (recv *Builder) localName(name string) string {
+	if !recv.options.GoNames {
+		return name
+	}
+	return camelCase(name, false)
+}
+
+// reports locals, whose names only differ in the case style, and locals,
+// which would shadow a package level declaration or an import in go, that
+// the function uses and which they didn't shadow in simplelang
+func (recv *Builder) checkLocalNames(function ast.FunctionDeclarationStatement) {
+	references := recv.bodyReferences(function)
+	shadowable := map[string]string{}
+	for name, declaration := range recv.declarations {
+		if references[name] {
+			shadowable[declaration.GoName] = declaration.Kind
+		}
+	}
+	for _, import_ := range recv.Imports {
+		if references[import_.LocalName()] {
+			shadowable[import_.LocalName()] = fmt.Sprintf("import %q", import_.Path)
+		}
+	}
+	locals := []string{}
+	for local := range recv.locals {
+		locals = append(locals, local)
+	}
+	// the reported collision doesn't depend on map order
+	sort.Strings(locals)
+	byGoName := map[string]string{}
+	for _, local := range locals {
+		goName := recv.localName(local)
+		if existing, exists := byGoName[goName]; exists {
+			diagnostic := diag.Errorf(function.Span, "%s and %s are both called %s in go inside of fn %s", existing, local, goName, function.Identifier)
+			diagnostic.Code = "redeclared"
+			diagnostic.Notes = []string{"rename one of them"}
+			panic(diagnostic)
+		}
+		byGoName[goName] = local
+		if kind, exists := shadowable[goName]; exists && !references[local] {
+			diagnostic := diag.Errorf(function.Span, "%s would be called %s in go inside of fn %s, which shadows %s used by the function", local, goName, function.Identifier, kind)
+			diagnostic.Code = "redeclared"
+			diagnostic.Notes = []string{"rename " + local}
+			panic(diagnostic)
+		}
+	}
+}
+
+// the names of package level declarations and imports used in the function's
+// body, references to enum variants don't count, since they have their own
+// names in go
+func (recv *Builder) bodyReferences(function ast.FunctionDeclarationStatement) map[string]bool {
+	references := map[string]bool{}
+	addIdentifier := func(identifier string, span token.Span) {
+		if _, _, isEnumVariant := recv.lookupEnumVariant(identifier, span); isEnumVariant {
+			return
+		}
+		first, _, _ := strings.Cut(identifier, ".")
+		references[first] = true
+	}
+	addType := func(type_ string) {
+		for _, identifier := range typeIdentifierRegexp.FindAllString(type_, -1) {
+			first, _, _ := strings.Cut(identifier, ".")
+			references[first] = true
+		}
+	}
+	for _, statement := range function.Statements {
+		ast.Inspect(statement, func(statement ast.Statement) bool {
+			switch statement := statement.(type) {
+			case ast.ExpressionIdentifier:
+				addIdentifier(statement.Identifier, statement.Span)
+			case ast.ExpressionCall:
+				addIdentifier(statement.Identifier, statement.Span)
+			case ast.Assignment:
+				addIdentifier(statement.Identifier, statement.Span)
+			case ast.ExpressionType:
+				addType(statement.Type)
+			case ast.ExpressionTypeAssertion:
+				addType(statement.Type)
+			case ast.ExpressionConversion:
+				addType(statement.Type)
+			case ast.ValueDeclaration:
+				if statement.ExplicitType != nil {
+					addType(*statement.ExplicitType)
+				}
+			case ast.MatchExpression:
+				for _, arm := range statement.Arms {
+					if pattern, isType := arm.Pattern.(ast.PatternType); isType {
+						addType(pattern.Type)
+					}
+				}
+			}
+			return true
+		})
+	}
+	return references
+}
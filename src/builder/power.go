@@ -0,0 +1,86 @@
+package builder
+
+import (
+	"simplelang/src/ast"
+	"simplelang/src/check"
+)
+
+// go has no power operator, so integer constants are folded, other
+// integers are raised by __pow and floats by math.Pow, which takes and
+// returns float64, see check.powerType for the types
+func (recv *Builder) handlePower(expression ast.ExpressionBinary) string {
+	if value, isConstant := check.IntegerConstant(expression); isConstant {
+		if value.Sign() < 0 {
+			return "(" + value.String() + ")"
+		}
+		return value.String()
+	}
+	type_ := recv.types.TypeOf(recv.file, expression)
+	operands := recv.handleOperands(expression.Left, expression.Right)
+	left, right := operands[0], operands[1]
+	if kind, isKnown := recv.kindOf(type_); isKnown && kind == "int" {
+		// untyped bases take the type of the exponent like with other
+		// operators, go would infer them as int
+		if recv.types.TypeOf(recv.file, expression.Left) == "untyped int" {
+			left = recv.goType(type_) + "(" + left + ")"
+		}
+		recv.useHelper("__pow")
+		return "__pow(" + left + ", " + right + ")"
+	}
+	str := recv.importName("math") + ".Pow(" + recv.toFloat64(expression.Left, left) + ", " + recv.toFloat64(expression.Right, right) + ")"
+	if type_ != "float64" && type_ != "" {
+		str = recv.goType(type_) + "(" + str + ")"
+	}
+	return str
+}
+
+// the kind of the type, like in basicTypes
+func (recv *Builder) kindOf(type_ string) (string, bool) {
+	underlying, isKnown := recv.underlyingType(type_)
+	kind, isBasic := basicTypes[underlying]
+	return kind, isKnown && isBasic
+}
+
+// converts the operands of math.Pow, constants and values of unknown types
+// are left to go
+func (recv *Builder) toFloat64(expression ast.Expression, built string) string {
+	switch recv.types.TypeOf(recv.file, expression) {
+	case "float64", "untyped int", "untyped float", "":
+		return built
+	}
+	return "float64(" + built + ")"
+}
+
+func init() {
+	registerHelper(helper{
+		Name: "__pow",
+		Source: func(recv *Builder) string {
+			// squares the base for every bit of the exponent, checking
+			// each multiplication, since go silently wraps around
+			str := "func __pow[T ~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr, E ~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr](base T, exponent E) T {\n"
+			str += "if exponent < 0 {\n"
+			str += `panic("negative exponent")` + "\n"
+			str += "}\n"
+			str += "multiply := func(a T, b T) T {\n"
+			str += "product := a * b\n"
+			str += "if a != 0 && (product/a != b || (a < 0) == (b < 0) && product < 0) {\n"
+			str += `panic("integer overflow")` + "\n"
+			str += "}\n"
+			str += "return product\n"
+			str += "}\n"
+			str += "result := T(1)\n"
+			str += "for exponent > 0 {\n"
+			str += "if exponent&1 == 1 {\n"
+			str += "result = multiply(result, base)\n"
+			str += "}\n"
+			str += "exponent >>= 1\n"
+			str += "if exponent > 0 {\n"
+			str += "base = multiply(base, base)\n"
+			str += "}\n"
+			str += "}\n"
+			str += "return result\n"
+			str += "}"
+			return str
+		},
+	})
+}
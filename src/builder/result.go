@@ -0,0 +1,405 @@
+package builder
+
+import (
+	"fmt"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/token"
+	"strings"
+)
+
+// Result and Option are not real types, they only describe go's
+// `(T, error)` and `(T, bool)` return value pairs:
+//
+//	fn parse(s string) Result[int]   ->   func parse(s string) (int, error)
+//	fn find(s string) Option[int]    ->   func find(s string) (int, bool)
+//
+// `return Ok(x)`, `return Err(e)`, `return Some(x)` and `return None`
+// fill in the second value, `?` returns early if there is no value and
+// `match` can handle both cases.
+
+type FallibleVariant int
+
+const (
+	FallibleVariant_none FallibleVariant = iota
+	FallibleVariant_result
+	FallibleVariant_option
+)
+
+// splits `Result[int]` into `Result` and `int`
+func splitGenericType(type_ string) (string, string, bool) {
+	name, argument, found := strings.Cut(type_, "[")
+	if !found || !strings.HasSuffix(argument, "]") {
+		return type_, "", false
+	}
+	return name, strings.TrimSuffix(argument, "]"), true
+}
+
+func lowerReturnTypes(returnTypes []string) []string {
+	lowered := []string{}
+	for _, returnType := range returnTypes {
+		name, argument, isGeneric := splitGenericType(returnType)
+		switch {
+		case isGeneric && name == "Result":
+			lowered = append(lowered, argument, "error")
+		case isGeneric && name == "Option":
+			lowered = append(lowered, argument, "bool")
+		default:
+			lowered = append(lowered, returnType)
+		}
+	}
+	return lowered
+}
+
+func fallibleVariantOf(returnTypes []string) FallibleVariant {
+	if len(returnTypes) == 0 {
+		return FallibleVariant_none
+	}
+	lastType := returnTypes[len(returnTypes)-1]
+	if name, _, isGeneric := splitGenericType(lastType); isGeneric && name == "Option" {
+		return FallibleVariant_option
+	}
+	lowered := lowerReturnTypes(returnTypes)
+	if lowered[len(lowered)-1] == "error" {
+		return FallibleVariant_result
+	}
+	return FallibleVariant_none
+}
+
+func zeroValue(type_ string) string {
+	switch type_ {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		"float32", "float64", "complex64", "complex128", "byte", "rune":
+		return "0"
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	case "error", "any":
+		return "nil"
+	}
+	for _, prefix := range []string{"*", "[]", "map[", "chan ", "func"} {
+		if strings.HasPrefix(type_, prefix) {
+			return "nil"
+		}
+	}
+	// works for every type, even structs and type parameters
+	return "*new(" + type_ + ")"
+}
+
+// the zero values for all but the last return value of the current function
+func (recv *Builder) leadingZeroValues() []string {
+	returnTypes := lowerReturnTypes(recv.currentFunction.ReturnTypes)
+	zeroValues := []string{}
+	for _, returnType := range returnTypes[:len(returnTypes)-1] {
+		zeroValues = append(zeroValues, zeroValue(recv.goType(returnType)))
+	}
+	return zeroValues
+}
+
+func (recv *Builder) earlyReturn(lastValue string) string {
+	return recv.returnValues(append(recv.leadingZeroValues(), lastValue))
+}
+
+// makes sure the current function is able to pass the missing value on
+func (recv *Builder) expectFallibleFunction(variant FallibleVariant, what string, span token.Span) {
+	if recv.currentFunction == nil {
+		diagnostic := diag.Errorf(span, "%s can only be used inside of a function", what)
+		diagnostic.Code = "fallible-return"
+		panic(diagnostic)
+	}
+	if fallibleVariantOf(recv.currentFunction.ReturnTypes) != variant {
+		expected := "Result or error"
+		if variant == FallibleVariant_option {
+			expected = "Option"
+		}
+		diagnostic := diag.Errorf(span, "%s can only be used in a function returning %s, but %s does not", what, expected, recv.currentFunction.Identifier)
+		diagnostic.Code = "fallible-return"
+		diagnostic.Secondary = []diag.Label{{Span: recv.currentFunction.Span, Message: "the function is declared here"}}
+		panic(diagnostic)
+	}
+}
+
+// returns the variant and the amount of values (without the error
+// or ok value) the expression evaluates to
+//
+// for go functions this can't be known without type information,
+// so they are assumed to return `(T, error)`
+func (recv *Builder) fallibleSignature(expression ast.Expression) (FallibleVariant, int) {
+	if _, isTypeAssertion := expression.(ast.ExpressionTypeAssertion); isTypeAssertion {
+		// `value, ok := x.(T)`
+		return FallibleVariant_option, 1
+	}
+	if call, isCall := expression.(ast.ExpressionCall); isCall {
+		if builtin, isBuiltin := recv.lookupBuiltin(call.Identifier); isBuiltin {
+			variant := fallibleVariantOf(builtin.ReturnTypes)
+			if variant == FallibleVariant_none {
+				diagnostic := diag.Errorf(call.Span, "%s neither returns a Result nor an Option", builtin.Name)
+				diagnostic.Code = "type-mismatch"
+				panic(diagnostic)
+			}
+			return variant, len(lowerReturnTypes(builtin.ReturnTypes)) - 1
+		}
+		if function, isFunction := recv.functions[call.Identifier]; isFunction {
+			variant := fallibleVariantOf(function.ReturnTypes)
+			if variant == FallibleVariant_none {
+				diagnostic := diag.Errorf(call.Span, "%s neither returns a Result, an Option nor an error", function.Identifier)
+				diagnostic.Code = "type-mismatch"
+				declaration := recv.declarations[call.Identifier]
+				diagnostic.Secondary = []diag.Label{{File: declaration.File, Span: declaration.Span, Message: "declared here"}}
+				panic(diagnostic)
+			}
+			return variant, len(lowerReturnTypes(function.ReturnTypes)) - 1
+		}
+	}
+	return FallibleVariant_result, 1
+}
+
+func (recv *Builder) handleExpressionTry(expression ast.ExpressionTry) string {
+	variant, valueCount := recv.fallibleSignature(expression.Expression)
+	if valueCount != 1 {
+		diagnostic := diag.Errorf(expression.Span, "? can only be used as a value on expressions with exactly one value, but got %d", valueCount)
+		diagnostic.Code = "type-mismatch"
+		panic(diagnostic)
+	}
+	recv.expectFallibleFunction(variant, "?", expression.Span)
+	value := recv.tempName("value")
+	operand := recv.handleExpression(expression.Expression)
+	str := ""
+	if variant == FallibleVariant_option {
+		ok := recv.tempName("ok")
+		str += value + ", " + ok + " := " + operand + "\n"
+		str += "if !" + ok + " {\n"
+		str += recv.earlyReturn("false") + "\n"
+		str += "}\n"
+	} else {
+		err := recv.tempName("err")
+		str += value + ", " + err + " := " + operand + "\n"
+		str += "if " + err + " != nil {\n"
+		str += recv.earlyReturn(err) + "\n"
+		str += "}\n"
+	}
+	recv.preStatements = append(recv.preStatements, str)
+	return value
+}
+
+// `?` whose value is discarded, i.e. for functions only returning an error
+func (recv *Builder) handleStatementTry(expression ast.ExpressionTry) string {
+	variant, valueCount := recv.fallibleSignature(expression.Expression)
+	call, isCall := expression.Expression.(ast.ExpressionCall)
+	_, isFunction := recv.functions[call.Identifier]
+	if _, isBuiltin := recv.lookupBuiltin(call.Identifier); isCall && !isFunction && !isBuiltin {
+		// go function, which most likely only returns an error
+		valueCount = 0
+	}
+	recv.expectFallibleFunction(variant, "?", expression.Span)
+	operand := recv.handleExpression(expression.Expression)
+	values := strings.Repeat("_, ", valueCount)
+	if variant == FallibleVariant_option {
+		ok := recv.tempName("ok")
+		str := "if " + values + ok + " := " + operand + "; !" + ok + " {\n"
+		str += recv.earlyReturn("false") + "\n"
+		str += "}"
+		return str
+	}
+	err := recv.tempName("err")
+	str := "if " + values + err + " := " + operand + "; " + err + " != nil {\n"
+	str += recv.earlyReturn(err) + "\n"
+	str += "}"
+	return str
+}
+
+// turns `Err("message")` into an error value
+func (recv *Builder) handleErrorValue(expression ast.Expression) string {
+	if literal, isLiteral := expression.(ast.ExpressionLiteral); isLiteral {
+		switch literal.Literal.(type) {
+		case ast.StringLiteral, ast.InterpolatedStringLiteral:
+			return recv.importName("errors") + ".New(" + recv.handleExpression(expression) + ")"
+		}
+	}
+	return recv.handleExpression(expression)
+}
+
+// handles `return Ok(x)`, `return Err(e)`, `return Some(x)` and `return None`
+func (recv *Builder) handleFallibleReturn(expression ast.Expression) (string, bool) {
+	identifier := ""
+	arguments := []ast.Expression{}
+	span := expression.Location()
+	switch expression := expression.(type) {
+	case ast.ExpressionCall:
+		identifier = expression.Identifier
+		arguments = expression.Arguments
+	case ast.ExpressionIdentifier:
+		identifier = expression.Identifier
+	default:
+		return "", false
+	}
+	if _, isFunction := recv.functions[identifier]; isFunction {
+		return "", false
+	}
+	expectArguments := func(count int) {
+		if len(arguments) != count {
+			diagnostic := diag.Errorf(span, "%s takes %d values but got %d", identifier, count, len(arguments))
+			diagnostic.Code = "argument-count"
+			panic(diagnostic)
+		}
+	}
+	switch identifier {
+	case "Ok":
+		expectArguments(1)
+		recv.expectFallibleFunction(FallibleVariant_result, identifier, span)
+		return recv.returnValues([]string{recv.handleExpression(arguments[0]), "nil"}), true
+	case "Err":
+		expectArguments(1)
+		recv.expectFallibleFunction(FallibleVariant_result, identifier, span)
+		return recv.earlyReturn(recv.handleErrorValue(arguments[0])), true
+	case "Some":
+		expectArguments(1)
+		recv.expectFallibleFunction(FallibleVariant_option, identifier, span)
+		return recv.returnValues([]string{recv.handleExpression(arguments[0]), "true"}), true
+	case "None":
+		expectArguments(0)
+		recv.expectFallibleFunction(FallibleVariant_option, identifier, span)
+		return recv.earlyReturn("false"), true
+	}
+	return "", false
+}
+
+func isFallibleMatch(match ast.MatchExpression) bool {
+	for _, arm := range match.Arms {
+		if pattern, isVariant := arm.Pattern.(ast.PatternVariant); isVariant {
+			switch pattern.Identifier {
+			case "Ok", "Err", "Some", "None":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lowers
+//
+//	match parse(s) {
+//	    Ok(n) => ...
+//	    Err(e) => ...
+//	}
+//
+// to an if else on the error or ok value
+func (recv *Builder) handleFallibleMatch(match ast.MatchExpression) string {
+	arms := map[string]ast.MatchArm{}
+	bindings := map[string]string{}
+	var wildcard *ast.MatchArm
+	variant := FallibleVariant_none
+	for _, arm := range match.Arms {
+		if wildcard != nil {
+			panicUnreachableArm(arm, wildcard.Pattern)
+		}
+		switch pattern := arm.Pattern.(type) {
+		case ast.PatternWildcard:
+			wildcardArm := arm
+			wildcard = &wildcardArm
+		case ast.PatternVariant:
+			armVariant := FallibleVariant_result
+			expectedBindings := 1
+			switch pattern.Identifier {
+			case "Ok":
+				// `Ok` without binding matches functions that only return an error
+				expectedBindings = len(pattern.Bindings)
+			case "Err":
+			case "Some":
+				armVariant = FallibleVariant_option
+			case "None":
+				armVariant = FallibleVariant_option
+				expectedBindings = 0
+			default:
+				diagnostic := diag.Errorf(pattern.Span, "%s can't be mixed with Result or Option patterns", pattern.Identifier)
+				diagnostic.Code = "pattern-mismatch"
+				panic(diagnostic)
+			}
+			if variant != FallibleVariant_none && variant != armVariant {
+				diagnostic := diag.Errorf(pattern.Span, "match mixes Result and Option patterns")
+				diagnostic.Code = "pattern-mismatch"
+				panic(diagnostic)
+			}
+			variant = armVariant
+			if existing, exists := arms[pattern.Identifier]; exists {
+				panicMatchedTwice(pattern.Identifier, pattern.Span, existing.Pattern)
+			}
+			if len(pattern.Bindings) != expectedBindings || len(pattern.Bindings) > 1 {
+				panicBindingCount(pattern, expectedBindings)
+			}
+			arms[pattern.Identifier] = arm
+			if len(pattern.Bindings) == 1 && pattern.Bindings[0] != "_" {
+				bindings[pattern.Identifier] = recv.localName(pattern.Bindings[0])
+			}
+		default:
+			panic(fmt.Sprintf("unexpected ast.Pattern: %#v", pattern))
+		}
+	}
+
+	success, failure := "Ok", "Err"
+	if variant == FallibleVariant_option {
+		success, failure = "Some", "None"
+	}
+	_, hasSuccess := arms[success]
+	_, hasFailure := arms[failure]
+	if wildcard == nil && (!hasSuccess || !hasFailure) {
+		diagnostic := diag.Errorf(match.Span, "non-exhaustive match, %s and %s have to be handled", success, failure)
+		diagnostic.Code = "non-exhaustive"
+		diagnostic.Notes = []string{"add the missing arm or a `_` arm"}
+		panic(diagnostic)
+	}
+	armOrWildcard := func(name string) ast.MatchArm {
+		if arm, exists := arms[name]; exists {
+			return arm
+		}
+		return *wildcard
+	}
+
+	value := "_"
+	if _, bound := bindings[success]; bound {
+		value = recv.tempName("value")
+	}
+	onlyError := false
+	if okArm, exists := arms["Ok"]; exists && len(okArm.Pattern.(ast.PatternVariant).Bindings) == 0 {
+		onlyError = true
+	}
+
+	subject := recv.handleExpression(match.Subject)
+	str := "{\n"
+	condition := ""
+	if variant == FallibleVariant_option {
+		ok := recv.tempName("ok")
+		str += value + ", " + ok + " := " + subject + "\n"
+		condition = "!" + ok
+	} else {
+		err := recv.tempName("err")
+		if onlyError {
+			str += err + " := " + subject + "\n"
+		} else {
+			str += value + ", " + err + " := " + subject + "\n"
+		}
+		condition = err + " != nil"
+		if binding, bound := bindings["Err"]; bound {
+			bindings["Err"] = binding + " := " + err
+		}
+	}
+	if binding, bound := bindings[success]; bound {
+		bindings[success] = binding + " := " + value
+	}
+
+	str += "if " + condition + " {\n"
+	if binding, bound := bindings[failure]; bound {
+		str += binding + "\n"
+	}
+	str += recv.handleMatchArmExpression(armOrWildcard(failure).Expression) + "\n"
+	str += "} else {\n"
+	if binding, bound := bindings[success]; bound {
+		str += binding + "\n"
+	}
+	str += recv.handleMatchArmExpression(armOrWildcard(success).Expression) + "\n"
+	str += "}\n"
+	str += "}"
+	return str
+}
@@ -0,0 +1,80 @@
+package builder
+
+import (
+	"fmt"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/token"
+)
+
+// go only allows declarations in the file body
+func panicOutsideOfFunction(statement ast.Statement) {
+	if expression, isExpression := statement.(ast.Expression); isExpression {
+		diagnostic := diag.Errorf(expression.Location(), "expressions aren't allowed in the file body")
+		diagnostic.Notes = []string{"they can be put into an init {} block"}
+		panic(diagnostic)
+	}
+	panic(fmt.Sprintf("%T isn't allowed in the file body, it can be put into an init {} block", statement))
+}
+
+// go doesn't allow declaring them inside of functions
+func insideOfFunction(what string, span token.Span) diag.Diagnostic {
+	return diag.Errorf(span, "%s are only allowed in the file body", what)
+}
+
+// go doesn't allow statements in the file body, so the value of
+// `let x: T = if ... {}` is computed by a function literal, which
+// keeps go's dependency based order of initializing the variables
+func (recv *Builder) handlePackageLevelBlockDeclaration(declaration ast.ValueDeclaration) string {
+	name := recv.valueName(declaration)
+	// the block is built like the body of a function
+	initializer := ast.FunctionDeclarationStatement{Identifier: declaration.Identifier, Statements: []ast.Statement{*declaration.Expression}, Span: declaration.Span}
+	recv.currentFunction = &initializer
+	recv.locals = functionLocals(initializer)
+	defer func() {
+		recv.currentFunction = nil
+		recv.locals = nil
+	}()
+
+	type_ := recv.declarationType(declaration)
+	str := "var " + name + " " + type_ + " = func() " + type_ + " {\n"
+	str += "var " + name + " " + type_
+	str += recv.handleBlockAssignment(*declaration.Expression) + "\n"
+	str += "return " + name + "\n"
+	str += "}()"
+	return str
+}
+
+// `const (...)`, where iota works like in go
+func (recv *Builder) handleConstGroup(group ast.ConstGroupStatement) string {
+	str := "const (\n"
+	for _, declaration := range group.Declarations {
+		if declaration.Public && recv.currentFunction != nil {
+			panic(diag.Errorf(declaration.Span, "local constant %s can't be pub", declaration.Identifier))
+		}
+		str += recv.valueName(declaration)
+		if declaration.ExplicitType != nil {
+			str += " " + recv.goType(*declaration.ExplicitType)
+		}
+		if declaration.Expression != nil {
+			if isBlockExpression(*declaration.Expression) {
+				diagnostic := diag.Errorf((*declaration.Expression).Location(), "%s must be initialized with a constant expression", declaration.Identifier)
+				diagnostic.Primary.Message = "this block is run at runtime"
+				panic(diagnostic)
+			}
+			str += " = " + recv.handleExpression(*declaration.Expression)
+		}
+		str += "\n"
+	}
+	str += ")"
+	return str
+}
+
+// `init { ... }`, go allows any number of init functions per package
+func (recv *Builder) handleInit(init ast.InitStatement) string {
+	statements := append([]ast.Statement{}, init.Body.Statements...)
+	if init.Body.Expression != nil {
+		statements = append(statements, *init.Body.Expression)
+	}
+	return recv.handleFunction("init", ast.FunctionDeclarationStatement{Identifier: "init", Statements: statements, Span: init.Span})
+}
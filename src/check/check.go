@@ -0,0 +1,505 @@
+// Package check infers the types of simplelang expressions, so the builder
+// can declare variables, whose value is computed by a block, `if` or `match`,
+// without an explicit type.
+//
+// Types are written like in simplelang, i.e. `[]int`, `geometry.Step` or
+// `Result[string]`. The declarations of go packages are read from their
+// export data, see gotypes, calls of their functions are checked against
+// their signatures. Values of types, which can't be written in the file,
+// and of packages, which aren't available, have the unknown type "".
+package check
+
+import (
+	"fmt"
+	"go/types"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/gotypes"
+	"simplelang/src/module"
+	"simplelang/src/token"
+	"strings"
+)
+
+// the result of checking a package
+type Info struct {
+	Resolution Resolution
+	// the problems, which don't stop the build, like unreachable code or
+	// unused variables, which go would report as well
+	Diagnostics  []diag.Diagnostic
+	types        map[key]string
+	declarations map[key]string
+	constants    map[key]bool
+	// the go packages each file imports by their qualifier
+	goImports map[string]map[string]*types.Package
+}
+
+// spans are only unique inside of a file
+type key struct {
+	File string
+	token.Span
+}
+
+// the type of the expression, "" if it is unknown or the expression has no value
+func (recv Info) TypeOf(file string, expression ast.Expression) string {
+	return recv.types[key{File: file, Span: expression.Location()}]
+}
+
+// the type of the variable, which is either the explicit type, the type of
+// the value or the type of the first value assigned to it
+func (recv Info) DeclarationType(file string, declaration ast.ValueDeclaration) string {
+	return recv.declarations[key{File: file, Span: declaration.Span}]
+}
+
+// whether go can evaluate the value of the const at compile time, the
+// other consts are immutable variables
+func (recv Info) IsConstant(file string, declaration ast.ValueDeclaration) bool {
+	return recv.constants[key{File: file, Span: declaration.Span}]
+}
+
+// a package level declaration
+type declaration struct {
+	// fn, enum, interface, type, let or const
+	Kind     string
+	File     string
+	Function ast.FunctionDeclarationStatement
+	Enum     ast.EnumDeclarationStatement
+	Value    ast.ValueDeclaration
+	// the type of values, inferred when it is first needed, or the type
+	// a type declaration stands for
+	Type string
+	// whether the value is a go constant
+	constant bool
+	// set for the entries of const groups
+	grouped  bool
+	resolved bool
+	// set while the value is inferred, since it may refer to itself
+	resolving bool
+}
+
+type variable struct {
+	Type string
+	// set for consts, which can't be assigned
+	const_ *ast.ValueDeclaration
+	// whether the value is a go constant
+	constant bool
+	// set for `let x` without a type or value, until x is assigned
+	pending *ast.ValueDeclaration
+	file    string
+}
+
+type scope struct {
+	parent    *scope
+	variables map[string]*variable
+}
+
+func (recv *scope) lookup(name string) (*variable, bool) {
+	for scope := recv; scope != nil; scope = scope.parent {
+		if variable, exists := scope.variables[name]; exists {
+			return variable, true
+		}
+	}
+	return nil, false
+}
+
+type checker struct {
+	module_  module.Module
+	package_ module.Package
+	// the return types of the builtin functions by their name
+	builtins     map[string][]string
+	declarations map[string]*declaration
+	// the simplelang packages imported by the current file by their qualifier
+	imports map[string]*checker
+	// the checkers of imported packages by their path, shared by all checkers
+	checkers map[string]*checker
+	// nil if the declarations of go packages aren't loaded
+	goPackages *gotypes.Loader
+	// the go packages imported by the current file by their qualifier
+	goImports map[string]*types.Package
+	// the qualifiers of goImports by the path of the package
+	goQualifiers map[string]string
+	file         string
+	scope        *scope
+	info         Info
+}
+
+// infers the types of the package, builtins are the return types of the
+// functions, which can be called without importing anything, goPackages
+// may be nil, then the go packages are unknown
+func Package(module_ module.Module, package_ module.Package, builtins map[string][]string, goPackages *gotypes.Loader) Info {
+	resolution := Resolve(module_, package_, builtins)
+	checker := newChecker(module_, package_, builtins, goPackages, map[string]*checker{})
+	checker.info.Resolution = resolution
+	for _, file := range package_.Files {
+		module.WithFile(file.Path, func() {
+			checker.checkFile(file)
+			checker.checkUnused(resolution.Files[file.Path])
+		})
+	}
+	return checker.info
+}
+
+// records a problem of the current file, which doesn't stop the build
+func (recv *checker) report(diagnostic diag.Diagnostic) {
+	recv.info.Diagnostics = append(recv.info.Diagnostics, diagnostic.InFile(recv.file))
+}
+
+func newChecker(module_ module.Module, package_ module.Package, builtins map[string][]string, goPackages *gotypes.Loader, checkers map[string]*checker) *checker {
+	checker := &checker{
+		module_:      module_,
+		package_:     package_,
+		builtins:     builtins,
+		declarations: map[string]*declaration{},
+		checkers:     checkers,
+		goPackages:   goPackages,
+		info: Info{
+			types:        map[key]string{},
+			declarations: map[key]string{},
+			constants:    map[key]bool{},
+			goImports:    map[string]map[string]*types.Package{},
+		},
+	}
+	checkers[package_.Path] = checker
+	for _, file := range package_.Files {
+		for _, statement := range file.Ast.Statements {
+			switch statement := statement.(type) {
+			case ast.FunctionDeclarationStatement:
+				checker.declarations[statement.Identifier] = &declaration{Kind: "fn", File: file.Path, Function: statement}
+			case ast.EnumDeclarationStatement:
+				checker.declarations[statement.Identifier] = &declaration{Kind: "enum", File: file.Path, Enum: statement}
+			case ast.InterfaceDeclarationStatement:
+				checker.declarations[statement.Identifier] = &declaration{Kind: "interface", File: file.Path}
+			case ast.TypeDeclarationStatement:
+				checker.declarations[statement.Identifier] = &declaration{Kind: "type", File: file.Path, Type: statement.Type}
+			case ast.ValueDeclaration:
+				checker.declarations[statement.Identifier] = &declaration{Kind: valueKind(statement), File: file.Path, Value: statement}
+			case ast.ConstGroupStatement:
+				// entries without a value repeat the type of the previous one
+				previous := ""
+				for _, constant := range statement.Declarations {
+					declaration := &declaration{Kind: "const", File: file.Path, Value: constant, grouped: true}
+					if constant.Expression == nil {
+						declaration.Type, declaration.constant, declaration.resolved = previous, true, true
+						if constant.ExplicitType != nil {
+							declaration.Type = *constant.ExplicitType
+						}
+					}
+					checker.declarations[constant.Identifier] = declaration
+					previous = declaration.Type
+				}
+			}
+		}
+	}
+	return checker
+}
+
+func valueKind(declaration ast.ValueDeclaration) string {
+	if declaration.Variant == ast.ValueDeclarationVariant_const {
+		return "const"
+	}
+	return "let"
+}
+
+// the checker of the simplelang package, which is imported by `qualifier`
+func (recv *checker) importedChecker(qualifier string) (*checker, bool) {
+	checker, isImported := recv.imports[qualifier]
+	return checker, isImported
+}
+
+// sets the file, whose imports are used to resolve qualified names
+func (recv *checker) enterFile(file string) func() {
+	previousFile, previousImports := recv.file, recv.imports
+	previousGoImports, previousGoQualifiers := recv.goImports, recv.goQualifiers
+	recv.file = file
+	recv.imports = map[string]*checker{}
+	goImports := []ast.Import{}
+	for _, file_ := range recv.package_.Files {
+		if file_.Path != file {
+			continue
+		}
+		for _, statement := range file_.Ast.Statements {
+			statement, isImport := statement.(ast.ImportStatement)
+			if !isImport {
+				continue
+			}
+			for _, import_ := range statement.Imports {
+				if import_.Name == "." || import_.Name == "_" {
+					continue
+				}
+				package_, isLocal := recv.module_.Lookup(import_.Path)
+				if !isLocal {
+					goImports = append(goImports, import_)
+					continue
+				}
+				qualifier := import_.Name
+				if qualifier == "" {
+					qualifier = import_.Path[strings.LastIndex(import_.Path, "/")+1:]
+				}
+				checker, exists := recv.checkers[package_.Path]
+				if !exists {
+					checker = newChecker(recv.module_, *package_, recv.builtins, recv.goPackages, recv.checkers)
+				}
+				recv.imports[qualifier] = checker
+			}
+		}
+	}
+	recv.importGoPackages(goImports)
+	return func() {
+		recv.file, recv.imports = previousFile, previousImports
+		recv.goImports, recv.goQualifiers = previousGoImports, previousGoQualifiers
+	}
+}
+
+func (recv *checker) checkFile(file module.File) {
+	defer recv.enterFile(file.Path)()
+	for _, statement := range file.Ast.Statements {
+		switch statement := statement.(type) {
+		case ast.FunctionDeclarationStatement:
+			recv.checkFunction(statement.Parameters, statement.Statements)
+			recv.checkFlow(statement)
+		case ast.InitStatement:
+			recv.checkFunction(nil, []ast.Statement{statement.Body})
+			recv.checkFlow(ast.FunctionDeclarationStatement{Identifier: "init", Statements: []ast.Statement{statement.Body}, Span: statement.Span})
+		case ast.ValueDeclaration:
+			recv.resolve(recv.declarations[statement.Identifier])
+			if statement.Expression != nil {
+				recv.checkValueFlow(*statement.Expression)
+			}
+		case ast.ConstGroupStatement:
+			for _, constant := range statement.Declarations {
+				recv.resolve(recv.declarations[constant.Identifier])
+			}
+		}
+	}
+}
+
+// infers the type of a package level value
+func (recv *checker) resolve(declaration *declaration) string {
+	if declaration.resolved || declaration.resolving {
+		return declaration.Type
+	}
+	declaration.resolving = true
+	defer recv.enterFile(declaration.File)()
+	scope := recv.scope
+	recv.scope = nil
+	declaration.Type, declaration.constant = recv.valueType(declaration.Value)
+	if declaration.grouped && !declaration.constant {
+		panicNotConstant(declaration.Value)
+	}
+	recv.scope = scope
+	declaration.resolving, declaration.resolved = false, true
+	return declaration.Type
+}
+
+// the type of a declared value, which is recorded for the builder, and
+// whether it is a go constant
+func (recv *checker) valueType(declaration ast.ValueDeclaration) (string, bool) {
+	type_ := ""
+	if declaration.Expression != nil {
+		type_ = recv.typeOf(*declaration.Expression)
+	}
+	if declaration.ExplicitType != nil {
+		type_ = *declaration.ExplicitType
+	}
+	span := declaration.Span
+	if declaration.Expression != nil {
+		span = (*declaration.Expression).Location()
+	}
+	checkStorable(type_, span)
+	// constants keep being untyped like in go
+	if declaration.Variant != ast.ValueDeclarationVariant_const {
+		type_ = defaultType(type_)
+	}
+	recv.info.declarations[key{File: recv.file, Span: declaration.Span}] = defaultType(type_)
+	constant := false
+	if declaration.Variant == ast.ValueDeclarationVariant_const && declaration.Expression != nil {
+		constant = recv.isConstant(*declaration.Expression)
+		recv.info.constants[key{File: recv.file, Span: declaration.Span}] = constant
+	}
+	return type_, constant
+}
+
+// Result[T] and Option[T] are lowered to the two values go returns, which
+// a single variable can't hold
+func checkStorable(type_ string, span token.Span) {
+	if fallibleValue(type_) == "" {
+		return
+	}
+	name, _, _ := strings.Cut(type_, "[")
+	diagnostic := diag.Errorf(span, "a %s can't be stored in a variable, it is two values in go", name)
+	diagnostic.Code = "stored-fallible"
+	diagnostic.Primary.Message = "this is " + type_
+	diagnostic.Notes = []string{"match the call directly or unwrap it with ?, like `let n = strconv.Atoi(s)?`"}
+	panic(diagnostic)
+}
+
+// the block of a spawn or defer is a function of its own in go, a return or `?`
+// inside of it would leave this function instead of the one it is in and
+// a break can't leave a loop around it
+func checkClosureExits(keyword string, keywordSpan token.Span, expression ast.Expression) {
+	block, isBlock := expression.(ast.BlockExpression)
+	if !isBlock {
+		return
+	}
+	var exits func(statement ast.Statement, inLoop bool)
+	exits = func(statement ast.Statement, inLoop bool) {
+		ast.Inspect(statement, func(statement ast.Statement) bool {
+			what := ""
+			var span token.Span
+			switch statement := statement.(type) {
+			case ast.SpawnStatement, ast.DeferStatement:
+				// checked on their own
+				return false
+			case ast.LoopStatement:
+				for _, statement := range statement.Statements {
+					exits(statement, true)
+				}
+				return false
+			case ast.ReturnStatement:
+				what, span = "return", statement.Span
+			case ast.ExpressionTry:
+				what, span = "?", statement.Span
+			case ast.BreakStatement:
+				if inLoop {
+					return true
+				}
+				what, span = "break", statement.Span
+			default:
+				return true
+			}
+			diagnostic := diag.Errorf(span, "%s can't be used inside of a %s block", what, keyword)
+			diagnostic.Code = "closure-exit"
+			diagnostic.Secondary = []diag.Label{{Span: keywordSpan, Message: "the block is a function of its own in go"}}
+			if what == "?" {
+				diagnostic.Notes = []string{"match the value inside of the block instead"}
+			}
+			panic(diagnostic)
+		})
+	}
+	exits(block, false)
+}
+
+// go evaluates the entries of a const group, which repeat the previous value
+// like with iota, at compile time, so they can't be variables
+func panicNotConstant(declaration ast.ValueDeclaration) {
+	panic(fmt.Sprintf("%s: the value of %s isn't constant, which the values of a const group have to be, declare it outside of the group", position(declaration.Span), declaration.Identifier))
+}
+
+func (recv *checker) checkFunction(parameters []ast.Parameter, statements []ast.Statement) {
+	recv.enterScope()
+	for _, parameter := range parameters {
+		recv.declare(parameter.Name, &variable{Type: parameter.Type})
+	}
+	recv.checkStatements(statements)
+	recv.leaveScope()
+}
+
+func (recv *checker) enterScope() {
+	recv.scope = &scope{parent: recv.scope, variables: map[string]*variable{}}
+}
+
+// variables declared without a type or value must have been assigned
+// in the scope they are declared in
+func (recv *checker) leaveScope() {
+	for name, variable := range recv.scope.variables {
+		if variable.pending != nil {
+			panic(fmt.Sprintf("%s: the type of %s can't be inferred, since it is never assigned, add an explicit type", position(variable.pending.Span), name))
+		}
+	}
+	recv.scope = recv.scope.parent
+}
+
+func (recv *checker) declare(name string, variable *variable) {
+	if name == "_" {
+		return
+	}
+	variable.file = recv.file
+	recv.scope.variables[name] = variable
+}
+
+func (recv *checker) checkStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		recv.checkStatement(statement)
+	}
+}
+
+func (recv *checker) checkStatement(statement ast.Statement) {
+	switch statement := statement.(type) {
+	case ast.ValueDeclaration:
+		if statement.Expression == nil && statement.ExplicitType == nil {
+			recv.declare(statement.Identifier, &variable{pending: &statement})
+			return
+		}
+		variable := &variable{}
+		variable.Type, variable.constant = recv.valueType(statement)
+		if statement.Variant == ast.ValueDeclarationVariant_const {
+			variable.const_ = &statement
+		}
+		recv.declare(statement.Identifier, variable)
+	case ast.ConstGroupStatement:
+		previous := ""
+		for _, constant := range statement.Declarations {
+			variable := &variable{Type: previous, constant: true, const_: &constant}
+			if constant.Expression != nil {
+				variable.Type, variable.constant = recv.valueType(constant)
+			} else if constant.ExplicitType != nil {
+				variable.Type = *constant.ExplicitType
+			}
+			if !variable.constant {
+				panicNotConstant(constant)
+			}
+			recv.declare(constant.Identifier, variable)
+			previous = variable.Type
+		}
+	case ast.Assignment:
+		recv.checkAssignable(statement)
+		type_ := recv.typeOf(statement.Expression)
+		checkStorable(type_, statement.Expression.Location())
+		if variable, isLocal := recv.scope.lookup(statement.Identifier); isLocal && variable.pending != nil {
+			variable.Type = defaultType(type_)
+			if variable.Type == "" {
+				panic(fmt.Sprintf("%s: the type of %s can't be inferred from the assigned value, add an explicit type", position(variable.pending.Span), statement.Identifier))
+			}
+			recv.info.declarations[key{File: variable.file, Span: variable.pending.Span}] = variable.Type
+			variable.pending = nil
+		}
+	case ast.ReturnStatement:
+		for _, expression := range statement.Expressions {
+			recv.typeOf(expression)
+		}
+	case ast.LoopStatement:
+		recv.enterScope()
+		recv.checkStatements(statement.Statements)
+		recv.leaveScope()
+	case ast.SpawnStatement:
+		checkClosureExits("spawn", statement.Span, statement.Expression)
+		recv.typeOf(statement.Expression)
+	case ast.DeferStatement:
+		checkClosureExits("defer", statement.Span, statement.Expression)
+		recv.typeOf(statement.Expression)
+	case ast.SendStatement:
+		recv.typeOf(statement.Channel)
+		recv.typeOf(statement.Value)
+	case ast.SelectStatement:
+		for _, arm := range statement.Arms {
+			recv.enterScope()
+			if arm.Channel != nil {
+				channel := recv.typeOf(arm.Channel)
+				if arm.Binding != "" {
+					recv.declare(arm.Binding, &variable{Type: elementType(channel)})
+				}
+			}
+			if arm.Value != nil {
+				recv.typeOf(arm.Value)
+			}
+			recv.typeOf(arm.Expression)
+			recv.leaveScope()
+		}
+	case ast.Expression:
+		recv.typeOf(statement)
+	}
+}
+
+// 0 based spans as `row:col`
+func position(span token.Span) string {
+	return fmt.Sprintf("%d:%d", span.StartRowIndex+1, span.StartColumnIndex+1)
+}
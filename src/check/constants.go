@@ -0,0 +1,155 @@
+package check
+
+import (
+	"go/types"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/token"
+	"strings"
+)
+
+// whether go can evaluate the expression at compile time, which decides
+// whether a const is lowered to a go const or to a variable
+func (recv *checker) isConstant(expression ast.Expression) bool {
+	switch expression := expression.(type) {
+	case ast.ExpressionLiteral:
+		// interpolated strings are formatted at runtime
+		_, isInterpolated := expression.Literal.(ast.InterpolatedStringLiteral)
+		return !isInterpolated
+	case ast.ExpressionIdentifier:
+		return recv.isConstantName(expression.Identifier)
+	case ast.ExpressionParenthesized:
+		return recv.isConstant(expression.Expression)
+	case ast.ExpressionUnary:
+		switch expression.Operator {
+		case token.OperatorVariant_Minus, token.OperatorVariant_Plus, token.OperatorVariant_Not:
+			return recv.isConstant(expression.Expression)
+		}
+	case ast.ExpressionBinary:
+		// ** is lowered to a call, unless it is folded
+		if expression.Operator == token.OperatorVariant_PowerOf {
+			_, isConstant := IntegerConstant(expression)
+			return isConstant
+		}
+		return recv.isConstant(expression.Left) && recv.isConstant(expression.Right)
+	case ast.ExpressionConversion:
+		return recv.isBasicType(expression.Type) && recv.isConstant(expression.Expression)
+	case ast.ExpressionCall:
+		// a conversion to a declared type
+		if declaration, isDeclared := recv.declarations[expression.Identifier]; isDeclared && declaration.Kind == "type" {
+			return len(expression.Arguments) == 1 && recv.isBasicType(expression.Identifier) && recv.isConstant(expression.Arguments[0])
+		}
+	}
+	return false
+}
+
+func (recv *checker) isConstantName(identifier string) bool {
+	switch identifier {
+	case "true", "false", "iota":
+		return true
+	}
+	segments := strings.Split(identifier, ".")
+	if variable, isLocal := recv.scope.lookup(segments[0]); isLocal {
+		return len(segments) == 1 && variable.constant
+	}
+	if declaration, isDeclared := recv.declarations[segments[0]]; isDeclared {
+		switch {
+		case len(segments) == 1 && declaration.Kind == "const":
+			recv.resolve(declaration)
+			return declaration.constant
+		case len(segments) == 2 && declaration.Kind == "enum":
+			// enums without data are lowered to iota constants
+			return !declaration.Enum.HasPayload()
+		}
+		return false
+	}
+	if imported, isImported := recv.importedChecker(segments[0]); isImported && len(segments) > 1 {
+		return imported.isConstantName(strings.Join(segments[1:], "."))
+	}
+	// the names have been checked, when their type was inferred
+	if object, isGo := recv.goObject(identifier, token.Span{}); isGo {
+		_, isConstant := object.(*types.Const)
+		return isConstant
+	}
+	return false
+}
+
+// whether the type is one of go's basic types, constants can have
+func (recv *checker) isBasicType(type_ string) bool {
+	return basicTypes[recv.underlying(type_)]
+}
+
+// resolves the declared types of the package to the type they stand for,
+// other types are returned as they are
+func (recv *checker) underlying(type_ string) string {
+	seen := map[string]bool{}
+	for !seen[type_] {
+		seen[type_] = true
+		declaration, isDeclared := recv.declarations[type_]
+		if !isDeclared || declaration.Kind != "type" {
+			return type_
+		}
+		type_ = declaration.Type
+	}
+	// the declared types refer to each other
+	return ""
+}
+
+// consts can't be assigned, even if they are lowered to go variables, and
+// neither can their fields, like in `p.x = 1`
+func (recv *checker) checkAssignable(assignment ast.Assignment) {
+	if name, file, declaration, isConst := recv.constDeclaration(assignment.Identifier); isConst {
+		panicConstAssignment(assignment, name, file, declaration)
+	}
+}
+
+// the const `identifier` or its fields belong to
+func (recv *checker) constDeclaration(identifier string) (string, string, ast.ValueDeclaration, bool) {
+	segments := strings.Split(identifier, ".")
+	if variable, isLocal := recv.scope.lookup(segments[0]); isLocal {
+		if variable.const_ != nil {
+			return segments[0], variable.file, *variable.const_, true
+		}
+		return "", "", ast.ValueDeclaration{}, false
+	}
+	if declaration, isDeclared := recv.declarations[segments[0]]; isDeclared {
+		if declaration.Kind == "const" {
+			return segments[0], declaration.File, declaration.Value, true
+		}
+		return "", "", ast.ValueDeclaration{}, false
+	}
+	if imported, isImported := recv.importedChecker(segments[0]); isImported && len(segments) > 1 {
+		if declaration, isDeclared := imported.declarations[segments[1]]; isDeclared && declaration.Kind == "const" {
+			return segments[0] + "." + segments[1], declaration.File, declaration.Value, true
+		}
+	}
+	return "", "", ast.ValueDeclaration{}, false
+}
+
+// go can't take the address of a const, and the address of a const lowered to
+// a variable would allow changing it
+func (recv *checker) checkAddressable(expression ast.ExpressionIdentifier) {
+	name, file, declaration, isConst := recv.constDeclaration(expression.Identifier)
+	if !isConst {
+		return
+	}
+	diagnostic := diag.Errorf(expression.Span, "can't take the address of %s, since %s is declared as const", expression.Identifier, name)
+	if expression.Identifier == name {
+		diagnostic = diag.Errorf(expression.Span, "can't take the address of %s, since it is declared as const", name)
+	}
+	diagnostic.Code = "const-address"
+	diagnostic.Secondary = []diag.Label{{File: file, Span: declaration.Span, Message: "declared as const here"}}
+	diagnostic.Notes = []string{"copy it into a variable declared with let and take the address of that"}
+	panic(diagnostic)
+}
+
+func panicConstAssignment(assignment ast.Assignment, name string, file string, declaration ast.ValueDeclaration) {
+	diagnostic := diag.Errorf(assignment.Span, "can't assign to %s, since %s is declared as const", assignment.Identifier, name)
+	if assignment.Identifier == name {
+		diagnostic = diag.Errorf(assignment.Span, "can't assign to %s, since it is declared as const", name)
+	}
+	diagnostic.Code = "const-assignment"
+	diagnostic.Secondary = []diag.Label{{File: file, Span: declaration.Span, Message: "declared as const here"}}
+	diagnostic.Notes = []string{"values, which change, are declared with let"}
+	panic(diagnostic)
+}
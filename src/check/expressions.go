@@ -0,0 +1,323 @@
+package check
+
+import (
+	"fmt"
+	"go/types"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/token"
+	"strings"
+)
+
+// infers the type of the expression and of all expressions nested in it
+func (recv *checker) typeOf(expression ast.Expression) string {
+	type_ := recv.inferType(expression)
+	recv.info.types[key{File: recv.file, Span: expression.Location()}] = type_
+	return type_
+}
+
+func (recv *checker) inferType(expression ast.Expression) string {
+	switch expression := expression.(type) {
+	case ast.ExpressionLiteral:
+		switch literal := expression.Literal.(type) {
+		case ast.IntLiteral:
+			return untypedInt
+		case ast.FloatLiteral:
+			return untypedFloat
+		case ast.InterpolatedStringLiteral:
+			for _, hole := range literal.Expressions {
+				recv.typeOf(hole)
+			}
+		}
+		return "string"
+	case ast.ExpressionIdentifier:
+		if object, isGo := recv.goObject(expression.Identifier, expression.Span); isGo {
+			return recv.goValueType(object)
+		}
+		return recv.identifierType(expression.Identifier)
+	case ast.ExpressionCall:
+		return recv.callType(expression)
+	case ast.ExpressionConversion:
+		recv.typeOf(expression.Expression)
+		return expression.Type
+	case ast.ExpressionTypeAssertion:
+		recv.typeOf(expression.Expression)
+		return expression.Type
+	case ast.ExpressionType:
+		return expression.Type
+	case ast.ExpressionParenthesized:
+		return recv.typeOf(expression.Expression)
+	case ast.ExpressionTry:
+		return fallibleValue(recv.typeOf(expression.Expression))
+	case ast.ExpressionUnary:
+		return recv.unaryType(expression)
+	case ast.ExpressionBinary:
+		return recv.binaryType(expression)
+	case ast.BlockExpression:
+		recv.enterScope()
+		defer recv.leaveScope()
+		recv.checkStatements(expression.Statements)
+		if expression.Expression == nil {
+			return ""
+		}
+		return recv.typeOf(*expression.Expression)
+	case ast.IfExpression:
+		recv.typeOf(expression.Condition)
+		consequent := recv.typeOf(expression.Consequent)
+		if expression.Alternate == nil {
+			return ""
+		}
+		alternate := recv.typeOf(*expression.Alternate)
+		type_, isUnified := unify(consequent, alternate)
+		if !isUnified {
+			diagnostic := diag.Errorf(valueSpan(*expression.Alternate), "%s", mismatch("the branches of the if", consequent, alternate))
+			diagnostic.Code = "type-mismatch"
+			diagnostic.Primary.Message = "this is " + describe(alternate)
+			diagnostic.Secondary = []diag.Label{{Span: valueSpan(expression.Consequent), Message: "this is " + describe(consequent)}}
+			panic(diagnostic)
+		}
+		return type_
+	case ast.MatchExpression:
+		return recv.matchType(expression)
+	}
+	return ""
+}
+
+func (recv *checker) identifierType(identifier string) string {
+	switch identifier {
+	case "true", "false":
+		return "bool"
+	}
+	segments := strings.Split(identifier, ".")
+	if variable, isLocal := recv.scope.lookup(segments[0]); isLocal {
+		if len(segments) == 1 {
+			return variable.Type
+		}
+		// fields and methods of go types aren't known
+		return ""
+	}
+	if declaration, isDeclared := recv.declarations[segments[0]]; isDeclared {
+		switch {
+		case len(segments) == 1 && (declaration.Kind == "let" || declaration.Kind == "const"):
+			return recv.resolve(declaration)
+		case len(segments) == 2 && declaration.Kind == "enum":
+			// `Color.Red`
+			return segments[0]
+		}
+		return ""
+	}
+	if imported, isImported := recv.importedChecker(segments[0]); isImported && len(segments) > 1 {
+		return imported.qualify(imported.identifierType(strings.Join(segments[1:], ".")), segments[0])
+	}
+	return ""
+}
+
+func (recv *checker) callType(call ast.ExpressionCall) string {
+	arguments := []string{}
+	for _, argument := range call.Arguments {
+		arguments = append(arguments, recv.typeOf(argument))
+	}
+	if object, isGo := recv.goObject(call.Identifier, call.Span); isGo {
+		return recv.goCallType(call, object, arguments)
+	}
+	return recv.returnType(call.Identifier, arguments)
+}
+
+// the type of the value returned by calling `identifier`, functions
+// returning more than one value have an unknown type
+func (recv *checker) returnType(identifier string, arguments []string) string {
+	segments := strings.Split(identifier, ".")
+	if _, isLocal := recv.scope.lookup(segments[0]); isLocal {
+		return ""
+	}
+	if declaration, isDeclared := recv.declarations[segments[0]]; isDeclared {
+		switch {
+		case len(segments) == 1 && declaration.Kind == "fn":
+			if len(declaration.Function.ReturnTypes) == 1 {
+				return declaration.Function.ReturnTypes[0]
+			}
+		case len(segments) == 1 && (declaration.Kind == "type" || declaration.Kind == "interface"):
+			// a conversion
+			return identifier
+		case len(segments) == 2 && declaration.Kind == "enum":
+			// `Shape.Circle(1)`
+			return segments[0]
+		}
+		return ""
+	}
+	if imported, isImported := recv.importedChecker(segments[0]); isImported && len(segments) > 1 {
+		return imported.qualify(imported.returnType(strings.Join(segments[1:], "."), arguments), segments[0])
+	}
+	returnTypes, isBuiltin := recv.builtins[identifier]
+	if !isBuiltin || len(returnTypes) != 1 {
+		return ""
+	}
+	// `append` returns the type of the slice it got
+	if returnTypes[0] == "any" {
+		if len(arguments) == 0 {
+			return ""
+		}
+		return arguments[0]
+	}
+	return returnTypes[0]
+}
+
+// whether calling `identifier` is known to return nothing, like print,
+// calls of local variables aren't known
+func (recv *checker) isVoid(identifier string) bool {
+	segments := strings.Split(identifier, ".")
+	if declaration, isDeclared := recv.declarations[segments[0]]; isDeclared {
+		return len(segments) == 1 && declaration.Kind == "fn" && len(declaration.Function.ReturnTypes) == 0
+	}
+	if imported, isImported := recv.importedChecker(segments[0]); isImported && len(segments) > 1 {
+		return imported.isVoid(strings.Join(segments[1:], "."))
+	}
+	if package_, isImported := recv.goImports[segments[0]]; isImported {
+		function, isFunction := package_.Scope().Lookup(segments[len(segments)-1]).(*types.Func)
+		return len(segments) == 2 && isFunction && function.Type().(*types.Signature).Results().Len() == 0
+	}
+	returnTypes, isBuiltin := recv.builtins[identifier]
+	return isBuiltin && len(returnTypes) == 0
+}
+
+func (recv *checker) unaryType(expression ast.ExpressionUnary) string {
+	operand := recv.typeOf(expression.Expression)
+	switch expression.Operator {
+	case token.OperatorVariant_Not:
+		return "bool"
+	case token.OperatorVariant_Multiply:
+		if strings.HasPrefix(operand, "*") {
+			return strings.TrimPrefix(operand, "*")
+		}
+		return ""
+	case token.OperatorVariant_BinaryAnd:
+		if identifier, isIdentifier := expression.Expression.(ast.ExpressionIdentifier); isIdentifier {
+			recv.checkAddressable(identifier)
+		}
+		if operand == "" || isUntyped(operand) {
+			return ""
+		}
+		return "*" + operand
+	case token.OperatorVariant_Arrow:
+		if strings.HasPrefix(operand, "chan ") || strings.HasPrefix(operand, "<-chan ") {
+			return elementType(operand)
+		}
+		return ""
+	}
+	return operand
+}
+
+func (recv *checker) binaryType(expression ast.ExpressionBinary) string {
+	left := recv.typeOf(expression.Left)
+	right := recv.typeOf(expression.Right)
+	switch expression.Operator {
+	case token.OperatorVariant_Equals, token.OperatorVariant_NotEquals,
+		token.OperatorVariant_LowerThan, token.OperatorVariant_LowerThanOrEqual,
+		token.OperatorVariant_GreaterThan, token.OperatorVariant_GreaterThanOrEqual,
+		token.OperatorVariant_LogicalAnd, token.OperatorVariant_LogicalOr:
+		return "bool"
+	case token.OperatorVariant_PowerOf:
+		return recv.powerType(expression, left, right)
+	}
+	type_, _ := unify(left, right)
+	return type_
+}
+
+// the arms are unified like the branches of an if
+func (recv *checker) matchType(expression ast.MatchExpression) string {
+	subject := recv.typeOf(expression.Subject)
+	type_ := ""
+	var first ast.Expression
+	for i, arm := range expression.Arms {
+		recv.enterScope()
+		switch pattern := arm.Pattern.(type) {
+		case ast.PatternVariant:
+			payload := recv.payloadTypes(pattern.Identifier)
+			if value := fallibleValue(subject); value != "" {
+				payload = fallibleBindings(pattern.Identifier, value)
+			}
+			for j, binding := range pattern.Bindings {
+				bindingType := ""
+				if j < len(payload) {
+					bindingType = payload[j]
+				}
+				recv.declare(binding, &variable{Type: bindingType})
+			}
+		case ast.PatternType:
+			recv.declare(pattern.Binding, &variable{Type: pattern.Type})
+		}
+		armType := recv.typeOf(arm.Expression)
+		recv.leaveScope()
+		if i == 0 {
+			type_, first = armType, arm.Expression
+			continue
+		}
+		unified, isUnified := unify(type_, armType)
+		if !isUnified {
+			diagnostic := diag.Errorf(valueSpan(arm.Expression), "%s", mismatch(fmt.Sprintf("the arms of the match on %s", describe(subject)), type_, armType))
+			diagnostic.Code = "type-mismatch"
+			diagnostic.Primary.Message = "this is " + describe(armType)
+			diagnostic.Secondary = []diag.Label{{Span: valueSpan(first), Message: "this is " + describe(type_)}}
+			panic(diagnostic)
+		}
+		type_ = unified
+	}
+	return type_
+}
+
+// the span of the value of blocks, which are the branches of ifs and
+// often the arms of matches, so mismatches point at the values
+func valueSpan(expression ast.Expression) token.Span {
+	if block, isBlock := expression.(ast.BlockExpression); isBlock && block.Expression != nil {
+		return valueSpan(*block.Expression)
+	}
+	return expression.Location()
+}
+
+// the values `Ok(value)`, `Err(err)` and `Some(value)` bind
+func fallibleBindings(variant string, value string) []string {
+	switch variant {
+	case "Ok", "Some":
+		return []string{value}
+	case "Err":
+		return []string{"error"}
+	}
+	return nil
+}
+
+func describe(type_ string) string {
+	if type_ == "" {
+		return "a value"
+	}
+	return defaultType(type_)
+}
+
+// the types of the values a variant like `Shape.Circle` or
+// `geometry.Step.Forward` carries
+func (recv *checker) payloadTypes(identifier string) []string {
+	segments := strings.Split(identifier, ".")
+	if len(segments) == 3 {
+		imported, isImported := recv.importedChecker(segments[0])
+		if !isImported {
+			return nil
+		}
+		types := []string{}
+		for _, type_ := range imported.payloadTypes(strings.Join(segments[1:], ".")) {
+			types = append(types, imported.qualify(type_, segments[0]))
+		}
+		return types
+	}
+	if len(segments) != 2 {
+		return nil
+	}
+	declaration, isDeclared := recv.declarations[segments[0]]
+	if !isDeclared || declaration.Kind != "enum" {
+		return nil
+	}
+	for _, variant := range declaration.Enum.Variants {
+		if variant.Name == segments[1] {
+			return variant.Types
+		}
+	}
+	return nil
+}
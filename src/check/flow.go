@@ -0,0 +1,438 @@
+package check
+
+import (
+	"fmt"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/token"
+	"strings"
+)
+
+// the variables declared without a type or value, which aren't assigned on
+// every path leading to a point of a function, nil if the point can't be
+// reached, like the statements after a return
+type assignments map[*ast.ValueDeclaration]bool
+
+func (recv assignments) without(declaration *ast.ValueDeclaration) assignments {
+	if recv == nil || !recv[declaration] {
+		return recv
+	}
+	result := assignments{}
+	for unassigned := range recv {
+		if unassigned != declaration {
+			result[unassigned] = true
+		}
+	}
+	return result
+}
+
+// the state after the paths come together, a variable is unassigned, if
+// it is unassigned on any path, which reaches the point
+func merge(paths ...assignments) assignments {
+	var result assignments
+	for _, path := range paths {
+		if path == nil {
+			continue
+		}
+		if result == nil {
+			result = assignments{}
+		}
+		for unassigned := range path {
+			result[unassigned] = true
+		}
+	}
+	return result
+}
+
+// control flow analysis of a function body, which reports functions
+// falling off their end without a return, blocks and ifs used as values
+// without a value and variables, which are read before they are assigned
+//
+// go zero initializes variables and only knows about the generated code,
+// so it would accept most of these
+type flow struct {
+	checker *checker
+	// the local variables by their name, nil for the ones with a value,
+	// which are only tracked to shadow outer variables
+	scopes []map[string]*ast.ValueDeclaration
+	// the states at the breaks of the innermost loop
+	breaks *[]assignments
+}
+
+func (recv *checker) checkFlow(function ast.FunctionDeclarationStatement) {
+	flow := flow{checker: recv}
+	flow.enterScope()
+	for _, parameter := range function.Parameters {
+		flow.declare(parameter.Name, nil)
+	}
+	end := flow.statements(function.Statements, assignments{})
+	if end != nil && len(function.ReturnTypes) > 0 {
+		panicMissingReturn(function)
+	}
+}
+
+// package level values are checked like the values of function bodies
+func (recv *checker) checkValueFlow(expression ast.Expression) {
+	flow := flow{checker: recv}
+	flow.enterScope()
+	flow.value(expression, assignments{})
+}
+
+func panicMissingReturn(function ast.FunctionDeclarationStatement) {
+	end := function.Span
+	end.StartIndex, end.StartRowIndex, end.StartColumnIndex = end.ExcludedEndIndex-1, end.EndRowIndex, end.EndColumnIndex-1
+	diagnostic := diag.Errorf(end, "missing return at the end of %s, which returns %s", function.Identifier, strings.Join(function.ReturnTypes, ", "))
+	diagnostic.Code = "missing-return"
+	diagnostic.Primary.Message = "the function can reach its end"
+	if len(function.Statements) > 0 {
+		switch function.Statements[len(function.Statements)-1].(type) {
+		case ast.IfExpression, ast.MatchExpression, ast.BlockExpression:
+		case ast.Expression:
+			diagnostic.Notes = []string{"the value of the last expression isn't returned, values are returned with return"}
+		}
+	}
+	panic(diagnostic)
+}
+
+func (recv *flow) enterScope() {
+	recv.scopes = append(recv.scopes, map[string]*ast.ValueDeclaration{})
+}
+
+func (recv *flow) leaveScope() {
+	recv.scopes = recv.scopes[:len(recv.scopes)-1]
+}
+
+func (recv *flow) declare(name string, declaration *ast.ValueDeclaration) {
+	recv.scopes[len(recv.scopes)-1][name] = declaration
+}
+
+// the declaration of the local variable without a value, `name` refers to
+func (recv *flow) lookup(name string) (*ast.ValueDeclaration, bool) {
+	name = strings.Split(name, ".")[0]
+	for i := len(recv.scopes) - 1; i >= 0; i-- {
+		if declaration, exists := recv.scopes[i][name]; exists {
+			return declaration, declaration != nil
+		}
+	}
+	return nil, false
+}
+
+// like checker.isVoid, but local variables shadow the functions
+func (recv *flow) isVoid(identifier string) bool {
+	name := strings.Split(identifier, ".")[0]
+	for _, scope := range recv.scopes {
+		if _, isLocal := scope[name]; isLocal {
+			return false
+		}
+	}
+	return recv.checker.isVoid(identifier)
+}
+
+func (recv *flow) read(name string, span token.Span, state assignments) {
+	declaration, isTracked := recv.lookup(name)
+	if !isTracked || !state[declaration] {
+		return
+	}
+	name = strings.Split(name, ".")[0]
+	diagnostic := diag.Errorf(nameSpan(span, name), "%s is read before it is assigned", name)
+	diagnostic.Code = "unassigned"
+	diagnostic.Secondary = []diag.Label{{Span: declaration.Span, Message: "declared without a value here"}}
+	diagnostic.Notes = []string{fmt.Sprintf("%s has to be assigned on every path leading here, or get a value, where it is declared", name)}
+	panic(diagnostic)
+}
+
+func (recv *flow) statements(statements []ast.Statement, state assignments) assignments {
+	for i, statement := range statements {
+		if state == nil {
+			// unreachable statements can't make a difference
+			recv.unreachable(statement, statements[i-1])
+			break
+		}
+		state = recv.statement(statement, state)
+	}
+	return state
+}
+
+// warns about the first statement, which can't be reached, since the
+// previous one returns, breaks, panics or loops forever
+func (recv *flow) unreachable(statement ast.Statement, previous ast.Statement) {
+	located, isLocated := statement.(interface{ Location() token.Span })
+	if !isLocated {
+		return
+	}
+	warning := diag.Warningf(located.Location(), "unreachable code")
+	warning.Code = "unreachable"
+	if previous, isLocated := previous.(interface{ Location() token.Span }); isLocated {
+		warning.Secondary = []diag.Label{{Span: previous.Location(), Message: "the code after this is never run"}}
+	}
+	recv.checker.report(warning)
+}
+
+func (recv *flow) statement(statement ast.Statement, state assignments) assignments {
+	switch statement := statement.(type) {
+	case ast.ValueDeclaration:
+		if statement.Expression != nil {
+			state = recv.value(*statement.Expression, state)
+		}
+		// like in go, variables with a type start with its zero value,
+		// which is useful for slices or types like sync.WaitGroup
+		if statement.Expression != nil || statement.ExplicitType != nil {
+			recv.declare(statement.Identifier, nil)
+			return state
+		}
+		declaration := statement
+		recv.declare(statement.Identifier, &declaration)
+		unassigned := merge(state)
+		unassigned[&declaration] = true
+		return unassigned
+	case ast.ConstGroupStatement:
+		for _, constant := range statement.Declarations {
+			if constant.Expression != nil {
+				state = recv.value(*constant.Expression, state)
+			}
+			recv.declare(constant.Identifier, nil)
+		}
+		return state
+	case ast.Assignment:
+		state = recv.value(statement.Expression, state)
+		// assigning a field counts, since go zero initializes the others
+		if declaration, isTracked := recv.lookup(statement.Identifier); isTracked {
+			return state.without(declaration)
+		}
+		return state
+	case ast.ReturnStatement:
+		for _, expression := range statement.Expressions {
+			state = recv.value(expression, state)
+		}
+		return nil
+	case ast.BreakStatement:
+		if recv.breaks != nil {
+			*recv.breaks = append(*recv.breaks, state)
+		}
+		return nil
+	case ast.LoopStatement:
+		breaks := []assignments{}
+		outer := recv.breaks
+		recv.breaks = &breaks
+		recv.enterScope()
+		recv.statements(statement.Statements, state)
+		recv.leaveScope()
+		recv.breaks = outer
+		// a loop without a break never ends
+		return merge(breaks...)
+	case ast.SpawnStatement:
+		recv.closure(statement.Expression)
+		return state
+	case ast.DeferStatement:
+		recv.closure(statement.Expression)
+		return state
+	case ast.SendStatement:
+		state = recv.value(statement.Channel, state)
+		return recv.value(statement.Value, state)
+	case ast.SelectStatement:
+		arms := []assignments{}
+		for _, arm := range statement.Arms {
+			recv.enterScope()
+			armState := state
+			if arm.Channel != nil {
+				armState = recv.value(arm.Channel, armState)
+			}
+			if arm.Value != nil {
+				armState = recv.value(arm.Value, armState)
+			}
+			if arm.Binding != "" {
+				recv.declare(arm.Binding, nil)
+			}
+			arms = append(arms, recv.expression(arm.Expression, armState, false))
+			recv.leaveScope()
+		}
+		return merge(arms...)
+	case ast.Expression:
+		return recv.expression(statement, state, false)
+	}
+	return state
+}
+
+// spawned and deferred code runs later, when the variables may have been
+// assigned, so only its values are checked
+func (recv *flow) closure(expression ast.Expression) {
+	breaks := recv.breaks
+	recv.breaks = nil
+	recv.expression(expression, assignments{}, false)
+	recv.breaks = breaks
+}
+
+func (recv *flow) value(expression ast.Expression, state assignments) assignments {
+	return recv.expression(expression, state, true)
+}
+
+// the state after evaluating the expression, isValue is set, if its value
+// is used, which blocks and ifs need to have
+func (recv *flow) expression(expression ast.Expression, state assignments, isValue bool) assignments {
+	if state == nil {
+		return nil
+	}
+	switch expression := expression.(type) {
+	case ast.ExpressionIdentifier:
+		if expression.Identifier != "true" && expression.Identifier != "false" {
+			recv.read(expression.Identifier, expression.Span, state)
+		}
+	case ast.ExpressionLiteral:
+		if literal, isInterpolated := expression.Literal.(ast.InterpolatedStringLiteral); isInterpolated {
+			for _, hole := range literal.Expressions {
+				state = recv.value(hole, state)
+			}
+		}
+	case ast.ExpressionCall:
+		if strings.Contains(expression.Identifier, ".") {
+			recv.read(expression.Identifier, expression.Span, state)
+		}
+		for _, argument := range expression.Arguments {
+			state = recv.value(argument, state)
+		}
+		if recv.isPanic(expression.Identifier) {
+			return nil
+		}
+		if isValue && recv.isVoid(expression.Identifier) {
+			diagnostic := diag.Errorf(expression.Span, "%s returns nothing, but its value is used", expression.Identifier)
+			diagnostic.Code = "missing-value"
+			diagnostic.Primary.Message = "this has no value"
+			panic(diagnostic)
+		}
+	case ast.ExpressionConversion:
+		return recv.value(expression.Expression, state)
+	case ast.ExpressionTypeAssertion:
+		return recv.value(expression.Expression, state)
+	case ast.ExpressionParenthesized:
+		return recv.expression(expression.Expression, state, isValue)
+	case ast.ExpressionTry:
+		return recv.value(expression.Expression, state)
+	case ast.ExpressionUnary:
+		return recv.value(expression.Expression, state)
+	case ast.ExpressionBinary:
+		state = recv.value(expression.Left, state)
+		return recv.value(expression.Right, state)
+	case ast.BlockExpression:
+		return recv.block(expression, state, isValue)
+	case ast.IfExpression:
+		state = recv.value(expression.Condition, state)
+		recv.deadBranch(expression)
+		if isValue && expression.Alternate == nil {
+			diagnostic := diag.Errorf(expression.Span, "the if is used as a value, but has no else")
+			diagnostic.Code = "missing-value"
+			diagnostic.Primary.Message = "the value would be missing, if the condition is false"
+			panic(diagnostic)
+		}
+		consequent := recv.expression(expression.Consequent, state, isValue)
+		if expression.Alternate == nil {
+			return merge(state, consequent)
+		}
+		return merge(consequent, recv.expression(*expression.Alternate, state, isValue))
+	case ast.MatchExpression:
+		state = recv.value(expression.Subject, state)
+		arms := []assignments{}
+		exhaustive := false
+		for _, arm := range expression.Arms {
+			recv.enterScope()
+			switch pattern := arm.Pattern.(type) {
+			case ast.PatternWildcard:
+				exhaustive = true
+			case ast.PatternVariant:
+				// matches on enums, Results and Options have to handle
+				// every variant, which the builder checks
+				exhaustive = true
+				for _, binding := range pattern.Bindings {
+					recv.declare(binding, nil)
+				}
+			case ast.PatternType:
+				recv.declare(pattern.Binding, nil)
+			}
+			arms = append(arms, recv.expression(arm.Expression, state, isValue))
+			recv.leaveScope()
+		}
+		if !exhaustive {
+			arms = append(arms, state)
+		}
+		return merge(arms...)
+	}
+	return state
+}
+
+func (recv *flow) block(block ast.BlockExpression, state assignments, isValue bool) assignments {
+	recv.enterScope()
+	defer recv.leaveScope()
+	state = recv.statements(block.Statements, state)
+	if state == nil && block.Expression != nil && len(block.Statements) > 0 {
+		recv.unreachable(*block.Expression, block.Statements[len(block.Statements)-1])
+	}
+	if block.Expression != nil {
+		return recv.expression(*block.Expression, state, isValue)
+	}
+	// blocks, which can't reach their end, like ones ending with a
+	// return, don't need a value
+	if isValue && state != nil {
+		diagnostic := diag.Errorf(block.Span, "the block is used as a value, but doesn't end with an expression")
+		diagnostic.Code = "missing-value"
+		if len(block.Statements) > 0 {
+			last := block.Statements[len(block.Statements)-1]
+			if located, isLocated := last.(interface{ Location() token.Span }); isLocated {
+				diagnostic.Primary.Span = located.Location()
+				diagnostic.Primary.Message = "the last statement has no value"
+			}
+		}
+		panic(diagnostic)
+	}
+	return state
+}
+
+// warns about the branch, which is never run, since the condition is
+// `true` or `false`, constants like `if debug` are left alone, since they
+// are a common way of switching code off
+func (recv *flow) deadBranch(expression ast.IfExpression) {
+	condition, isIdentifier := expression.Condition.(ast.ExpressionIdentifier)
+	if !isIdentifier || (condition.Identifier != "true" && condition.Identifier != "false") {
+		return
+	}
+	if recv.isLocal(condition.Identifier) {
+		return
+	}
+	var dead ast.Expression = expression.Consequent
+	if condition.Identifier == "true" {
+		if expression.Alternate == nil {
+			return
+		}
+		dead = *expression.Alternate
+	}
+	warning := diag.Warningf(dead.Location(), "the branch is never run, since the condition is always %s", condition.Identifier)
+	warning.Code = "dead-branch"
+	warning.Secondary = []diag.Label{{Span: condition.Span, Message: "always " + condition.Identifier}}
+	recv.checker.report(warning)
+}
+
+// calls of the builtin panic never return
+func (recv *flow) isPanic(identifier string) bool {
+	if identifier != "panic" {
+		return false
+	}
+	_, isDeclared := recv.checker.declarations[identifier]
+	return !isDeclared && !recv.isLocal(identifier)
+}
+
+// whether the name is declared in the function
+func (recv *flow) isLocal(name string) bool {
+	for _, scope := range recv.scopes {
+		if _, exists := scope[name]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// the span of the name at the start of the span, which may cover a call
+// or an assignment
+func nameSpan(span token.Span, name string) token.Span {
+	span.EndRowIndex = span.StartRowIndex
+	span.EndColumnIndex = span.StartColumnIndex + uint(len([]rune(name)))
+	span.ExcludedEndIndex = span.StartIndex + uint(len(name))
+	return span
+}
@@ -0,0 +1,310 @@
+package check
+
+import (
+	"fmt"
+	"go/types"
+	"regexp"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/token"
+	"sort"
+	"strings"
+)
+
+// an exported declaration of a go package, for completions
+type Member struct {
+	Name string
+	// func, var, const or type
+	Kind string
+	// like `func(s string, count int) string`
+	Type string
+}
+
+// the exported declarations of the go package, the file imports as
+// qualifier, ordered by name, nil if the package isn't known
+func (recv Info) GoMembers(file string, qualifier string) []Member {
+	package_, isImported := recv.goImports[file][qualifier]
+	if !isImported {
+		return nil
+	}
+	members := []Member{}
+	for _, name := range package_.Scope().Names() {
+		object := package_.Scope().Lookup(name)
+		if !object.Exported() {
+			continue
+		}
+		member := Member{Name: name, Type: types.TypeString(object.Type(), types.RelativeTo(package_))}
+		switch object.(type) {
+		case *types.Func:
+			member.Kind = "func"
+		case *types.Var:
+			member.Kind = "var"
+		case *types.Const:
+			member.Kind = "const"
+		case *types.TypeName:
+			member.Kind = "type"
+			member.Type = types.TypeString(object.Type().Underlying(), types.RelativeTo(package_))
+		}
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+	return members
+}
+
+// records the go packages the current file imports, which are loaded
+func (recv *checker) importGoPackages(imports []ast.Import) {
+	recv.goImports = map[string]*types.Package{}
+	recv.goQualifiers = map[string]string{}
+	if recv.goPackages == nil {
+		return
+	}
+	paths := []string{}
+	for _, import_ := range imports {
+		paths = append(paths, import_.Path)
+	}
+	recv.goPackages.Load(paths...)
+	byQualifier := map[string]ast.Import{}
+	for _, import_ := range imports {
+		package_, isLoaded := recv.goPackages.Lookup(import_.Path)
+		if !isLoaded {
+			continue
+		}
+		qualifier := import_.Name
+		if qualifier == "" {
+			qualifier = package_.Name()
+		}
+		// importing the same package twice is reported by the builder
+		if existing, exists := byQualifier[qualifier]; exists && existing.Path != import_.Path && qualifier != "_" && qualifier != "." {
+			diagnostic := diag.Errorf(import_.Span, "import %s is redeclared", qualifier)
+			diagnostic.Code = "redeclared"
+			diagnostic.Secondary = []diag.Label{{Span: existing.Span, Message: fmt.Sprintf("%s is imported here", qualifier)}}
+			diagnostic.Notes = []string{"one of the imports can be renamed, like `import other \"" + import_.Path + "\"`"}
+			panic(diagnostic)
+		}
+		byQualifier[qualifier] = import_
+		recv.goImports[qualifier] = package_
+		recv.goQualifiers[package_.Path()] = qualifier
+	}
+	if recv.info.goImports[recv.file] == nil {
+		recv.info.goImports[recv.file] = recv.goImports
+	}
+}
+
+// the declaration of a loaded go package, a qualified name like `math.Pi`
+// or `os.Stdout.WriteString` refers to, false if it doesn't start with
+// the qualifier of one, names, which aren't declared, are reported
+func (recv *checker) goObject(identifier string, span token.Span) (types.Object, bool) {
+	segments := strings.Split(identifier, ".")
+	if len(segments) < 2 {
+		return nil, false
+	}
+	if _, isLocal := recv.scope.lookup(segments[0]); isLocal {
+		return nil, false
+	}
+	if _, isDeclared := recv.declarations[segments[0]]; isDeclared {
+		return nil, false
+	}
+	package_, isImported := recv.goImports[segments[0]]
+	if !isImported {
+		return nil, false
+	}
+	object := package_.Scope().Lookup(segments[1])
+	if object == nil || !object.Exported() {
+		panic(recv.undefinedGoMember(package_, segments[0], segments[1], span))
+	}
+	// fields and methods
+	for i, name := range segments[2:] {
+		member, _, _ := types.LookupFieldOrMethod(object.Type(), true, package_, name)
+		if member == nil || !member.Exported() {
+			diagnostic := diag.Errorf(nameSpan(span, identifier), "%s undefined, since %s has no field or method %s", strings.Join(segments[:i+3], "."), recv.goTypeName(object.Type()), name)
+			diagnostic.Code = "undefined"
+			panic(diagnostic)
+		}
+		object = member
+	}
+	return object, true
+}
+
+func (recv *checker) undefinedGoMember(package_ *types.Package, qualifier string, name string, span token.Span) diag.Diagnostic {
+	span = nameSpan(span, qualifier+"."+name)
+	diagnostic := diag.Errorf(span, "undefined: %s.%s", qualifier, name)
+	diagnostic.Code = "undefined"
+	if object := package_.Scope().Lookup(name); object != nil {
+		diagnostic.Notes = []string{fmt.Sprintf("%s isn't exported by %s", name, package_.Path())}
+		return diagnostic
+	}
+	best, bestDistance := "", len([]rune(name))/3+1
+	for _, candidate := range package_.Scope().Names() {
+		if !package_.Scope().Lookup(candidate).Exported() {
+			continue
+		}
+		if distance := editDistance(name, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if best != "" {
+		diagnostic.Suggestions = []diag.Suggestion{{
+			Label:       diag.Label{Span: span, Message: fmt.Sprintf("%s declares a name with a similar spelling", package_.Path())},
+			Replacement: qualifier + "." + best,
+		}}
+	}
+	return diagnostic
+}
+
+// the type of a go constant or variable, untyped constants stay untyped
+func (recv *checker) goValueType(object types.Object) string {
+	if basic, isBasic := object.Type().(*types.Basic); isBasic && basic.Info()&types.IsUntyped != 0 {
+		switch {
+		case basic.Info()&(types.IsInteger) != 0:
+			return untypedInt
+		case basic.Info()&(types.IsFloat) != 0:
+			return untypedFloat
+		case basic.Info()&types.IsString != 0:
+			return "string"
+		case basic.Info()&types.IsBoolean != 0:
+			return "bool"
+		}
+		return ""
+	}
+	switch object.(type) {
+	case *types.Const, *types.Var:
+		return recv.goTypeString(object.Type())
+	}
+	return ""
+}
+
+// the type of calling a go function, `(T, error)` and `(T, bool)` are
+// Result[T] and Option[T], the arguments are checked against its signature
+func (recv *checker) goCallType(call ast.ExpressionCall, object types.Object, arguments []string) string {
+	if _, isType := object.(*types.TypeName); isType {
+		// a conversion like `time.Duration(5)`
+		return call.Identifier
+	}
+	signature, isFunction := object.Type().Underlying().(*types.Signature)
+	if !isFunction {
+		return ""
+	}
+	recv.checkGoArguments(call, object, signature, arguments)
+	// the type parameters are only known to go
+	if signature.TypeParams().Len() > 0 || signature.RecvTypeParams().Len() > 0 {
+		return ""
+	}
+	results := signature.Results()
+	switch results.Len() {
+	case 1:
+		return recv.goTypeString(results.At(0).Type())
+	case 2:
+		value := recv.goTypeString(results.At(0).Type())
+		if value == "" {
+			return ""
+		}
+		switch types.TypeString(results.At(1).Type(), nil) {
+		case "error":
+			return "Result[" + value + "]"
+		case "bool":
+			return "Option[" + value + "]"
+		}
+	}
+	return ""
+}
+
+func (recv *checker) checkGoArguments(call ast.ExpressionCall, object types.Object, signature *types.Signature, arguments []string) {
+	parameters := signature.Params()
+	// `f(g())` passes every value g returns
+	if len(call.Arguments) == 1 {
+		if _, isCall := call.Arguments[0].(ast.ExpressionCall); isCall && (arguments[0] == "" || fallibleValue(arguments[0]) != "") {
+			return
+		}
+	}
+	count := parameters.Len()
+	if len(arguments) != count && !(signature.Variadic() && len(arguments) >= count-1) {
+		expected := fmt.Sprint(count)
+		if signature.Variadic() {
+			expected = fmt.Sprintf("at least %d", count-1)
+		}
+		diagnostic := diag.Errorf(call.Span, "%s takes %s arguments but got %d", call.Identifier, expected, len(arguments))
+		diagnostic.Code = "argument-count"
+		diagnostic.Notes = []string{recv.goSignature(object)}
+		panic(diagnostic)
+	}
+	for i, argument := range arguments {
+		var parameter types.Type
+		if signature.Variadic() && i >= count-1 {
+			parameter = parameters.At(count - 1).Type().(*types.Slice).Elem()
+		} else {
+			parameter = parameters.At(i).Type()
+		}
+		if !goAssignable(argument, parameter) {
+			diagnostic := diag.Errorf(valueSpan(call.Arguments[i]), "argument %d of %s must be %s but got %s", i+1, call.Identifier, recv.goTypeName(parameter), defaultType(argument))
+			diagnostic.Code = "type-mismatch"
+			diagnostic.Primary.Message = "this is " + describe(argument)
+			diagnostic.Notes = []string{recv.goSignature(object)}
+			panic(diagnostic)
+		}
+	}
+}
+
+// whether a value of the simplelang type can be passed as the go type,
+// only basic types are compared, the methods of simplelang types aren't
+// known, so they might implement any interface
+func goAssignable(type_ string, parameter types.Type) bool {
+	basic, isBasic := parameter.Underlying().(*types.Basic)
+	switch {
+	case type_ == "" || isTypeParameter(parameter):
+		return true
+	case isUntyped(type_):
+		// constants can be used as any numeric type, like in go
+		return !isBasic || basic.Info()&types.IsNumeric != 0 || isInterface(parameter)
+	case !basicTypes[type_] || isInterface(parameter):
+		return true
+	}
+	return types.Identical(types.Universe.Lookup(type_).Type(), parameter)
+}
+
+func isTypeParameter(type_ types.Type) bool {
+	_, isTypeParameter := type_.(*types.TypeParam)
+	return isTypeParameter
+}
+
+func isInterface(type_ types.Type) bool {
+	_, isInterface := type_.Underlying().(*types.Interface)
+	return isInterface
+}
+
+// qualified names like `fs.fileStat`, whose type can't be written
+var unexportedRegexp = regexp.MustCompile(`\b[A-Za-z_][A-Za-z0-9_]*\.[a-z_]`)
+
+// the type written like in the current file, "" if it can't be written,
+// since it refers to packages, which the file doesn't import, or to
+// unexported types
+func (recv *checker) goTypeString(type_ types.Type) string {
+	isWritable := true
+	str := types.TypeString(type_, func(package_ *types.Package) string {
+		qualifier, isImported := recv.goQualifiers[package_.Path()]
+		if !isImported {
+			isWritable = false
+		}
+		return qualifier
+	})
+	if !isWritable || unexportedRegexp.MatchString(str) {
+		return ""
+	}
+	return str
+}
+
+// the type for messages, qualified by package names
+func (recv *checker) goTypeName(type_ types.Type) string {
+	return types.TypeString(type_, func(package_ *types.Package) string {
+		return package_.Name()
+	})
+}
+
+// the declaration of the function for notes, like
+// `func strings.Repeat(s string, count int) string`
+func (recv *checker) goSignature(object types.Object) string {
+	return types.ObjectString(object, func(package_ *types.Package) string {
+		return package_.Name()
+	})
+}
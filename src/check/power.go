@@ -0,0 +1,130 @@
+package check
+
+import (
+	"fmt"
+	"math/big"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/token"
+)
+
+// go rejects untyped constants, which need more bits
+const maxConstantBits = 512
+
+// the types, whose values are raised by the __pow helper of the builder
+var integerTypes = map[string]bool{
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true, "rune": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"byte": true,
+}
+
+// the value of an integer literal, which may be negated, parenthesized or
+// combined with +, -, * and **, false for other expressions or if the value
+// doesn't fit into a go constant, which the checker reports
+//
+// the builder folds `2 ** 10` to `1024`, since go has no power operator
+func IntegerConstant(expression ast.Expression) (*big.Int, bool) {
+	value, err := integerConstant(expression)
+	return value, value != nil && err == nil
+}
+
+// nil without an error, if the expression isn't an integer constant
+func integerConstant(expression ast.Expression) (*big.Int, error) {
+	switch expression := expression.(type) {
+	case ast.ExpressionLiteral:
+		if literal, isInt := expression.Literal.(ast.IntLiteral); isInt {
+			return big.NewInt(literal.Value), nil
+		}
+	case ast.ExpressionParenthesized:
+		return integerConstant(expression.Expression)
+	case ast.ExpressionUnary:
+		value, err := integerConstant(expression.Expression)
+		if value == nil || err != nil {
+			return nil, err
+		}
+		switch expression.Operator {
+		case token.OperatorVariant_Minus:
+			return value.Neg(value), nil
+		case token.OperatorVariant_Plus:
+			return value, nil
+		}
+	case ast.ExpressionBinary:
+		left, err := integerConstant(expression.Left)
+		if left == nil || err != nil {
+			return nil, err
+		}
+		right, err := integerConstant(expression.Right)
+		if right == nil || err != nil {
+			return nil, err
+		}
+		var result *big.Int
+		switch expression.Operator {
+		case token.OperatorVariant_Plus:
+			result = left.Add(left, right)
+		case token.OperatorVariant_Minus:
+			result = left.Sub(left, right)
+		case token.OperatorVariant_Multiply:
+			result = left.Mul(left, right)
+		case token.OperatorVariant_PowerOf:
+			return power(left, right)
+		default:
+			return nil, nil
+		}
+		if result.BitLen() > maxConstantBits {
+			return nil, fmt.Errorf("the value overflows, since it needs more than %d bits", maxConstantBits)
+		}
+		return result, nil
+	}
+	return nil, nil
+}
+
+func power(base *big.Int, exponent *big.Int) (*big.Int, error) {
+	if exponent.Sign() < 0 {
+		return nil, fmt.Errorf("the exponent %s is negative, integers can't be raised to negative powers", exponent)
+	}
+	// bases other than -1, 0 and 1 need at least one bit per power, so
+	// there is no point in computing huge powers
+	if base.CmpAbs(big.NewInt(1)) > 0 && exponent.Cmp(big.NewInt(maxConstantBits)) > 0 {
+		return nil, fmt.Errorf("%s ** %s overflows, since it needs more than %d bits", base, exponent, maxConstantBits)
+	}
+	result := new(big.Int).Exp(base, exponent, nil)
+	if result.BitLen() > maxConstantBits {
+		return nil, fmt.Errorf("%s ** %s overflows, since it needs more than %d bits", base, exponent, maxConstantBits)
+	}
+	return result, nil
+}
+
+// integers are raised by the __pow helper of the builder, which panics
+// if the result overflows, floats by math.Pow, which returns a float64,
+// so the result is converted back to other float types
+func (recv *checker) powerType(expression ast.ExpressionBinary, left string, right string) string {
+	if _, err := integerConstant(expression); err != nil {
+		diagnostic := diag.Errorf(expression.Span, "%s", err)
+		diagnostic.Code = "power"
+		panic(diagnostic)
+	}
+	type_, _ := unify(left, right)
+	switch {
+	case type_ == untypedInt:
+		if _, isConstant := IntegerConstant(expression); isConstant {
+			return untypedInt
+		}
+		// like `limit ** 2`, which go infers as int
+		return "int"
+	case integerTypes[recv.underlying(type_)] && !recv.isFloat(left) && !recv.isFloat(right):
+		if exponent, isConstant := IntegerConstant(expression.Right); isConstant && exponent.Sign() < 0 {
+			diagnostic := diag.Errorf(expression.Right.Location(), "the exponent %s is negative, integers can't be raised to negative powers", exponent)
+			diagnostic.Code = "power"
+			panic(diagnostic)
+		}
+		return type_
+	case recv.isFloat(type_) && type_ != untypedFloat:
+		return type_
+	}
+	return "float64"
+}
+
+func (recv *checker) isFloat(type_ string) bool {
+	underlying := recv.underlying(type_)
+	return underlying == untypedFloat || underlying == "float32" || underlying == "float64"
+}
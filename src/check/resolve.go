@@ -0,0 +1,514 @@
+package check
+
+import (
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/module"
+	"simplelang/src/token"
+	"sort"
+	"strings"
+)
+
+// a declared name
+type Symbol struct {
+	Name string
+	// fn, enum, interface, type, let, const, using, parameter, binding,
+	// import or builtin
+	Kind string
+	// relative to the module's root, empty for builtins
+	File string
+	token.Span
+	// whether the package level declaration is pub
+	Public bool
+	// whether the symbol is read anywhere, assigning to it doesn't count,
+	// go rejects local variables, which aren't
+	Used bool
+}
+
+// a symbol table, the universe holds the builtins, the package scope the
+// declarations of the file bodies and the file scopes the imports
+type Scope struct {
+	// universe, package, file, function, block, loop or arm
+	Kind     string
+	Parent   *Scope
+	Children []*Scope
+	Symbols  map[string]*Symbol
+}
+
+func newScope(kind string, parent *Scope) *Scope {
+	scope := &Scope{Kind: kind, Parent: parent, Symbols: map[string]*Symbol{}}
+	if parent != nil {
+		parent.Children = append(parent.Children, scope)
+	}
+	return scope
+}
+
+// the symbol the name refers to in this scope
+func (recv *Scope) Lookup(name string) (*Symbol, bool) {
+	for scope := recv; scope != nil; scope = scope.Parent {
+		if symbol, exists := scope.Symbols[name]; exists {
+			return symbol, true
+		}
+	}
+	return nil, false
+}
+
+// a use or declaration of a name
+type Position struct {
+	// relative to the module's root
+	File string
+	token.Span
+}
+
+// the names of a package bound to their declarations
+type Resolution struct {
+	Universe *Scope
+	Package  *Scope
+	// the scopes of the imports by their file
+	Files map[string]*Scope
+	// identifiers, callees, assignment targets and patterns by their
+	// position, for qualified names the first segment is resolved, except
+	// for members of imported simplelang packages
+	Bindings map[Position]*Symbol
+}
+
+// the positions the symbol is used at, ordered by file and position
+func (recv Resolution) Uses(symbol *Symbol) []Position {
+	uses := []Position{}
+	for position, bound := range recv.Bindings {
+		if bound == symbol {
+			uses = append(uses, position)
+		}
+	}
+	sort.Slice(uses, func(i, j int) bool {
+		if uses[i].File != uses[j].File {
+			return uses[i].File < uses[j].File
+		}
+		return uses[i].StartIndex < uses[j].StartIndex
+	})
+	return uses
+}
+
+// the names go declares, in addition to the builtins of simplelang
+var goUniverse = []string{
+	"true", "false", "nil", "iota",
+	"bool", "string", "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16",
+	"uint32", "uint64", "uintptr", "byte", "rune", "float32", "float64", "complex64",
+	"complex128", "any", "error",
+	"cap", "close", "complex", "copy", "delete", "imag", "make", "new", "real", "recover",
+	"min", "max", "clear",
+	// the constructors of Result and Option
+	"Ok", "Err", "Some", "None",
+}
+
+type resolver struct {
+	module_  module.Module
+	package_ module.Package
+	file     string
+	scope    *Scope
+	// the dot imports of the current file, which may declare any name
+	dotImports []*Symbol
+	// the simplelang packages imported by the current file by their qualifier
+	localImports map[string]*module.Package
+	// the package scopes of imported simplelang packages by their path
+	imported   map[string]*Scope
+	resolution Resolution
+}
+
+// binds the names used in the package to their declarations and reports
+// undefined and redeclared names
+func Resolve(module_ module.Module, package_ module.Package, builtins map[string][]string) Resolution {
+	universe := newScope("universe", nil)
+	for _, name := range goUniverse {
+		universe.Symbols[name] = &Symbol{Name: name, Kind: "builtin"}
+	}
+	for name := range builtins {
+		universe.Symbols[name] = &Symbol{Name: name, Kind: "builtin"}
+	}
+	resolver := resolver{
+		module_:  module_,
+		package_: package_,
+		imported: map[string]*Scope{},
+		resolution: Resolution{
+			Universe: universe,
+			Package:  packageScope(package_, universe),
+			Files:    map[string]*Scope{},
+			Bindings: map[Position]*Symbol{},
+		},
+	}
+	for _, file := range package_.Files {
+		module.WithFile(file.Path, func() {
+			resolver.resolveFile(file)
+		})
+	}
+	return resolver.resolution
+}
+
+// the declarations of the file bodies
+func packageScope(package_ module.Package, universe *Scope) *Scope {
+	scope := newScope("package", universe)
+	declare := func(name string, kind string, public bool, file string, span token.Span) {
+		if existing, exists := scope.Symbols[name]; exists {
+			panic(redeclared(name, span, existing))
+		}
+		scope.Symbols[name] = &Symbol{Name: name, Kind: kind, File: file, Span: span, Public: public}
+	}
+	for _, file := range package_.Files {
+		module.WithFile(file.Path, func() {
+			for _, statement := range file.Ast.Statements {
+				switch statement := statement.(type) {
+				case ast.FunctionDeclarationStatement:
+					declare(statement.Identifier, "fn", statement.Public, file.Path, statement.Span)
+				case ast.EnumDeclarationStatement:
+					declare(statement.Identifier, "enum", statement.Public, file.Path, statement.Span)
+				case ast.InterfaceDeclarationStatement:
+					declare(statement.Identifier, "interface", statement.Public, file.Path, statement.Span)
+				case ast.TypeDeclarationStatement:
+					declare(statement.Identifier, "type", statement.Public, file.Path, statement.Span)
+				case ast.ValueDeclaration:
+					declare(statement.Identifier, valueKind(statement), statement.Public, file.Path, statement.Span)
+				case ast.ConstGroupStatement:
+					for _, constant := range statement.Declarations {
+						declare(constant.Identifier, "const", constant.Public, file.Path, constant.Span)
+					}
+				}
+			}
+		})
+	}
+	return scope
+}
+
+func (recv *resolver) resolveFile(file module.File) {
+	recv.file = file.Path
+	recv.dotImports = nil
+	recv.localImports = map[string]*module.Package{}
+	recv.scope = newScope("file", recv.resolution.Package)
+	recv.resolution.Files[file.Path] = recv.scope
+	for _, statement := range file.Ast.Statements {
+		statement, isImport := statement.(ast.ImportStatement)
+		if !isImport {
+			continue
+		}
+		for _, import_ := range statement.Imports {
+			symbol := &Symbol{Name: import_.Name, Kind: "import", File: file.Path, Span: import_.Span}
+			switch import_.Name {
+			case "_":
+				continue
+			case ".":
+				recv.dotImports = append(recv.dotImports, symbol)
+				continue
+			case "":
+				symbol.Name = import_.Path[strings.LastIndex(import_.Path, "/")+1:]
+			}
+			// importing a name twice is reported by the builder
+			if _, exists := recv.scope.Symbols[symbol.Name]; !exists {
+				recv.scope.Symbols[symbol.Name] = symbol
+			}
+			if package_, isLocal := recv.module_.Lookup(import_.Path); isLocal {
+				recv.localImports[symbol.Name] = package_
+			}
+		}
+	}
+	for _, statement := range file.Ast.Statements {
+		switch statement := statement.(type) {
+		case ast.FunctionDeclarationStatement:
+			recv.resolveFunction(statement.Parameters, statement.Statements)
+		case ast.InitStatement:
+			recv.resolveFunction(nil, []ast.Statement{statement.Body})
+		case ast.ValueDeclaration:
+			if statement.Expression != nil {
+				recv.resolveExpression(*statement.Expression)
+			}
+		case ast.ConstGroupStatement:
+			for _, constant := range statement.Declarations {
+				if constant.Expression != nil {
+					recv.resolveExpression(*constant.Expression)
+				}
+			}
+		}
+	}
+}
+
+func (recv *resolver) enterScope(kind string) {
+	recv.scope = newScope(kind, recv.scope)
+}
+
+func (recv *resolver) leaveScope() {
+	recv.scope = recv.scope.Parent
+}
+
+// go doesn't allow declaring a name twice in the same scope, but it may
+// shadow the names of enclosing scopes
+func (recv *resolver) declare(name string, kind string, span token.Span) {
+	if name == "_" {
+		return
+	}
+	if existing, exists := recv.scope.Symbols[name]; exists {
+		panic(redeclared(name, span, existing))
+	}
+	recv.scope.Symbols[name] = &Symbol{Name: name, Kind: kind, File: recv.file, Span: span}
+}
+
+func redeclared(name string, span token.Span, existing *Symbol) diag.Diagnostic {
+	diagnostic := diag.Errorf(span, "%s redeclared in this scope", name)
+	diagnostic.Code = "redeclared"
+	diagnostic.Primary.Message = "declared again here"
+	diagnostic.Secondary = []diag.Label{{File: existing.File, Span: existing.Span, Message: "previously declared here"}}
+	return diagnostic
+}
+
+// the error for a name, which isn't declared, typos of visible names get
+// a suggestion
+func (recv *resolver) undefined(name string, span token.Span) diag.Diagnostic {
+	span = nameSpan(span, name)
+	diagnostic := diag.Errorf(span, "undefined: %s", name)
+	diagnostic.Code = "undefined"
+	if similar, exists := recv.similarName(name); exists {
+		diagnostic.Suggestions = []diag.Suggestion{{
+			Label:       diag.Label{Span: span, Message: "a name with a similar spelling is declared"},
+			Replacement: similar,
+		}}
+	}
+	return diagnostic
+}
+
+// the visible name closest to name, which differs by at most a third of
+// its runes
+func (recv *resolver) similarName(name string) (string, bool) {
+	best, bestDistance := "", len([]rune(name))/3+1
+	for scope := recv.scope; scope != nil; scope = scope.Parent {
+		for candidate := range scope.Symbols {
+			distance := editDistance(name, candidate)
+			if distance < bestDistance || (distance == bestDistance && best != "" && candidate < best) {
+				best, bestDistance = candidate, distance
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// the number of runes, which have to be inserted, deleted, replaced or
+// swapped with their neighbour to turn a into b
+func editDistance(a string, b string) int {
+	runesA, runesB := []rune(a), []rune(b)
+	distances := make([][]int, len(runesA)+1)
+	for i := range distances {
+		distances[i] = make([]int, len(runesB)+1)
+		distances[i][0] = i
+	}
+	for j := range distances[0] {
+		distances[0][j] = j
+	}
+	for i := 1; i <= len(runesA); i++ {
+		for j := 1; j <= len(runesB); j++ {
+			cost := 1
+			if runesA[i-1] == runesB[j-1] {
+				cost = 0
+			}
+			distance := distances[i-1][j-1] + cost
+			if distances[i-1][j]+1 < distance {
+				distance = distances[i-1][j] + 1
+			}
+			if distances[i][j-1]+1 < distance {
+				distance = distances[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && runesA[i-1] == runesB[j-2] && runesA[i-2] == runesB[j-1] && distances[i-2][j-2]+1 < distance {
+				distance = distances[i-2][j-2] + 1
+			}
+			distances[i][j] = distance
+		}
+	}
+	return distances[len(runesA)][len(runesB)]
+}
+
+// binds the name and marks the symbol as used
+func (recv *resolver) use(name string, span token.Span) {
+	recv.bind(name, span).Used = true
+}
+
+// binds the first segment of the name, members of imported simplelang
+// packages are bound to their declaration
+func (recv *resolver) bind(name string, span token.Span) *Symbol {
+	segments := strings.Split(name, ".")
+	symbol, exists := recv.scope.Lookup(segments[0])
+	if !exists {
+		if len(recv.dotImports) == 0 {
+			panic(recv.undefined(segments[0], span))
+		}
+		// without type information the dot import declaring it can't be known
+		symbol = recv.dotImports[0]
+	}
+	if symbol.Kind == "import" && len(segments) > 1 {
+		if member, isMember := recv.importedMember(segments[0], segments[1], span); isMember {
+			symbol = member
+		}
+	}
+	recv.resolution.Bindings[Position{File: recv.file, Span: span}] = symbol
+	return symbol
+}
+
+// the declaration of the member of an imported simplelang package, members,
+// which aren't declared or pub, are reported
+func (recv *resolver) importedMember(qualifier string, name string, span token.Span) (*Symbol, bool) {
+	package_, isLocal := recv.localImports[qualifier]
+	if !isLocal {
+		return nil, false
+	}
+	scope, exists := recv.imported[package_.Path]
+	if !exists {
+		scope = packageScope(*package_, recv.resolution.Universe)
+		recv.imported[package_.Path] = scope
+	}
+	span = nameSpan(span, qualifier+"."+name)
+	symbol, isDeclared := scope.Symbols[name]
+	if !isDeclared {
+		diagnostic := diag.Errorf(span, "undefined: %s.%s", qualifier, name)
+		diagnostic.Code = "undefined"
+		panic(diagnostic)
+	}
+	if !symbol.Public {
+		diagnostic := diag.Errorf(span, "%s.%s can't be used, since %s %s is not pub", qualifier, name, symbol.Kind, name)
+		diagnostic.Code = "not-pub"
+		diagnostic.Secondary = []diag.Label{{File: symbol.File, Span: symbol.Span, Message: "declared here without pub"}}
+		panic(diagnostic)
+	}
+	return symbol, true
+}
+
+func (recv *resolver) resolveFunction(parameters []ast.Parameter, statements []ast.Statement) {
+	// the parameters are in the same scope as the body like in go
+	recv.enterScope("function")
+	for _, parameter := range parameters {
+		recv.declare(parameter.Name, "parameter", parameter.Span)
+	}
+	recv.resolveStatements(statements)
+	recv.leaveScope()
+}
+
+func (recv *resolver) resolveStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		recv.resolveStatement(statement)
+	}
+}
+
+func (recv *resolver) resolveStatement(statement ast.Statement) {
+	switch statement := statement.(type) {
+	case ast.ValueDeclaration:
+		// the value can't refer to the variable being declared
+		if statement.Expression != nil {
+			recv.resolveExpression(*statement.Expression)
+		}
+		kind := valueKind(statement)
+		if statement.Variant == ast.ValueDeclarationVariant_using {
+			kind = "using"
+		}
+		recv.declare(statement.Identifier, kind, statement.Span)
+	case ast.ConstGroupStatement:
+		for _, constant := range statement.Declarations {
+			if constant.Expression != nil {
+				recv.resolveExpression(*constant.Expression)
+			}
+			recv.declare(constant.Identifier, "const", constant.Span)
+		}
+	case ast.Assignment:
+		recv.resolveExpression(statement.Expression)
+		// assigning to a field reads the variable, like in go
+		if strings.Contains(statement.Identifier, ".") {
+			recv.use(statement.Identifier, statement.Span)
+		} else {
+			recv.bind(statement.Identifier, statement.Span)
+		}
+	case ast.ReturnStatement:
+		for _, expression := range statement.Expressions {
+			recv.resolveExpression(expression)
+		}
+	case ast.LoopStatement:
+		recv.enterScope("loop")
+		recv.resolveStatements(statement.Statements)
+		recv.leaveScope()
+	case ast.SpawnStatement:
+		recv.resolveExpression(statement.Expression)
+	case ast.DeferStatement:
+		recv.resolveExpression(statement.Expression)
+	case ast.SendStatement:
+		recv.resolveExpression(statement.Channel)
+		recv.resolveExpression(statement.Value)
+	case ast.SelectStatement:
+		for _, arm := range statement.Arms {
+			recv.enterScope("arm")
+			if arm.Channel != nil {
+				recv.resolveExpression(arm.Channel)
+			}
+			if arm.Value != nil {
+				recv.resolveExpression(arm.Value)
+			}
+			if arm.Binding != "" {
+				recv.declare(arm.Binding, "binding", arm.BindingSpan)
+			}
+			recv.resolveExpression(arm.Expression)
+			recv.leaveScope()
+		}
+	case ast.Expression:
+		recv.resolveExpression(statement)
+	}
+}
+
+func (recv *resolver) resolveExpression(expression ast.Expression) {
+	switch expression := expression.(type) {
+	case ast.ExpressionIdentifier:
+		recv.use(expression.Identifier, expression.Span)
+	case ast.ExpressionLiteral:
+		if literal, isInterpolated := expression.Literal.(ast.InterpolatedStringLiteral); isInterpolated {
+			for _, hole := range literal.Expressions {
+				recv.resolveExpression(hole)
+			}
+		}
+	case ast.ExpressionCall:
+		recv.use(expression.Identifier, expression.Span)
+		for _, argument := range expression.Arguments {
+			recv.resolveExpression(argument)
+		}
+	case ast.ExpressionUnary:
+		recv.resolveExpression(expression.Expression)
+	case ast.ExpressionBinary:
+		recv.resolveExpression(expression.Left)
+		recv.resolveExpression(expression.Right)
+	case ast.ExpressionParenthesized:
+		recv.resolveExpression(expression.Expression)
+	case ast.ExpressionTry:
+		recv.resolveExpression(expression.Expression)
+	case ast.ExpressionTypeAssertion:
+		recv.resolveExpression(expression.Expression)
+	case ast.ExpressionConversion:
+		recv.resolveExpression(expression.Expression)
+	case ast.BlockExpression:
+		recv.enterScope("block")
+		recv.resolveStatements(expression.Statements)
+		if expression.Expression != nil {
+			recv.resolveExpression(*expression.Expression)
+		}
+		recv.leaveScope()
+	case ast.IfExpression:
+		recv.resolveExpression(expression.Condition)
+		recv.resolveExpression(expression.Consequent)
+		if expression.Alternate != nil {
+			recv.resolveExpression(*expression.Alternate)
+		}
+	case ast.MatchExpression:
+		recv.resolveExpression(expression.Subject)
+		for _, arm := range expression.Arms {
+			recv.enterScope("arm")
+			switch pattern := arm.Pattern.(type) {
+			case ast.PatternVariant:
+				recv.use(pattern.Identifier, pattern.Span)
+				for _, binding := range pattern.Bindings {
+					recv.declare(binding, "binding", pattern.Span)
+				}
+			case ast.PatternType:
+				recv.declare(pattern.Binding, "binding", pattern.Span)
+			}
+			recv.resolveExpression(arm.Expression)
+			recv.leaveScope()
+		}
+	}
+}
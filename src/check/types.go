@@ -0,0 +1,110 @@
+package check
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// the types of constants, which take the type of the values they are
+// used with, like in go
+const (
+	untypedInt   = "untyped int"
+	untypedFloat = "untyped float"
+)
+
+// the types go declares, two different ones can't be unified
+var basicTypes = map[string]bool{
+	"bool": true, "string": true, "int": true, "int8": true, "int16": true, "int32": true,
+	"int64": true, "uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"uintptr": true, "byte": true, "rune": true, "float32": true, "float64": true,
+	"complex64": true, "complex128": true,
+}
+
+func isUntyped(type_ string) bool {
+	return type_ == untypedInt || type_ == untypedFloat
+}
+
+// the type variables get, if they are initialized with a constant
+func defaultType(type_ string) string {
+	switch type_ {
+	case untypedInt:
+		return "int"
+	case untypedFloat:
+		return "float64"
+	}
+	return type_
+}
+
+// the type of a value, which is either a or b, like the branches of an
+// if, false if they can't be the same
+func unify(a string, b string) (string, bool) {
+	switch {
+	case a == b:
+		return a, true
+	case isUntyped(a) && isUntyped(b):
+		return untypedFloat, true
+	// an unknown type might be anything, so the type of the constant
+	// can't be chosen
+	case a == "" && isUntyped(b), b == "" && isUntyped(a):
+		return "", true
+	case isUntyped(a) && (b == "string" || b == "bool"), isUntyped(b) && (a == "string" || a == "bool"):
+		return "", false
+	case a == "":
+		return b, true
+	case b == "":
+		return a, true
+	case isUntyped(a):
+		return b, true
+	case isUntyped(b):
+		return a, true
+	case a == "any" || b == "any":
+		return "any", true
+	case basicTypes[a] && basicTypes[b]:
+		return "", false
+	}
+	// declared types might implement each other, which would need the
+	// methods of types, so the type stays unknown
+	return "", true
+}
+
+// the type of the values of a channel, slice or pointer, "" if unknown
+func elementType(type_ string) string {
+	for _, prefix := range []string{"chan ", "<-chan ", "[]", "*"} {
+		if strings.HasPrefix(type_, prefix) {
+			return strings.TrimPrefix(type_, prefix)
+		}
+	}
+	return ""
+}
+
+// the value of `Result[T]` and `Option[T]`, which `?` unwraps
+func fallibleValue(type_ string) string {
+	for _, prefix := range []string{"Result[", "Option["} {
+		if strings.HasPrefix(type_, prefix) && strings.HasSuffix(type_, "]") {
+			return strings.TrimSuffix(strings.TrimPrefix(type_, prefix), "]")
+		}
+	}
+	return ""
+}
+
+var typeIdentifierRegexp = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?`)
+
+// types of an imported package are written relative to it, so its
+// declarations have to be qualified, i.e. `Meters` to `geometry.Meters`
+func (recv *checker) qualify(type_ string, qualifier string) string {
+	return typeIdentifierRegexp.ReplaceAllStringFunc(type_, func(identifier string) string {
+		if declaration, isDeclared := recv.declarations[identifier]; isDeclared && isTypeKind(declaration.Kind) {
+			return qualifier + "." + identifier
+		}
+		return identifier
+	})
+}
+
+func isTypeKind(kind string) bool {
+	return kind == "enum" || kind == "interface" || kind == "type"
+}
+
+func mismatch(what string, a string, b string) string {
+	return fmt.Sprintf("%s have different types %s and %s", what, defaultType(a), defaultType(b))
+}
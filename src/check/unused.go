@@ -0,0 +1,41 @@
+package check
+
+import (
+	"fmt"
+	"simplelang/src/diag"
+	"sort"
+)
+
+// go rejects local variables, which are never read, so they are reported
+// with the position of the declaration, instead of the generated code,
+// the variables of the file body and parameters may be unused
+func (recv *checker) checkUnused(file *Scope) {
+	if file == nil {
+		return
+	}
+	unused := []*Symbol{}
+	var collect func(scope *Scope)
+	collect = func(scope *Scope) {
+		for _, symbol := range scope.Symbols {
+			if (symbol.Kind == "let" || symbol.Kind == "binding") && !symbol.Used {
+				unused = append(unused, symbol)
+			}
+		}
+		for _, child := range scope.Children {
+			collect(child)
+		}
+	}
+	for _, function := range file.Children {
+		collect(function)
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return unused[i].StartIndex < unused[j].StartIndex
+	})
+	for _, symbol := range unused {
+		diagnostic := diag.Errorf(symbol.Span, "%s is declared but never used", symbol.Name)
+		diagnostic.Code = "unused-variable"
+		diagnostic.Primary.File = symbol.File
+		diagnostic.Notes = []string{fmt.Sprintf("go doesn't compile unused variables, assigning to %s doesn't count as a use, `_` can be used for values, which aren't needed", symbol.Name)}
+		recv.report(diagnostic)
+	}
+}
@@ -0,0 +1,179 @@
+// Package diag describes problems in simplelang sources, the errors of the
+// parser, checker, builder and go tools as well as warnings, and renders
+// them for people (Text) and tools (JSON and SARIF).
+//
+// Errors are still reported by panicking, either with a Diagnostic or with
+// a string like "row:col: message", which FromPanic turns into one.
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"simplelang/src/token"
+	"strconv"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (recv Severity) String() string {
+	switch recv {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		panic(fmt.Sprintf("unexpected diag.Severity: %d", int(recv)))
+	}
+}
+
+// a span of a file and what it has to do with the problem
+type Label struct {
+	// empty until module.WithFile fills in the file being processed
+	File string
+	token.Span
+	Message string
+}
+
+// false for problems concerning a whole file or no file at all, like a
+// missing package clause
+func (recv Label) IsPositioned() bool {
+	return recv.Span != token.Span{}
+}
+
+// replacing the text of the span with Replacement fixes the problem,
+// the message of the label describes the fix
+type Suggestion struct {
+	Label
+	Replacement string
+}
+
+type Diagnostic struct {
+	Severity Severity
+	// identifies the kind of problem, like "undefined", empty for
+	// problems without one
+	Code    string
+	Message string
+	// where the problem is, its message is shown under the caret
+	Primary Label
+	// related places, like the previous declaration of a name, which is
+	// declared twice
+	Secondary   []Label
+	Notes       []string
+	Suggestions []Suggestion
+}
+
+func Errorf(span token.Span, format string, a ...any) Diagnostic {
+	return Diagnostic{Severity: Error, Message: fmt.Sprintf(format, a...), Primary: Label{Span: span}}
+}
+
+func Warningf(span token.Span, format string, a ...any) Diagnostic {
+	return Diagnostic{Severity: Warning, Message: fmt.Sprintf(format, a...), Primary: Label{Span: span}}
+}
+
+// `file:row:col: message`, like the errors of the go tools, so a
+// diagnostic can be used as an error
+func (recv Diagnostic) Error() string {
+	str := ""
+	if recv.Primary.File != "" {
+		str += recv.Primary.File + ":"
+	}
+	if recv.Primary.IsPositioned() {
+		str += fmt.Sprintf("%d:%d:", recv.Primary.StartRowIndex+1, recv.Primary.StartColumnIndex+1)
+	}
+	if str != "" {
+		str += " "
+	}
+	if recv.Severity == Warning {
+		str += "warning: "
+	}
+	return str + recv.Message
+}
+
+// calls f on every label, including the ones of suggestions
+func (recv Diagnostic) mapLabels(f func(label Label) Label) Diagnostic {
+	recv.Primary = f(recv.Primary)
+	secondary := []Label{}
+	for _, label := range recv.Secondary {
+		secondary = append(secondary, f(label))
+	}
+	recv.Secondary = secondary
+	suggestions := []Suggestion{}
+	for _, suggestion := range recv.Suggestions {
+		suggestion.Label = f(suggestion.Label)
+		suggestions = append(suggestions, suggestion)
+	}
+	recv.Suggestions = suggestions
+	return recv
+}
+
+// sets the file of the labels, which don't know theirs yet
+func (recv Diagnostic) InFile(path string) Diagnostic {
+	return recv.mapLabels(func(label Label) Label {
+		if label.File == "" {
+			label.File = path
+		}
+		return label
+	})
+}
+
+// makes the files of the labels, which are relative to dir, like the ones
+// of the module, relative to the working directory
+func (recv Diagnostic) InDirectory(dir string) Diagnostic {
+	return recv.mapLabels(func(label Label) Label {
+		if label.File != "" && !filepath.IsAbs(label.File) {
+			label.File = filepath.Join(dir, filepath.FromSlash(label.File))
+		}
+		return label
+	})
+}
+
+// `main.sl: 12:5: message`, the prefixes are optional
+var panicRegexp = regexp.MustCompile(`(?s)^(?:([^\s:]+\.sl): )?(?:(\d+):(\d+): )?(.*)$`)
+
+// the diagnostic a panic of the parser, checker or builder stands for,
+// strings like "main.sl: 12:5: message" are parsed, the span of their
+// label only covers the character at the position
+func FromPanic(value any) Diagnostic {
+	var diagnostic Diagnostic
+	if errors.As(toError(value), &diagnostic) {
+		return diagnostic
+	}
+	match := panicRegexp.FindStringSubmatch(fmt.Sprint(value))
+	diagnostic = Diagnostic{Severity: Error, Message: match[4], Primary: Label{File: match[1]}}
+	if match[2] != "" {
+		row, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[3])
+		diagnostic.Primary.Span = Position(row, column)
+	}
+	return diagnostic
+}
+
+func toError(value any) error {
+	if err, isError := value.(error); isError {
+		return err
+	}
+	return errors.New(fmt.Sprint(value))
+}
+
+// the span of the character at the 1-based row and column
+func Position(row int, column int) token.Span {
+	if row < 1 {
+		row = 1
+	}
+	if column < 1 {
+		column = 1
+	}
+	return token.Span{
+		StartRowIndex:    uint(row - 1),
+		StartColumnIndex: uint(column - 1),
+		EndRowIndex:      uint(row - 1),
+		EndColumnIndex:   uint(column),
+	}
+}
@@ -0,0 +1,75 @@
+package diag
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// positions are 1-based and the end column is the one after the span,
+// like in SARIF, they are left out for labels without a position
+type jsonLabel struct {
+	File      string `json:"file,omitempty"`
+	Line      uint   `json:"line,omitempty"`
+	Column    uint   `json:"column,omitempty"`
+	EndLine   uint   `json:"endLine,omitempty"`
+	EndColumn uint   `json:"endColumn,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+type jsonSuggestion struct {
+	jsonLabel
+	Replacement string `json:"replacement"`
+}
+
+type jsonDiagnostic struct {
+	Severity    string           `json:"severity"`
+	Code        string           `json:"code,omitempty"`
+	Message     string           `json:"message"`
+	Primary     jsonLabel        `json:"primary"`
+	Secondary   []jsonLabel      `json:"secondary,omitempty"`
+	Notes       []string         `json:"notes,omitempty"`
+	Suggestions []jsonSuggestion `json:"suggestions,omitempty"`
+}
+
+func toJSONLabel(label Label) jsonLabel {
+	result := jsonLabel{File: label.File, Message: label.Message}
+	if label.IsPositioned() {
+		result.Line = label.StartRowIndex + 1
+		result.Column = label.StartColumnIndex + 1
+		result.EndLine = label.EndRowIndex + 1
+		result.EndColumn = label.EndColumnIndex + 1
+	}
+	return result
+}
+
+// writes the diagnostics as a JSON array of objects like
+//
+//	{
+//	  "severity": "error",
+//	  "code": "undefined",
+//	  "message": "undefined: nmae",
+//	  "primary": {"file": "in/main.sl", "line": 12, "column": 11, "endLine": 12, "endColumn": 15},
+//	  "suggestions": [{"file": "in/main.sl", ..., "message": "...", "replacement": "name"}]
+//	}
+func JSON(w io.Writer, diagnostics []Diagnostic) error {
+	jsonDiagnostics := []jsonDiagnostic{}
+	for _, diagnostic := range diagnostics {
+		jsonDiagnostic := jsonDiagnostic{
+			Severity: diagnostic.Severity.String(),
+			Code:     diagnostic.Code,
+			Message:  diagnostic.Message,
+			Primary:  toJSONLabel(diagnostic.Primary),
+			Notes:    diagnostic.Notes,
+		}
+		for _, label := range diagnostic.Secondary {
+			jsonDiagnostic.Secondary = append(jsonDiagnostic.Secondary, toJSONLabel(label))
+		}
+		for _, suggestion := range diagnostic.Suggestions {
+			jsonDiagnostic.Suggestions = append(jsonDiagnostic.Suggestions, jsonSuggestion{jsonLabel: toJSONLabel(suggestion.Label), Replacement: suggestion.Replacement})
+		}
+		jsonDiagnostics = append(jsonDiagnostics, jsonDiagnostic)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(jsonDiagnostics)
+}
@@ -0,0 +1,155 @@
+package diag
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// the parts of SARIF 2.1.0, which CI systems use to annotate the sources,
+// see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId,omitempty"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+	Fixes            []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// the end column is the one after the region
+type sarifRegion struct {
+	StartLine   uint `json:"startLine"`
+	StartColumn uint `json:"startColumn"`
+	EndLine     uint `json:"endLine"`
+	EndColumn   uint `json:"endColumn"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion   `json:"deletedRegion"`
+	InsertedContent *sarifMessage `json:"insertedContent,omitempty"`
+}
+
+func toSarifLocation(label Label) sarifLocation {
+	location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(label.File)}}}
+	if label.IsPositioned() {
+		location.PhysicalLocation.Region = &sarifRegion{
+			StartLine:   label.StartRowIndex + 1,
+			StartColumn: label.StartColumnIndex + 1,
+			EndLine:     label.EndRowIndex + 1,
+			EndColumn:   label.EndColumnIndex + 1,
+		}
+	}
+	if label.Message != "" {
+		location.Message = &sarifMessage{Text: label.Message}
+	}
+	return location
+}
+
+// writes the diagnostics as a SARIF log with a single run, the notes are
+// appended to the message, since SARIF has no place for them
+func SARIF(w io.Writer, diagnostics []Diagnostic) error {
+	run := sarifRun{Tool: sarifTool{Driver: sarifDriver{Name: "simplelang"}}, Results: []sarifResult{}}
+	rules := map[string]bool{}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Code != "" && !rules[diagnostic.Code] {
+			rules[diagnostic.Code] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: diagnostic.Code})
+		}
+		level := "error"
+		if diagnostic.Severity == Warning {
+			level = "warning"
+		}
+		text := strings.Join(append([]string{diagnostic.Message}, diagnostic.Notes...), "\n")
+		result := sarifResult{RuleID: diagnostic.Code, Level: level, Message: sarifMessage{Text: text}}
+		if diagnostic.Primary.File != "" {
+			result.Locations = []sarifLocation{toSarifLocation(diagnostic.Primary)}
+		}
+		for i, label := range diagnostic.Secondary {
+			location := toSarifLocation(label)
+			id := i
+			location.ID = &id
+			result.RelatedLocations = append(result.RelatedLocations, location)
+		}
+		for _, suggestion := range diagnostic.Suggestions {
+			location := toSarifLocation(suggestion.Label)
+			if location.PhysicalLocation.Region == nil {
+				continue
+			}
+			replacement := sarifReplacement{DeletedRegion: *location.PhysicalLocation.Region}
+			if suggestion.Replacement != "" {
+				replacement.InsertedContent = &sarifMessage{Text: suggestion.Replacement}
+			}
+			result.Fixes = append(result.Fixes, sarifFix{
+				Description: sarifMessage{Text: suggestion.Message},
+				ArtifactChanges: []sarifArtifactChange{{
+					ArtifactLocation: location.PhysicalLocation.ArtifactLocation,
+					Replacements:     []sarifReplacement{replacement},
+				}},
+			})
+		}
+		run.Results = append(run.Results, result)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
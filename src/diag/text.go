@@ -0,0 +1,172 @@
+package diag
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ANSI escape codes
+const (
+	reset  = "\x1b[0m"
+	bold   = "\x1b[1m"
+	red    = "\x1b[1;31m"
+	yellow = "\x1b[1;33m"
+	blue   = "\x1b[1;34m"
+	cyan   = "\x1b[1;36m"
+)
+
+// whether colors can be used for the output, which is only the case for
+// terminals, unless NO_COLOR is set
+func IsTerminal(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// writes the diagnostics like
+//
+//	error[undefined]: undefined: nmae
+//	  --> in/main.sl:12:11
+//	   |
+//	12 |     print(nmae)
+//	   |           ^^^^
+//	   = help: a name with a similar spelling is declared: `name`
+//
+// the sources are read from the files of the labels, which are only
+// shown as a position if they can't be read
+func Text(w io.Writer, diagnostics []Diagnostic, color bool) {
+	renderer := textRenderer{w: w, color: color, sources: map[string][]string{}}
+	for _, diagnostic := range diagnostics {
+		renderer.render(diagnostic)
+	}
+}
+
+type textRenderer struct {
+	w     io.Writer
+	color bool
+	// the lines of the files read so far, nil if a file can't be read
+	sources map[string][]string
+}
+
+func (recv *textRenderer) paint(style string, text string) string {
+	if !recv.color {
+		return text
+	}
+	return style + text + reset
+}
+
+func (recv *textRenderer) lines(file string) []string {
+	if lines, isRead := recv.sources[file]; isRead {
+		return lines
+	}
+	content, err := os.ReadFile(file)
+	var lines []string
+	if err == nil {
+		lines = strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	}
+	recv.sources[file] = lines
+	return lines
+}
+
+func (recv *textRenderer) render(diagnostic Diagnostic) {
+	severityStyle := red
+	if diagnostic.Severity == Warning {
+		severityStyle = yellow
+	}
+	header := diagnostic.Severity.String()
+	if diagnostic.Code != "" {
+		header += "[" + diagnostic.Code + "]"
+	}
+	fmt.Fprintf(recv.w, "%s%s\n", recv.paint(severityStyle, header), recv.paint(bold, ": "+diagnostic.Message))
+
+	// the row numbers of all labels share the width of the gutter
+	gutterWidth := 1
+	for _, label := range append([]Label{diagnostic.Primary}, diagnostic.Secondary...) {
+		if width := len(strconv.Itoa(int(label.StartRowIndex) + 1)); width > gutterWidth {
+			gutterWidth = width
+		}
+	}
+	gutter := strings.Repeat(" ", gutterWidth)
+
+	recv.renderLabel(diagnostic.Primary, "-->", "^", severityStyle, gutter)
+	for _, label := range diagnostic.Secondary {
+		recv.renderLabel(label, ":::", "-", blue, gutter)
+	}
+	for _, note := range diagnostic.Notes {
+		fmt.Fprintf(recv.w, "%s %s %s\n", gutter, recv.paint(blue, "="), recv.paint(bold, "note:")+" "+indentContinuation(note, gutter))
+	}
+	for _, suggestion := range diagnostic.Suggestions {
+		help := suggestion.Message
+		if suggestion.Replacement != "" {
+			help += ": `" + suggestion.Replacement + "`"
+		}
+		fmt.Fprintf(recv.w, "%s %s %s\n", gutter, recv.paint(blue, "="), recv.paint(cyan, "help:")+" "+help)
+	}
+	fmt.Fprintln(recv.w)
+}
+
+// notes like the details of go's errors span multiple lines
+func indentContinuation(note string, gutter string) string {
+	return strings.ReplaceAll(note, "\n", "\n"+gutter+"   ")
+}
+
+// the position of the label, followed by the line it is on, whose text
+// in the span is underlined with marker
+func (recv *textRenderer) renderLabel(label Label, arrow string, marker string, style string, gutter string) {
+	if label.File == "" && !label.IsPositioned() {
+		return
+	}
+	location := label.File
+	if label.IsPositioned() {
+		if location != "" {
+			location += ":"
+		}
+		location += fmt.Sprintf("%d:%d", label.StartRowIndex+1, label.StartColumnIndex+1)
+	}
+	fmt.Fprintf(recv.w, "%s%s %s\n", gutter, recv.paint(blue, arrow), location)
+
+	lines := recv.lines(label.File)
+	if !label.IsPositioned() || int(label.StartRowIndex) >= len(lines) {
+		if label.Message != "" {
+			fmt.Fprintf(recv.w, "%s %s %s\n", gutter, recv.paint(blue, "="), recv.paint(style, label.Message))
+		}
+		return
+	}
+	line := []rune(lines[label.StartRowIndex])
+	start := int(label.StartColumnIndex)
+	if start > len(line) {
+		start = len(line)
+	}
+	// spans reaching into the next lines are underlined to the end of
+	// their first line
+	end := len(line)
+	if label.EndRowIndex == label.StartRowIndex && int(label.EndColumnIndex) < end {
+		end = int(label.EndColumnIndex)
+	}
+	if end <= start {
+		end = start + 1
+	}
+
+	// tabs are kept, so the underline lines up with the text above it
+	indentation := []rune{}
+	for _, char := range line[:start] {
+		if char == '\t' {
+			indentation = append(indentation, '\t')
+		} else {
+			indentation = append(indentation, ' ')
+		}
+	}
+	underline := strings.Repeat(marker, end-start)
+	if label.Message != "" {
+		underline += " " + label.Message
+	}
+	row := fmt.Sprintf("%*d", len(gutter), label.StartRowIndex+1)
+	fmt.Fprintf(recv.w, "%s %s\n", gutter, recv.paint(blue, "|"))
+	fmt.Fprintf(recv.w, "%s %s %s\n", recv.paint(blue, row), recv.paint(blue, "|"), string(line))
+	fmt.Fprintf(recv.w, "%s %s %s%s\n", gutter, recv.paint(blue, "|"), string(indentation), recv.paint(style, underline))
+}
@@ -0,0 +1,130 @@
+// Package gocheck runs the go tools on the generated code. The line
+// directives of the builder make them report errors at the positions in
+// the simplelang sources, see builder.Options.SourceDir.
+package gocheck
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"simplelang/src/diag"
+	"simplelang/src/module"
+	"strconv"
+	"strings"
+)
+
+// builds and vets the packages in the output directory, vet is only run
+// if the build succeeds, since it would report the same errors again
+//
+// the files of the diagnostics are relative to the working directory, a
+// .sl file if the error is in code with a line directive, the generated
+// .go file otherwise, their columns count bytes of the generated code, so
+// they are only exact, if it matches the source up to the error
+//
+// the returned error is set if a tool failed without reporting errors,
+// like when go isn't installed
+func Run(outputDir string) ([]diag.Diagnostic, error) {
+	binaries, err := os.MkdirTemp("", "simplelang")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(binaries)
+
+	packages, err := findPackages(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	// the executables are written to a temporary directory, so nothing
+	// is left behind in the output directory
+	errors, err := runAll(packages, "build", "-o", binaries+string(filepath.Separator))
+	if len(errors) > 0 || err != nil {
+		return errors, err
+	}
+	// the checker reports unreachable code itself
+	return runAll(packages, "vet", "-unreachable=false")
+}
+
+// packages to run the go tools on, as the directory they run in and the
+// arguments naming the packages
+type packages struct {
+	dir       string
+	arguments []string
+}
+
+// all packages below the output directory, outside of a go module go only
+// builds packages named by their files, so every directory is run on its own
+func findPackages(outputDir string) ([]packages, error) {
+	if module.FindGoImportPath(outputDir) != "" {
+		return []packages{{dir: outputDir, arguments: []string{"./..."}}}, nil
+	}
+	found := []packages{}
+	err := filepath.WalkDir(outputDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		files, err := filepath.Glob(filepath.Join(path, "*.go"))
+		if err != nil || len(files) == 0 {
+			return err
+		}
+		package_ := packages{dir: path}
+		for _, file := range files {
+			package_.arguments = append(package_.arguments, filepath.Base(file))
+		}
+		found = append(found, package_)
+		return nil
+	})
+	return found, err
+}
+
+func runAll(packages []packages, tool string, arguments ...string) ([]diag.Diagnostic, error) {
+	errors := []diag.Diagnostic{}
+	for _, package_ := range packages {
+		packageErrors, err := run(package_.dir, tool, append(arguments, package_.arguments...)...)
+		if err != nil {
+			return nil, err
+		}
+		errors = append(errors, packageErrors...)
+	}
+	return errors, nil
+}
+
+var errorRegexp = regexp.MustCompile(`^(?:vet: )?(.+?):(\d+):(\d+): (.*)$`)
+
+func run(outputDir string, tool string, arguments ...string) ([]diag.Diagnostic, error) {
+	command := exec.Command("go", append([]string{tool}, arguments...)...)
+	command.Dir = outputDir
+	output, runErr := command.CombinedOutput()
+
+	errors := []diag.Diagnostic{}
+	for _, line := range strings.Split(string(output), "\n") {
+		// the details of the previous error, like the have and want
+		// of a call with the wrong arguments
+		if strings.HasPrefix(line, "\t") && len(errors) > 0 {
+			previous := &errors[len(errors)-1]
+			previous.Notes = append(previous.Notes, strings.TrimSpace(line))
+			continue
+		}
+		match := errorRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		row, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[3])
+		// go prints the file names relative to the directory it ran in
+		file := match[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(outputDir, file)
+		}
+		diagnostic := diag.Errorf(diag.Position(row, column), "%s", match[4])
+		diagnostic.Code = "go-" + tool
+		diagnostic.Primary.File = file
+		errors = append(errors, diagnostic)
+	}
+	if runErr != nil && len(errors) == 0 {
+		return nil, fmt.Errorf("go %s failed: %w\n%s", tool, runErr, bytes.TrimSpace(output))
+	}
+	return errors, nil
+}
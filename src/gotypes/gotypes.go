@@ -0,0 +1,113 @@
+// Package gotypes loads the exported declarations of the go packages the
+// simplelang files import, so the checker can validate how they are used.
+//
+// The declarations are read from the export data the go compiler writes to
+// the build cache, which `go list -export` produces for the packages of the
+// standard library and the module cache. Nothing is downloaded, packages,
+// which aren't available offline, stay unknown.
+package gotypes
+
+import (
+	"bufio"
+	"bytes"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type Loader struct {
+	// the directory go list runs in, which decides the go module and
+	// with it the versions of the packages
+	dir string
+	// the export data files by the path of their package
+	exports  map[string]string
+	importer types.Importer
+	// nil for packages, which couldn't be loaded
+	packages map[string]*types.Package
+}
+
+// a loader for the packages available to the go module of dir, which
+// doesn't have to exist yet, like the output directory before the first
+// build
+func NewLoader(dir string) *Loader {
+	dir, err := filepath.Abs(dir)
+	if err == nil {
+		for {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	loader := &Loader{dir: dir, exports: map[string]string{}, packages: map[string]*types.Package{}}
+	// the importer caches the packages, so the types of packages, which
+	// import each other, are identical
+	loader.importer = importer.ForCompiler(token.NewFileSet(), "gc", func(path string) (io.ReadCloser, error) {
+		export, isListed := loader.exports[path]
+		if !isListed {
+			return nil, os.ErrNotExist
+		}
+		return os.Open(export)
+	})
+	return loader
+}
+
+// loads the packages, which haven't been loaded yet, with a single run of
+// go list, packages, which can't be loaded, are remembered as unknown
+func (recv *Loader) Load(paths ...string) {
+	missing := []string{}
+	for _, path := range paths {
+		if _, isLoaded := recv.packages[path]; !isLoaded && path != "C" {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	for _, path := range missing {
+		recv.packages[path] = nil
+	}
+	recv.list(missing)
+	for _, path := range missing {
+		if _, isListed := recv.exports[path]; !isListed {
+			continue
+		}
+		if package_, err := recv.importer.Import(path); err == nil {
+			recv.packages[path] = package_
+		}
+	}
+}
+
+// records the export data of the packages and their dependencies, go list
+// compiles them, if the build cache doesn't have them yet
+func (recv *Loader) list(paths []string) {
+	arguments := append([]string{"list", "-e", "-export", "-deps", "-f", "{{.ImportPath}}\t{{.Export}}", "--"}, paths...)
+	command := exec.Command("go", arguments...)
+	command.Dir = recv.dir
+	command.Env = append(os.Environ(), "GOPROXY=off", "GOTOOLCHAIN=local")
+	// packages with errors are listed without export data, the exit
+	// status doesn't matter
+	output, _ := command.Output()
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		path, export, found := strings.Cut(scanner.Text(), "\t")
+		if found && export != "" {
+			recv.exports[path] = export
+		}
+	}
+}
+
+// the package with the path, false if it hasn't been loaded or couldn't be
+func (recv *Loader) Lookup(path string) (*types.Package, bool) {
+	package_ := recv.packages[path]
+	return package_, package_ != nil
+}
@@ -1,24 +1,181 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-	"simplelang/src/ast"
+	"path/filepath"
+	"runtime"
 	"simplelang/src/builder"
-	"simplelang/src/token"
+	"simplelang/src/diag"
+	"simplelang/src/gocheck"
+	"simplelang/src/gotypes"
+	"simplelang/src/module"
 )
 
+// usage: go run src/main.go [flags] [input directory] [output directory]
 func main() {
-	inputFileBytes, err := os.ReadFile("in/main.sl")
+	options := builder.Options{}
+	flag.BoolVar(&options.GoNames, "go-names", false, "translate snake_case names to go's camelCase")
+	listBuiltins := flag.Bool("builtins", false, "list the builtin functions and exit")
+	lineDirectives := flag.Bool("line-directives", true, "emit //line directives, so go reports positions in the .sl files")
+	flag.BoolVar(&options.Optimize, "optimize", true, "fold constants, drop dead branches and evaluate pure functions at compile time")
+	flag.BoolVar(&options.PruneImports, "prune-imports", true, "leave out the imports added for the generated code, which it doesn't use")
+	goTypes := flag.Bool("go-types", true, "check calls of go packages against their declarations, which are read from the build cache")
+	goCheck := flag.Bool("go-check", true, "build and vet the output and report the errors of go against the .sl files")
+	format := flag.String("format", "text", "how problems are reported: text on stderr, json or sarif on stdout")
+	flag.Parse()
+	if *listBuiltins {
+		for _, builtin := range builder.Builtins() {
+			fmt.Println(builtin)
+		}
+		return
+	}
+	if *format != "text" && *format != "json" && *format != "sarif" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected text, json or sarif\n", *format)
+		os.Exit(2)
+	}
+	inputDir, outputDir := "in", "out"
+	if flag.NArg() > 0 {
+		inputDir = flag.Arg(0)
+	}
+	if flag.NArg() > 1 {
+		outputDir = flag.Arg(1)
+	}
+
+	if *lineDirectives {
+		options.SourceDir = sourceDir(inputDir, outputDir)
+	}
+	if *goTypes {
+		options.GoPackages = gotypes.NewLoader(outputDir)
+	}
+
+	// the files of the module's diagnostics are relative to its root
+	diagnostics := []diag.Diagnostic{}
+	diagnostic, failed := catchDiagnostic(func() {
+		module_ := module.Load(inputDir, module.FindGoImportPath(outputDir))
+
+		written := map[string]bool{}
+		for _, package_ := range module_.SortedPackages() {
+			goFiles, packageDiagnostics := builder.BuildPackage(module_, *package_, options)
+			for _, diagnostic := range packageDiagnostics {
+				diagnostics = append(diagnostics, diagnostic.InDirectory(inputDir))
+			}
+			for path, goSourceCode := range goFiles {
+				outputPath := filepath.Join(outputDir, filepath.FromSlash(path))
+				err := os.MkdirAll(filepath.Dir(outputPath), 0755)
+				if err != nil {
+					panic(err)
+				}
+				err = os.WriteFile(outputPath, []byte(goSourceCode), 0644)
+				if err != nil {
+					panic(err)
+				}
+				written[outputPath] = true
+			}
+		}
+		removeStaleFiles(outputDir, written)
+	})
+	if failed {
+		diagnostics = append(diagnostics, diagnostic.InDirectory(inputDir))
+	} else if *goCheck && !hasErrors(diagnostics) {
+		// go would report the errors found so far again
+		goErrors, err := gocheck.Run(outputDir)
+		if err != nil {
+			diagnostics = append(diagnostics, diag.Diagnostic{Severity: diag.Error, Message: err.Error()})
+		}
+		diagnostics = append(diagnostics, goErrors...)
+	}
+
+	if !report(*format, diagnostics) {
+		os.Exit(1)
+	}
+}
+
+// the parser, checker and builder report errors by panicking, which is
+// turned into a diagnostic, runtime errors are bugs of the compiler, so
+// they still crash with a stack trace
+func catchDiagnostic(f func()) (diagnostic diag.Diagnostic, failed bool) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		var runtimeError runtime.Error
+		if err, isError := r.(error); isError && errors.As(err, &runtimeError) {
+			panic(r)
+		}
+		diagnostic, failed = diag.FromPanic(r), true
+	}()
+	f()
+	return diagnostic, false
+}
+
+// writes the diagnostics in the format, false if there are errors
+func report(format string, diagnostics []diag.Diagnostic) bool {
+	var err error
+	switch format {
+	case "text":
+		diag.Text(os.Stderr, diagnostics, diag.IsTerminal(os.Stderr))
+	case "json":
+		err = diag.JSON(os.Stdout, diagnostics)
+	case "sarif":
+		err = diag.SARIF(os.Stdout, diagnostics)
+	}
 	if err != nil {
 		panic(err)
 	}
-	inputFile := string(inputFileBytes)
-	tokens := token.Tokenize(inputFile)
+	return !hasErrors(diagnostics)
+}
+
+func hasErrors(diagnostics []diag.Diagnostic) bool {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == diag.Error {
+			return true
+		}
+	}
+	return false
+}
 
-	ast_ := ast.NewAst(tokens)
+// the input directory relative to the output directory, as the line
+// directives of the generated files refer to it
+func sourceDir(inputDir string, outputDir string) string {
+	absoluteInputDir, err := filepath.Abs(inputDir)
+	if err != nil {
+		panic(err)
+	}
+	absoluteOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		panic(err)
+	}
+	relative, err := filepath.Rel(absoluteOutputDir, absoluteInputDir)
+	if err != nil {
+		return filepath.ToSlash(absoluteInputDir)
+	}
+	return filepath.ToSlash(relative)
+}
 
-	goSourceCode := builder.BuildProgram(ast_)
-	err = os.WriteFile("out/main.go", []byte(goSourceCode), 0644)
+// removes generated files, whose source file doesn't exist anymore,
+// since they would most likely break the build of their package
+func removeStaleFiles(outputDir string, written map[string]bool) {
+	err := filepath.WalkDir(outputDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".go" || written[path] {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(content, []byte(builder.GeneratedHeader)) {
+			return os.Remove(path)
+		}
+		return nil
+	})
 	if err != nil {
 		panic(err)
 	}
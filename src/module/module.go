@@ -0,0 +1,284 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"simplelang/src/ast"
+	"simplelang/src/diag"
+	"simplelang/src/token"
+	"sort"
+	"strings"
+)
+
+// a directory of .sl files, which are compiled together into one go package
+type Package struct {
+	// relative to the root of the module, this is also the path other
+	// packages import the package by, empty for the root directory
+	Path  string
+	Name  string
+	Files []File
+}
+
+type File struct {
+	// relative to the root of the module
+	Path string
+	Ast  ast.Ast
+}
+
+// all packages of a simplelang project
+type Module struct {
+	// the directory containing the sources
+	Root string
+	// the go import path of the output directory, the generated
+	// packages import each other relative to it, empty if it isn't
+	// inside of a go module
+	GoImportPath string
+	Packages     map[string]*Package
+}
+
+// reruns f and adds the file's path to any panic, since parser and
+// builder errors only know about rows and columns, diagnostics get it as
+// the file of their labels, other panics as a prefix of their message
+func WithFile(path string, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case diag.Diagnostic:
+				panic(r.InFile(path))
+			case error:
+				// keeps runtime errors recognizable
+				panic(fmt.Errorf("%s: %w", path, r))
+			}
+			panic(fmt.Sprintf("%s: %v", path, r))
+		}
+	}()
+	f()
+}
+
+// reads and parses every .sl file below root, each directory containing
+// .sl files is a package
+func Load(root string, goImportPath string) Module {
+	module := Module{Root: root, GoImportPath: goImportPath, Packages: map[string]*Package{}}
+	err := filepath.WalkDir(root, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(filePath) != ".sl" {
+			return nil
+		}
+		relativePath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		packagePath := path.Dir(relativePath)
+		if packagePath == "." {
+			packagePath = ""
+		}
+		inputFileBytes, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		file := File{Path: relativePath}
+		WithFile(relativePath, func() {
+			tokens := token.Tokenize(string(inputFileBytes))
+			file.Ast = ast.NewAst(tokens)
+		})
+		package_, exists := module.Packages[packagePath]
+		if !exists {
+			package_ = &Package{Path: packagePath}
+			module.Packages[packagePath] = package_
+		}
+		package_.Files = append(package_.Files, file)
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	if len(module.Packages) == 0 {
+		panic(fmt.Sprintf("no .sl files found in %s", root))
+	}
+	for _, package_ := range module.Packages {
+		package_.Name = packageName(*package_)
+	}
+	module.checkImportCycles()
+	module.checkGoImportPath()
+	return module
+}
+
+func packageName(package_ Package) string {
+	name := ""
+	for _, file := range package_.Files {
+		fileName := ""
+		for _, statement := range file.Ast.Statements {
+			if statement, isPackage := statement.(ast.PackageStatement); isPackage {
+				fileName = statement.Name
+			}
+		}
+		if fileName == "" {
+			panic(fmt.Sprintf("%s: package name has not been supplied", file.Path))
+		}
+		if name != "" && fileName != name {
+			panic(fmt.Sprintf("%s: found package %s, but the other files of the directory are in package %s", file.Path, fileName, name))
+		}
+		name = fileName
+	}
+	return name
+}
+
+// the packages ordered by their path, so the output doesn't depend on map order
+func (recv Module) SortedPackages() []*Package {
+	packages := []*Package{}
+	for _, package_ := range recv.Packages {
+		packages = append(packages, package_)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Path < packages[j].Path
+	})
+	return packages
+}
+
+// returns the simplelang package an import path refers to, simplelang
+// packages take precedence over go packages with the same path
+func (recv Module) Lookup(importPath string) (*Package, bool) {
+	if importPath == "" {
+		return nil, false
+	}
+	package_, exists := recv.Packages[importPath]
+	return package_, exists
+}
+
+// the path the generated go code imports the package by
+func (recv Module) GoPath(package_ Package) string {
+	if package_.Path == "" {
+		return recv.GoImportPath
+	}
+	return recv.GoImportPath + "/" + package_.Path
+}
+
+// the paths of all simplelang packages imported by the package
+func (recv Module) localImports(package_ Package) []string {
+	imports := []string{}
+	for _, file := range package_.Files {
+		for _, statement := range file.Ast.Statements {
+			statement, isImport := statement.(ast.ImportStatement)
+			if !isImport {
+				continue
+			}
+			for _, import_ := range statement.Imports {
+				if _, isLocal := recv.Lookup(import_.Path); isLocal {
+					imports = append(imports, import_.Path)
+				}
+			}
+		}
+	}
+	return imports
+}
+
+// go doesn't allow import cycles, so they are reported with simplelang paths
+func (recv Module) checkImportCycles() {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := map[string]int{}
+	stack := []string{}
+	var visit func(package_ *Package)
+	visit = func(package_ *Package) {
+		switch states[package_.Path] {
+		case visited:
+			return
+		case visiting:
+			start := 0
+			for stack[start] != package_.Path {
+				start++
+			}
+			cycle := ""
+			for _, path := range append(stack[start:], package_.Path) {
+				if cycle != "" {
+					cycle += " -> "
+				}
+				cycle += fmt.Sprintf("%q", path)
+			}
+			panic("import cycle not allowed: " + cycle)
+		}
+		states[package_.Path] = visiting
+		stack = append(stack, package_.Path)
+		for _, importPath := range recv.localImports(*package_) {
+			imported, _ := recv.Lookup(importPath)
+			if imported.Name == "main" {
+				panic(fmt.Sprintf("package %q imports %q, which is a program, not an importable package", package_.Path, importPath))
+			}
+			visit(imported)
+		}
+		stack = stack[:len(stack)-1]
+		states[package_.Path] = visited
+	}
+	for _, package_ := range recv.SortedPackages() {
+		visit(package_)
+	}
+}
+
+// the generated packages can only import each other by the import path of
+// a go module, programs without local imports don't need one
+func (recv Module) checkGoImportPath() {
+	if recv.GoImportPath != "" {
+		return
+	}
+	for _, package_ := range recv.SortedPackages() {
+		for _, file := range package_.Files {
+			for _, statement := range file.Ast.Statements {
+				statement, isImport := statement.(ast.ImportStatement)
+				if !isImport {
+					continue
+				}
+				for _, import_ := range statement.Imports {
+					if _, isLocal := recv.Lookup(import_.Path); isLocal {
+						diagnostic := diag.Errorf(import_.Span, "importing %q needs the output directory to be inside of a go module", import_.Path)
+						diagnostic.Notes = []string{"the generated packages import each other by the import path of the go module, create one with `go mod init`"}
+						panic(diagnostic.InFile(file.Path))
+					}
+				}
+			}
+		}
+	}
+}
+
+// finds the go import path of dir by looking for the go.mod it belongs
+// to, empty if there is none
+func FindGoImportPath(dir string) string {
+	absoluteDir, err := filepath.Abs(dir)
+	if err != nil {
+		panic(err)
+	}
+	for current := absoluteDir; ; current = filepath.Dir(current) {
+		goMod, err := os.ReadFile(filepath.Join(current, "go.mod"))
+		if err == nil {
+			relativePath, err := filepath.Rel(current, absoluteDir)
+			if err != nil {
+				panic(err)
+			}
+			modulePath := goModulePath(string(goMod))
+			if relativePath == "." {
+				return modulePath
+			}
+			return modulePath + "/" + filepath.ToSlash(relativePath)
+		}
+		if filepath.Dir(current) == current {
+			return ""
+		}
+	}
+}
+
+func goModulePath(goMod string) string {
+	for _, line := range strings.Split(goMod, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	panic("go.mod doesn't contain a module directive")
+}
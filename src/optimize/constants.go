@@ -0,0 +1,450 @@
+package optimize
+
+import (
+	"fmt"
+	"go/constant"
+	gotoken "go/token"
+	"math"
+	"math/big"
+	"simplelang/src/ast"
+	"simplelang/src/check"
+	"simplelang/src/token"
+	"strconv"
+	"strings"
+)
+
+// go rejects untyped constants, which need more bits, see check.IntegerConstant
+const maxConstantBits = 512
+
+// panicked by the evaluation, if the value isn't known at compile time or
+// would differ at runtime
+type notConstant struct{}
+
+// the value of the expression, false if it isn't known at compile time
+func (recv *optimizer) constantValue(expression ast.Expression) (constant.Value, bool) {
+	var value constant.Value
+	isConstant := recv.try(func() {
+		value = recv.evaluate(newFrame(recv.file), expression)
+	})
+	return value, isConstant
+}
+
+// runs the evaluation, false if it gave up
+func (recv *optimizer) try(evaluate func()) (isConstant bool) {
+	recv.steps, recv.depth = 0, 0
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isNotConstant := r.(notConstant); !isNotConstant {
+				panic(r)
+			}
+			isConstant = false
+		}
+	}()
+	evaluate()
+	return true
+}
+
+// the literal replacing the expression, false if it isn't constant or
+// already a literal
+func (recv *optimizer) fold(expression ast.Expression) (ast.Expression, bool) {
+	switch expression := expression.(type) {
+	case ast.ExpressionLiteral:
+		if _, isInterpolated := expression.Literal.(ast.InterpolatedStringLiteral); !isInterpolated {
+			return nil, false
+		}
+	case ast.ExpressionUnary:
+		// like `-5`
+		if _, isLiteral := expression.Expression.(ast.ExpressionLiteral); isLiteral {
+			return nil, false
+		}
+	case ast.ExpressionBinary, ast.ExpressionParenthesized, ast.ExpressionCall:
+	default:
+		return nil, false
+	}
+	value, isConstant := recv.constantValue(expression)
+	if !isConstant {
+		return nil, false
+	}
+	// go vet reports constant strings containing %, which are printed,
+	// like `fmt.Println("100%d")`, interpolations stay calls of Sprintf,
+	// whose holes are folded
+	if value.Kind() == constant.String && strings.Contains(constant.StringVal(value), "%") {
+		return nil, false
+	}
+	return literal(value, recv.info.TypeOf(recv.file, expression), expression.Location())
+}
+
+// the holes, whose value is constant, are formatted into the string
+func (recv *optimizer) interpolation(literal ast.InterpolatedStringLiteral) ast.InterpolatedStringLiteral {
+	folded := ast.InterpolatedStringLiteral{Value: literal.Value}
+	part := literal.StringParts[0]
+	for i, hole := range literal.Expressions {
+		text := ""
+		isConstant := recv.try(func() {
+			text = recv.format(newFrame(recv.file), hole, literal.Formats[i])
+		})
+		if isConstant {
+			part += quote(text) + literal.StringParts[i+1]
+			continue
+		}
+		folded.StringParts = append(folded.StringParts, part)
+		folded.Expressions = append(folded.Expressions, recv.expression(hole))
+		folded.Formats = append(folded.Formats, literal.Formats[i])
+		part = literal.StringParts[i+1]
+	}
+	folded.StringParts = append(folded.StringParts, part)
+	return folded
+}
+
+// the value of a hole formatted like fmt.Sprintf would at runtime
+func (recv *optimizer) format(frame *frame, hole ast.Expression, format ast.FormatSpecifier) string {
+	// pointers aren't constant
+	if format.Verb == 'p' {
+		panic(notConstant{})
+	}
+	value := recv.evaluate(frame, hole)
+	var argument any
+	switch value.Kind() {
+	case constant.Int:
+		integer, isExact := constant.Int64Val(value)
+		if !isExact {
+			panic(notConstant{})
+		}
+		argument = int(integer)
+	case constant.Float:
+		argument, _ = constant.Float64Val(value)
+	case constant.String:
+		argument = constant.StringVal(value)
+	case constant.Bool:
+		argument = constant.BoolVal(value)
+	default:
+		panic(notConstant{})
+	}
+	return fmt.Sprintf(format.GoVerb(), argument)
+}
+
+// the value of the expression converted to the type the checker inferred
+func (recv *optimizer) evaluate(frame *frame, expression ast.Expression) constant.Value {
+	recv.step()
+	return convert(recv.evaluateUntyped(frame, expression), recv.info.TypeOf(frame.file, expression))
+}
+
+func (recv *optimizer) evaluateUntyped(frame *frame, expression ast.Expression) constant.Value {
+	switch expression := expression.(type) {
+	case ast.ExpressionLiteral:
+		switch literal := expression.Literal.(type) {
+		case ast.IntLiteral:
+			return constant.MakeInt64(literal.Value)
+		case ast.FloatLiteral:
+			// the value go sees in the generated code
+			return constant.MakeFromLiteral(literal.String(), gotoken.FLOAT, 0)
+		case ast.StringLiteral:
+			return constant.MakeString(unquote(literal.Value))
+		case ast.InterpolatedStringLiteral:
+			str := ""
+			for i, part := range literal.StringParts {
+				str += unquote(part)
+				if i < len(literal.Expressions) {
+					str += recv.format(frame, literal.Expressions[i], literal.Formats[i])
+				}
+			}
+			return constant.MakeString(str)
+		}
+	case ast.ExpressionIdentifier:
+		return recv.identifier(frame, expression)
+	case ast.ExpressionParenthesized:
+		return recv.evaluate(frame, expression.Expression)
+	case ast.ExpressionUnary:
+		return recv.unary(frame, expression)
+	case ast.ExpressionBinary:
+		return recv.binary(frame, expression)
+	case ast.ExpressionCall:
+		return recv.call(frame, expression)
+	case ast.ExpressionConversion:
+		return convert(recv.evaluate(frame, expression.Expression), expression.Type)
+	case ast.IfExpression:
+		if value, exit := recv.runIf(frame, expression); exit == exitNormal && value != nil {
+			return value
+		}
+	case ast.BlockExpression:
+		if value, exit := recv.runBlock(frame, expression); exit == exitNormal && value != nil {
+			return value
+		}
+	}
+	panic(notConstant{})
+}
+
+// the value of a local, a const, true or false
+func (recv *optimizer) identifier(frame *frame, identifier ast.ExpressionIdentifier) constant.Value {
+	symbol, isBound := recv.info.Resolution.Bindings[check.Position{File: frame.file, Span: identifier.Span}]
+	if !isBound || strings.Contains(identifier.Identifier, ".") {
+		panic(notConstant{})
+	}
+	declaration := check.Position{File: symbol.File, Span: symbol.Span}
+	if local, isLocal := frame.values[declaration]; isLocal {
+		return local.value
+	}
+	switch symbol.Kind {
+	case "builtin":
+		switch symbol.Name {
+		case "true", "false":
+			return constant.MakeBool(symbol.Name == "true")
+		}
+	case "const":
+		// consts without an expression repeat the one of the previous
+		// const of their group, which might use iota
+		constant_, isDeclared := recv.constants[declaration]
+		if !isDeclared || constant_.Expression == nil || recv.depth > maxDepth {
+			break
+		}
+		// local consts, which go can't compute, are lowered to variables,
+		// which go rejects, if folding their reads leaves them unused
+		isLocal := recv.info.Resolution.Package.Symbols[symbol.Name] != symbol
+		if isLocal && !recv.info.IsConstant(symbol.File, constant_) {
+			break
+		}
+		recv.depth++
+		defer func() { recv.depth-- }()
+		return recv.evaluate(newFrame(symbol.File), *constant_.Expression)
+	}
+	panic(notConstant{})
+}
+
+func (recv *optimizer) unary(frame *frame, expression ast.ExpressionUnary) constant.Value {
+	value := recv.evaluate(frame, expression.Expression)
+	switch {
+	case expression.Operator == token.OperatorVariant_Not && value.Kind() == constant.Bool:
+		return constant.UnaryOp(gotoken.NOT, value, 0)
+	case expression.Operator == token.OperatorVariant_Minus && isNumeric(value):
+		return constant.UnaryOp(gotoken.SUB, value, 0)
+	case expression.Operator == token.OperatorVariant_Plus && isNumeric(value):
+		return value
+	}
+	panic(notConstant{})
+}
+
+var comparisons = map[token.OperatorVariant]gotoken.Token{
+	token.OperatorVariant_Equals:             gotoken.EQL,
+	token.OperatorVariant_NotEquals:          gotoken.NEQ,
+	token.OperatorVariant_LowerThan:          gotoken.LSS,
+	token.OperatorVariant_LowerThanOrEqual:   gotoken.LEQ,
+	token.OperatorVariant_GreaterThan:        gotoken.GTR,
+	token.OperatorVariant_GreaterThanOrEqual: gotoken.GEQ,
+}
+
+var arithmetic = map[token.OperatorVariant]gotoken.Token{
+	token.OperatorVariant_Plus:      gotoken.ADD,
+	token.OperatorVariant_Minus:     gotoken.SUB,
+	token.OperatorVariant_Multiply:  gotoken.MUL,
+	token.OperatorVariant_Divide:    gotoken.QUO,
+	token.OperatorVariant_Modulo:    gotoken.REM,
+	token.OperatorVariant_BinaryAnd: gotoken.AND,
+	token.OperatorVariant_BinaryOr:  gotoken.OR,
+}
+
+func (recv *optimizer) binary(frame *frame, expression ast.ExpressionBinary) constant.Value {
+	switch expression.Operator {
+	case token.OperatorVariant_LogicalAnd, token.OperatorVariant_LogicalOr:
+		// the right side is only evaluated, if it is needed
+		left := recv.evaluate(frame, expression.Left)
+		if left.Kind() != constant.Bool {
+			panic(notConstant{})
+		}
+		if constant.BoolVal(left) == (expression.Operator == token.OperatorVariant_LogicalOr) {
+			return left
+		}
+		return recv.evaluate(frame, expression.Right)
+	case token.OperatorVariant_PowerOf:
+		return recv.power(frame, expression)
+	}
+	left := recv.evaluate(frame, expression.Left)
+	right := recv.evaluate(frame, expression.Right)
+	if operator, isComparison := comparisons[expression.Operator]; isComparison {
+		// untyped operands are converted to the type of the other one
+		leftType := recv.info.TypeOf(frame.file, expression.Left)
+		rightType := recv.info.TypeOf(frame.file, expression.Right)
+		if isUntyped(leftType) {
+			left = convert(left, rightType)
+		} else {
+			right = convert(right, leftType)
+		}
+		if left.Kind() != right.Kind() && !(isNumeric(left) && isNumeric(right)) {
+			panic(notConstant{})
+		}
+		return constant.MakeBool(constant.Compare(left, operator, right))
+	}
+	operator, isArithmetic := arithmetic[expression.Operator]
+	if !isArithmetic {
+		panic(notConstant{})
+	}
+	// like `x * 0.5`, where the constant is converted to float64, before
+	// it is multiplied, rounding it
+	type_ := recv.info.TypeOf(frame.file, expression)
+	left, right = convert(left, type_), convert(right, type_)
+	isInteger := left.Kind() == constant.Int && right.Kind() == constant.Int
+	switch {
+	case left.Kind() == constant.String && right.Kind() == constant.String && operator == gotoken.ADD:
+		return constant.BinaryOp(left, operator, right)
+	case !isNumeric(left) || !isNumeric(right):
+		panic(notConstant{})
+	case (operator == gotoken.REM || operator == gotoken.AND || operator == gotoken.OR) && !isInteger:
+		panic(notConstant{})
+	case (operator == gotoken.QUO || operator == gotoken.REM) && constant.Sign(right) == 0:
+		// panics at runtime
+		panic(notConstant{})
+	case operator == gotoken.QUO && isInteger:
+		// go/constant's way of asking for an integer division
+		operator = gotoken.QUO_ASSIGN
+	}
+	return constant.BinaryOp(left, operator, right)
+}
+
+// integers are raised like by the __pow helper of the builder, floats
+// like by math.Pow, see check.powerType
+func (recv *optimizer) power(frame *frame, expression ast.ExpressionBinary) constant.Value {
+	base := recv.evaluate(frame, expression.Left)
+	exponent := recv.evaluate(frame, expression.Right)
+	switch type_ := recv.info.TypeOf(frame.file, expression); type_ {
+	case "untyped int", "int", "int64":
+		base, exponent = constant.ToInt(base), constant.ToInt(exponent)
+		if base.Kind() != constant.Int || exponent.Kind() != constant.Int || constant.Sign(exponent) < 0 {
+			panic(notConstant{})
+		}
+		baseValue, exponentValue := bigInt(base), bigInt(exponent)
+		// bases other than -1, 0 and 1 need at least one bit per power
+		if baseValue.CmpAbs(big.NewInt(1)) > 0 && exponentValue.Cmp(big.NewInt(maxConstantBits)) > 0 {
+			panic(notConstant{})
+		}
+		return constant.Make(new(big.Int).Exp(baseValue, exponentValue, nil))
+	case "float64":
+		baseValue, _ := constant.Float64Val(constant.ToFloat(base))
+		exponentValue, _ := constant.Float64Val(constant.ToFloat(exponent))
+		return constant.MakeFloat64(math.Pow(baseValue, exponentValue))
+	}
+	panic(notConstant{})
+}
+
+// converts the value to the type like go would, the value of a typed
+// expression has to be representable by it, untyped ones stay exact
+func convert(value constant.Value, type_ string) constant.Value {
+	switch type_ {
+	case "untyped int", "untyped float":
+		if value.Kind() == constant.Int && constant.BitLen(value) > maxConstantBits {
+			panic(notConstant{})
+		}
+		if isNumeric(value) {
+			return value
+		}
+	case "int", "int64":
+		// ints have 64 bits on the platforms go supports well
+		value = constant.ToInt(value)
+		if _, isExact := constant.Int64Val(value); value.Kind() == constant.Int && isExact {
+			return value
+		}
+	case "float64":
+		value = constant.ToFloat(value)
+		if value.Kind() != constant.Float {
+			break
+		}
+		float, _ := constant.Float64Val(value)
+		if !math.IsInf(float, 0) && !math.IsNaN(float) {
+			return constant.MakeFloat64(float)
+		}
+	case "string":
+		if value.Kind() == constant.String {
+			return value
+		}
+	case "bool":
+		if value.Kind() == constant.Bool {
+			return value
+		}
+	}
+	// other types might have methods like String, which aren't evaluated
+	panic(notConstant{})
+}
+
+// the expression go evaluates to the value, false for values, which can't
+// be written as a literal, like booleans, since true and false might be
+// shadowed
+func literal(value constant.Value, type_ string, span token.Span) (ast.Expression, bool) {
+	if type_ == "untyped float" || type_ == "float64" {
+		value = constant.ToFloat(value)
+	}
+	isNegative := isNumeric(value) && constant.Sign(value) < 0
+	if isNegative {
+		value = constant.UnaryOp(gotoken.SUB, value, 0)
+	}
+	var expression ast.Expression
+	switch value.Kind() {
+	case constant.Int:
+		integer, isExact := constant.Int64Val(value)
+		if !isExact {
+			return nil, false
+		}
+		expression = ast.ExpressionLiteral{Literal: ast.IntLiteral{Value: integer}, Span: span}
+	case constant.Float:
+		float, _ := constant.Float64Val(value)
+		literal := ast.FloatLiteral{Value: float}
+		// untyped values might be converted to float32, so they have to be
+		// exact, float64 values are already rounded
+		if math.IsInf(float, 0) || type_ != "float64" && constant.Compare(constant.MakeFromLiteral(literal.String(), gotoken.FLOAT, 0), gotoken.NEQ, value) {
+			return nil, false
+		}
+		expression = ast.ExpressionLiteral{Literal: literal, Span: span}
+	case constant.String:
+		expression = ast.ExpressionLiteral{Literal: ast.StringLiteral{Value: quote(constant.StringVal(value))}, Span: span}
+	default:
+		return nil, false
+	}
+	if isNegative {
+		expression = ast.ExpressionUnary{Operator: token.OperatorVariant_Minus, Expression: expression, Span: span}
+	}
+	switch type_ {
+	case "untyped int", "untyped float", "int", "float64", "string":
+		return expression, true
+	}
+	// the type of the literal would be int
+	return ast.ExpressionConversion{Expression: expression, Type: type_, Span: span}, true
+}
+
+func isUntyped(type_ string) bool {
+	return strings.HasPrefix(type_, "untyped ")
+}
+
+func isNumeric(value constant.Value) bool {
+	return value.Kind() == constant.Int || value.Kind() == constant.Float
+}
+
+func isBool(value constant.Value) bool {
+	return value.Kind() == constant.Bool
+}
+
+func boolValue(value constant.Value) bool {
+	return constant.BoolVal(value)
+}
+
+func bigInt(value constant.Value) *big.Int {
+	switch value := constant.Val(value).(type) {
+	case int64:
+		return big.NewInt(value)
+	case *big.Int:
+		return value
+	}
+	panic(notConstant{})
+}
+
+// the value of string content, which is written into the generated code
+// as it is
+func unquote(content string) string {
+	str, err := strconv.Unquote(`"` + content + `"`)
+	if err != nil {
+		panic(notConstant{})
+	}
+	return str
+}
+
+// the string content go reads as the value
+func quote(value string) string {
+	quoted := strconv.Quote(value)
+	return quoted[1 : len(quoted)-1]
+}
@@ -0,0 +1,189 @@
+package optimize
+
+import (
+	"go/constant"
+	"simplelang/src/ast"
+	"simplelang/src/check"
+	"strings"
+)
+
+// the evaluation of a single expression gives up after this many steps,
+// so loops, which might never end, don't hang the compiler
+const maxSteps = 100_000
+
+// how deep calls and consts may be nested
+const maxDepth = 100
+
+// the variables of a function, which is evaluated at compile time
+type frame struct {
+	// the file declaring the function, the spans of its body refer to it
+	file string
+	// by their declaration, which tells apart variables of the same name
+	values map[check.Position]local
+}
+
+func newFrame(file string) *frame {
+	return &frame{file: file, values: map[check.Position]local{}}
+}
+
+type local struct {
+	value constant.Value
+	type_ string
+}
+
+// how statements are left
+type exit int
+
+const (
+	exitNormal exit = iota
+	exitReturn
+	exitBreak
+)
+
+func (recv *optimizer) step() {
+	recv.steps++
+	if recv.steps > maxSteps {
+		panic(notConstant{})
+	}
+}
+
+// the value a function of the package returns, it is pure, if it only
+// computes its result from its parameters, locals and consts with
+// arithmetic, ifs and loops, and calls other pure functions
+func (recv *optimizer) call(frame *frame, call ast.ExpressionCall) constant.Value {
+	symbol, isBound := recv.info.Resolution.Bindings[check.Position{File: frame.file, Span: call.Span}]
+	if isBound && symbol.Kind == "builtin" && len(call.Arguments) == 1 {
+		// conversions like `float64(n)`, convert rejects other builtins
+		return convert(recv.evaluate(frame, call.Arguments[0]), call.Identifier)
+	}
+	if !isBound || symbol.Kind != "fn" || strings.Contains(call.Identifier, ".") {
+		panic(notConstant{})
+	}
+	function, isDeclared := recv.functions[check.Position{File: symbol.File, Span: symbol.Span}]
+	if !isDeclared || len(function.ReturnTypes) != 1 || len(function.Parameters) != len(call.Arguments) || recv.depth > maxDepth {
+		panic(notConstant{})
+	}
+	callee := newFrame(symbol.File)
+	for i, parameter := range function.Parameters {
+		value := convert(recv.evaluate(frame, call.Arguments[i]), parameter.Type)
+		callee.values[check.Position{File: symbol.File, Span: parameter.Span}] = local{value: value, type_: parameter.Type}
+	}
+	recv.depth++
+	defer func() { recv.depth-- }()
+	value, exit := recv.run(callee, function.Statements)
+	if exit != exitReturn {
+		panic(notConstant{})
+	}
+	return convert(value, function.ReturnTypes[0])
+}
+
+// the value returned by a return statement
+func (recv *optimizer) run(frame *frame, statements []ast.Statement) (constant.Value, exit) {
+	for _, statement := range statements {
+		recv.step()
+		switch statement := statement.(type) {
+		case ast.ValueDeclaration:
+			if statement.Expression == nil || statement.Variant == ast.ValueDeclarationVariant_using {
+				panic(notConstant{})
+			}
+			value := recv.evaluate(frame, *statement.Expression)
+			type_ := recv.info.DeclarationType(frame.file, statement)
+			// consts stay untyped like in go
+			if statement.Variant != ast.ValueDeclarationVariant_const || statement.ExplicitType != nil {
+				value = convert(value, type_)
+			}
+			frame.values[check.Position{File: frame.file, Span: statement.Span}] = local{value: value, type_: type_}
+		case ast.Assignment:
+			symbol, isBound := recv.info.Resolution.Bindings[check.Position{File: frame.file, Span: statement.Span}]
+			if !isBound || strings.Contains(statement.Identifier, ".") {
+				panic(notConstant{})
+			}
+			declaration := check.Position{File: symbol.File, Span: symbol.Span}
+			// package level variables can't be changed at compile time
+			variable, isLocal := frame.values[declaration]
+			if !isLocal {
+				panic(notConstant{})
+			}
+			variable.value = convert(recv.evaluate(frame, statement.Expression), variable.type_)
+			frame.values[declaration] = variable
+		case ast.ReturnStatement:
+			if len(statement.Expressions) != 1 {
+				panic(notConstant{})
+			}
+			return recv.evaluate(frame, statement.Expressions[0]), exitReturn
+		case ast.BreakStatement:
+			return nil, exitBreak
+		case ast.LoopStatement:
+			for {
+				value, exit := recv.run(frame, statement.Statements)
+				if exit == exitReturn {
+					return value, exit
+				}
+				if exit == exitBreak {
+					break
+				}
+			}
+		case ast.IfExpression:
+			if value, exit := recv.runIf(frame, statement); exit != exitNormal {
+				return value, exit
+			}
+		case ast.BlockExpression:
+			if value, exit := recv.runBlock(frame, statement); exit != exitNormal {
+				return value, exit
+			}
+		case ast.ExpressionCall:
+			recv.call(frame, statement)
+		default:
+			panic(notConstant{})
+		}
+	}
+	return nil, exitNormal
+}
+
+// the value of the branch, which is run, nil if it has none
+func (recv *optimizer) runIf(frame *frame, expression ast.IfExpression) (constant.Value, exit) {
+	condition := recv.evaluate(frame, expression.Condition)
+	if !isBool(condition) {
+		panic(notConstant{})
+	}
+	if boolValue(condition) {
+		return recv.runBlock(frame, expression.Consequent)
+	}
+	switch alternate := optionalExpression(expression.Alternate).(type) {
+	case nil:
+		return nil, exitNormal
+	case ast.IfExpression:
+		return recv.runIf(frame, alternate)
+	case ast.BlockExpression:
+		return recv.runBlock(frame, alternate)
+	}
+	panic(notConstant{})
+}
+
+// the value of the block, nil if it has none
+func (recv *optimizer) runBlock(frame *frame, block ast.BlockExpression) (constant.Value, exit) {
+	value, exit := recv.run(frame, block.Statements)
+	if exit != exitNormal || block.Expression == nil {
+		return value, exit
+	}
+	switch expression := (*block.Expression).(type) {
+	case ast.IfExpression:
+		return recv.runIf(frame, expression)
+	case ast.BlockExpression:
+		return recv.runBlock(frame, expression)
+	case ast.ExpressionCall:
+		// the value is unknown, if the block is run as a statement
+		if recv.info.TypeOf(frame.file, expression) == "" {
+			recv.call(frame, expression)
+			return nil, exitNormal
+		}
+	}
+	return recv.evaluate(frame, *block.Expression), exitNormal
+}
+
+func optionalExpression(expression *ast.Expression) ast.Expression {
+	if expression == nil {
+		return nil
+	}
+	return *expression
+}
@@ -0,0 +1,391 @@
+// Package optimize rewrites the syntax trees of a checked package, before
+// they are built: constant arithmetic, concatenations and interpolations
+// of constants are folded, the dead branches of ifs with a constant
+// condition are dropped and calls of pure functions with constant
+// arguments are evaluated at compile time, like a `const fn` of rust.
+//
+// The expressions replacing others keep their span, so the types the
+// checker inferred for them stay valid. Values, which would differ at
+// runtime, aren't folded, like integers overflowing, which go silently
+// wraps around, or a division by zero, which panics.
+package optimize
+
+import (
+	"simplelang/src/ast"
+	"simplelang/src/check"
+	"simplelang/src/module"
+	"strings"
+)
+
+type optimizer struct {
+	info check.Info
+	// the file being rewritten, relative to the module's root
+	file string
+	// the consts and functions of the package by their declaration
+	constants map[check.Position]ast.ValueDeclaration
+	functions map[check.Position]ast.FunctionDeclarationStatement
+	// the positions reading the symbols, assigning to them doesn't count
+	reads map[*check.Symbol][]check.Position
+	// the evaluation of the current expression, see constantValue
+	steps int
+	depth int
+}
+
+// the package with the rewritten files, info is the result of checking it
+func Package(package_ module.Package, info check.Info) module.Package {
+	recv := optimizer{
+		info:      info,
+		constants: map[check.Position]ast.ValueDeclaration{},
+		functions: map[check.Position]ast.FunctionDeclarationStatement{},
+		reads:     map[*check.Symbol][]check.Position{},
+	}
+	assignments := map[check.Position]bool{}
+	for _, file := range package_.Files {
+		for _, statement := range file.Ast.Statements {
+			ast.Inspect(statement, func(statement ast.Statement) bool {
+				switch statement := statement.(type) {
+				case ast.FunctionDeclarationStatement:
+					recv.functions[check.Position{File: file.Path, Span: statement.Span}] = statement
+				case ast.ValueDeclaration:
+					if statement.Variant == ast.ValueDeclarationVariant_const {
+						recv.constants[check.Position{File: file.Path, Span: statement.Span}] = statement
+					}
+				case ast.Assignment:
+					// assigning to a field reads the variable
+					if !strings.Contains(statement.Identifier, ".") {
+						assignments[check.Position{File: file.Path, Span: statement.Span}] = true
+					}
+				}
+				return true
+			})
+		}
+	}
+	for position, symbol := range info.Resolution.Bindings {
+		if !assignments[position] {
+			recv.reads[symbol] = append(recv.reads[symbol], position)
+		}
+	}
+
+	optimized := package_
+	optimized.Files = []module.File{}
+	for _, file := range package_.Files {
+		recv.file = file.Path
+		file.Ast.Statements = recv.statements(file.Ast.Statements)
+		optimized.Files = append(optimized.Files, file)
+	}
+	return optimized
+}
+
+func (recv *optimizer) statements(statements []ast.Statement) []ast.Statement {
+	optimized := []ast.Statement{}
+	for _, statement := range statements {
+		if statement, isKept := recv.statement(statement); isKept {
+			optimized = append(optimized, statement)
+		}
+	}
+	return optimized
+}
+
+// the rewritten statement, false if it is dropped
+func (recv *optimizer) statement(statement ast.Statement) (ast.Statement, bool) {
+	switch statement := statement.(type) {
+	case ast.FunctionDeclarationStatement:
+		statement.Statements = recv.statements(statement.Statements)
+		return statement, true
+	case ast.InitStatement:
+		statement.Body = recv.block(statement.Body, false)
+		return statement, true
+	case ast.ValueDeclaration:
+		if statement.Expression != nil {
+			expression := recv.expression(*statement.Expression)
+			statement.Expression = &expression
+		}
+		return statement, true
+	case ast.ReturnStatement:
+		statement.Expressions = recv.expressions(statement.Expressions)
+		return statement, true
+	case ast.LoopStatement:
+		statement.Statements = recv.statements(statement.Statements)
+		return statement, true
+	case ast.Assignment:
+		statement.Expression = recv.expression(statement.Expression)
+		return statement, true
+	case ast.IfExpression:
+		return recv.ifExpression(statement, false)
+	case ast.BlockExpression, ast.MatchExpression, ast.ExpressionCall:
+		return recv.effect(statement.(ast.Expression)), true
+	case ast.ExpressionTry:
+		statement.Expression = recv.expression(statement.Expression)
+		return statement, true
+	case ast.SpawnStatement:
+		statement.Expression = recv.effect(statement.Expression)
+		return statement, true
+	case ast.DeferStatement:
+		statement.Expression = recv.effect(statement.Expression)
+		return statement, true
+	case ast.SendStatement:
+		statement.Value = recv.expression(statement.Value)
+		return statement, true
+	case ast.SelectStatement:
+		arms := []ast.SelectArm{}
+		for _, arm := range statement.Arms {
+			if arm.Value != nil {
+				arm.Value = recv.expression(arm.Value)
+			}
+			arm.Expression = recv.effect(arm.Expression)
+			arms = append(arms, arm)
+		}
+		statement.Arms = arms
+		return statement, true
+	}
+	// const groups repeat the expressions of previous declarations, which
+	// must stay the way they are written
+	return statement, true
+}
+
+// rewrites an expression, whose value isn't used, calls stay calls, since
+// go rejects constants used as statements and they might do something
+func (recv *optimizer) effect(expression ast.Expression) ast.Expression {
+	switch expression := expression.(type) {
+	case ast.ExpressionCall:
+		expression.Arguments = recv.expressions(expression.Arguments)
+		return expression
+	case ast.BlockExpression:
+		return recv.block(expression, false)
+	case ast.IfExpression:
+		if optimized, isKept := recv.ifExpression(expression, false); isKept {
+			return optimized
+		}
+		return ast.BlockExpression{Span: expression.Span}
+	case ast.MatchExpression:
+		return recv.match(expression, false)
+	}
+	return recv.expression(expression)
+}
+
+func (recv *optimizer) expressions(expressions []ast.Expression) []ast.Expression {
+	optimized := []ast.Expression{}
+	for _, expression := range expressions {
+		optimized = append(optimized, recv.expression(expression))
+	}
+	return optimized
+}
+
+func (recv *optimizer) expression(expression ast.Expression) ast.Expression {
+	if folded, isFolded := recv.fold(expression); isFolded {
+		return folded
+	}
+	if recv.isRefused(expression) {
+		return recv.unfolded(expression)
+	}
+	switch expression := expression.(type) {
+	case ast.ExpressionLiteral:
+		if literal, isInterpolated := expression.Literal.(ast.InterpolatedStringLiteral); isInterpolated {
+			expression.Literal = recv.interpolation(literal)
+		}
+		return expression
+	case ast.ExpressionUnary:
+		expression.Expression = recv.expression(expression.Expression)
+		return expression
+	case ast.ExpressionBinary:
+		expression.Left = recv.expression(expression.Left)
+		expression.Right = recv.expression(expression.Right)
+		return expression
+	case ast.ExpressionParenthesized:
+		expression.Expression = recv.expression(expression.Expression)
+		return expression
+	case ast.ExpressionCall:
+		expression.Arguments = recv.expressions(expression.Arguments)
+		return expression
+	case ast.ExpressionTry:
+		expression.Expression = recv.expression(expression.Expression)
+		return expression
+	case ast.ExpressionConversion:
+		expression.Expression = recv.expression(expression.Expression)
+		return expression
+	case ast.ExpressionTypeAssertion:
+		expression.Expression = recv.expression(expression.Expression)
+		return expression
+	case ast.BlockExpression:
+		return recv.block(expression, true)
+	case ast.IfExpression:
+		if optimized, isKept := recv.ifExpression(expression, true); isKept {
+			return optimized
+		}
+		// an if without a value, whose only branch is dead
+		return ast.BlockExpression{Span: expression.Span}
+	case ast.MatchExpression:
+		return recv.match(expression, true)
+	}
+	return expression
+}
+
+// whether the expression wasn't folded, even though its operands are
+// constant, like an overflowing sum, go would evaluate it at compile time
+// and reject it, if its operands were folded
+func (recv *optimizer) isRefused(expression ast.Expression) bool {
+	operands := []ast.Expression{}
+	switch expression := expression.(type) {
+	case ast.ExpressionUnary:
+		operands = append(operands, expression.Expression)
+	case ast.ExpressionBinary:
+		operands = append(operands, expression.Left, expression.Right)
+	case ast.ExpressionConversion:
+		operands = append(operands, expression.Expression)
+	case ast.ExpressionCall:
+		// like `int8(n)`, the arguments of other calls can be folded
+		symbol, isBound := recv.info.Resolution.Bindings[check.Position{File: recv.file, Span: expression.Span}]
+		isConversion := isBound && (symbol.Kind == "type" || symbol.Kind == "builtin" && recv.info.TypeOf(recv.file, expression) == expression.Identifier)
+		if !isConversion {
+			return false
+		}
+		operands = expression.Arguments
+	default:
+		return false
+	}
+	for _, operand := range operands {
+		if _, isConstant := recv.constantValue(operand); !isConstant {
+			return false
+		}
+	}
+	return true
+}
+
+// rewrites the expression without folding it or the operands it is
+// computed from, see isRefused
+func (recv *optimizer) unfolded(expression ast.Expression) ast.Expression {
+	switch expression := expression.(type) {
+	case ast.ExpressionUnary:
+		expression.Expression = recv.unfolded(expression.Expression)
+		return expression
+	case ast.ExpressionBinary:
+		expression.Left = recv.unfolded(expression.Left)
+		expression.Right = recv.unfolded(expression.Right)
+		return expression
+	case ast.ExpressionParenthesized:
+		expression.Expression = recv.unfolded(expression.Expression)
+		return expression
+	case ast.ExpressionConversion:
+		expression.Expression = recv.unfolded(expression.Expression)
+		return expression
+	case ast.ExpressionCall:
+		arguments := []ast.Expression{}
+		for _, argument := range expression.Arguments {
+			arguments = append(arguments, recv.unfolded(argument))
+		}
+		expression.Arguments = arguments
+		return expression
+	}
+	return recv.expression(expression)
+}
+
+// the value of the block is only used, if isValue is set
+func (recv *optimizer) block(block ast.BlockExpression, isValue bool) ast.BlockExpression {
+	block.Statements = recv.statements(block.Statements)
+	if block.Expression == nil {
+		return block
+	}
+	if ifExpression, isIf := (*block.Expression).(ast.IfExpression); isIf {
+		optimized, isKept := recv.ifExpression(ifExpression, isValue)
+		if !isKept {
+			block.Expression = nil
+			return block
+		}
+		block.Expression = &optimized
+		return block
+	}
+	var expression ast.Expression
+	if isValue {
+		expression = recv.expression(*block.Expression)
+	} else {
+		expression = recv.effect(*block.Expression)
+	}
+	block.Expression = &expression
+	return block
+}
+
+func (recv *optimizer) match(expression ast.MatchExpression, isValue bool) ast.MatchExpression {
+	expression.Subject = recv.expression(expression.Subject)
+	arms := []ast.MatchArm{}
+	for _, arm := range expression.Arms {
+		if isValue {
+			arm.Expression = recv.expression(arm.Expression)
+		} else {
+			arm.Expression = recv.effect(arm.Expression)
+		}
+		arms = append(arms, arm)
+	}
+	expression.Arms = arms
+	return expression
+}
+
+// the branch, which is run, if the condition is constant, false if there
+// is none, dropping the other one
+func (recv *optimizer) ifExpression(expression ast.IfExpression, isValue bool) (ast.Expression, bool) {
+	if condition, isConstant := recv.constantValue(expression.Condition); isConstant && isBool(condition) {
+		var live, dead ast.Expression = expression.Consequent, nil
+		if expression.Alternate != nil {
+			dead = *expression.Alternate
+		}
+		if !boolValue(condition) {
+			live, dead = dead, live
+		}
+		if dead == nil || !recv.readsLastUses(dead) {
+			switch live := live.(type) {
+			case ast.IfExpression:
+				return recv.ifExpression(live, isValue)
+			case ast.BlockExpression:
+				return recv.block(live, isValue), true
+			}
+			return nil, false
+		}
+	}
+	expression.Condition = recv.expression(expression.Condition)
+	expression.Consequent = recv.block(expression.Consequent, isValue)
+	if expression.Alternate == nil {
+		return expression, true
+	}
+	switch alternate := (*expression.Alternate).(type) {
+	case ast.IfExpression:
+		optimized, isKept := recv.ifExpression(alternate, isValue)
+		expression.Alternate = nil
+		if isKept {
+			expression.Alternate = &optimized
+		}
+	case ast.BlockExpression:
+		optimized := ast.Expression(recv.block(alternate, isValue))
+		expression.Alternate = &optimized
+	}
+	return expression, true
+}
+
+// whether the code reads a variable or import, which isn't read anywhere
+// else, go would reject it as unused, if the code was dropped
+func (recv *optimizer) readsLastUses(expression ast.Expression) bool {
+	span := expression.Location()
+	isInside := func(position check.Position) bool {
+		return position.File == recv.file && position.StartIndex >= span.StartIndex && position.ExcludedEndIndex <= span.ExcludedEndIndex
+	}
+	for symbol, reads := range recv.reads {
+		switch symbol.Kind {
+		case "let", "using", "binding", "import":
+		default:
+			continue
+		}
+		if isInside(check.Position{File: symbol.File, Span: symbol.Span}) {
+			continue
+		}
+		readInside, readOutside := false, false
+		for _, read := range reads {
+			if isInside(read) {
+				readInside = true
+			} else {
+				readOutside = true
+			}
+		}
+		if readInside && !readOutside {
+			return true
+		}
+	}
+	return false
+}
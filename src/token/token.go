@@ -14,12 +14,73 @@ type Span struct {
 	EndColumnIndex   uint
 }
 
+// Location returns the span itself, this allows nodes embedding
+// a span to expose it through an interface
+func (recv Span) Location() Span {
+	return recv
+}
+
+// Merge returns the span from the start of recv to the end of other
+func (recv Span) Merge(other Span) Span {
+	recv.ExcludedEndIndex = other.ExcludedEndIndex
+	recv.EndRowIndex = other.EndRowIndex
+	recv.EndColumnIndex = other.EndColumnIndex
+	return recv
+}
+
 type Token interface {
 	isToken()
 	GetSpan() *Span
 	String() string
 }
 
+// Describe names the token for error messages, like "identifier x" or
+// "`{`", String dumps its fields for debugging
+func Describe(token Token) string {
+	switch token := token.(type) {
+	case *Identifier:
+		return "identifier " + token.Name
+	case *Keyword:
+		return "keyword " + token.KeywordVariant.String()
+	case *Operator:
+		return "`" + token.OperatorVariant.String() + "`"
+	case *NumericLiteral:
+		return "number " + token.Value
+	case *StringLiteral:
+		return "string literal"
+	case *EqualAssignment:
+		return "`=`"
+	case *Colon:
+		return "`:`"
+	case *Comma:
+		return "`,`"
+	case *Dot:
+		return "`.`"
+	case *FatArrow:
+		return "`=>`"
+	case *QuestionMark:
+		return "`?`"
+	case *Dollar:
+		return "`$`"
+	case *LeftParenthesis:
+		return "`(`"
+	case *RightParenthesis:
+		return "`)`"
+	case *LeftSquareBracket:
+		return "`[`"
+	case *RightSquareBracket:
+		return "`]`"
+	case *LeftCurlyBrace:
+		return "`{`"
+	case *RightCurlyBrace:
+		return "`}`"
+	case *NewLine:
+		return "end of line"
+	default:
+		return token.String()
+	}
+}
+
 type Identifier struct {
 	Span
 	Name string
@@ -46,6 +107,18 @@ const (
 	KeywordVariant_Else
 	KeywordVariant_Loop
 	KeywordVariant_Break
+	KeywordVariant_Enum
+	KeywordVariant_Match
+	KeywordVariant_Interface
+	KeywordVariant_Spawn
+	KeywordVariant_Chan
+	KeywordVariant_Select
+	KeywordVariant_Defer
+	KeywordVariant_Using
+	KeywordVariant_Pub
+	KeywordVariant_Init
+	KeywordVariant_Type
+	KeywordVariant_As
 )
 
 var keywords = []string{
@@ -59,6 +132,18 @@ var keywords = []string{
 	"else",
 	"loop",
 	"break",
+	"enum",
+	"match",
+	"interface",
+	"spawn",
+	"chan",
+	"select",
+	"defer",
+	"using",
+	"pub",
+	"init",
+	"type",
+	"as",
 }
 
 func (recv KeywordVariant) String() string {
@@ -113,18 +198,28 @@ const (
 	OperatorVariant_LowerThanOrEqual
 	OperatorVariant_GreaterThan
 	OperatorVariant_GreaterThanOrEqual
+	// sending to and receiving from channels
+	OperatorVariant_Arrow
 )
 
 func (recv OperatorVariant) HasHigherPrecedenceThan(other OperatorVariant) bool {
 	precedences := map[OperatorVariant]int{
-		OperatorVariant_Plus:        1,
-		OperatorVariant_Minus:       1,
-		OperatorVariant_Multiply:    2,
-		OperatorVariant_Divide:      2,
-		OperatorVariant_Modulo:      2,
-		OperatorVariant_PowerOf:     3,
-		OperatorVariant_LogicalAnd:  -1,
-		OperatorVariant_GreaterThan: 0,
+		OperatorVariant_Plus:               1,
+		OperatorVariant_Minus:              1,
+		OperatorVariant_BinaryOr:           1,
+		OperatorVariant_Multiply:           2,
+		OperatorVariant_Divide:             2,
+		OperatorVariant_Modulo:             2,
+		OperatorVariant_BinaryAnd:          2,
+		OperatorVariant_PowerOf:            3,
+		OperatorVariant_LogicalOr:          -2,
+		OperatorVariant_LogicalAnd:         -1,
+		OperatorVariant_Equals:             0,
+		OperatorVariant_NotEquals:          0,
+		OperatorVariant_LowerThan:          0,
+		OperatorVariant_LowerThanOrEqual:   0,
+		OperatorVariant_GreaterThan:        0,
+		OperatorVariant_GreaterThanOrEqual: 0,
 	}
 	_, recv_ok := precedences[recv]
 	_, other_ok := precedences[other]
@@ -152,6 +247,7 @@ var operators = []string{
 	"<=",
 	">",
 	">=",
+	"<-",
 }
 
 func (recv OperatorVariant) String() string {
@@ -248,6 +344,31 @@ func (recv *Dot) String() string {
 	return fmt.Sprintf("{kind: Dot, span: %+v}", recv.Span)
 }
 
+// FatArrow separates a pattern from its expression in a match arm
+type FatArrow struct {
+	Span
+}
+
+func (w FatArrow) isToken() {}
+func (recv *FatArrow) GetSpan() *Span {
+	return &recv.Span
+}
+func (recv *FatArrow) String() string {
+	return fmt.Sprintf("{kind: FatArrow, span: %+v}", recv.Span)
+}
+
+type QuestionMark struct {
+	Span
+}
+
+func (w QuestionMark) isToken() {}
+func (recv *QuestionMark) GetSpan() *Span {
+	return &recv.Span
+}
+func (recv *QuestionMark) String() string {
+	return fmt.Sprintf("{kind: QuestionMark, span: %+v}", recv.Span)
+}
+
 type Dollar struct {
 	Span
 }
@@ -284,6 +405,30 @@ func (recv *RightParenthesis) String() string {
 	return fmt.Sprintf("{kind: RightParenthesis, span: %+v}", recv.Span)
 }
 
+type LeftSquareBracket struct {
+	Span
+}
+
+func (w LeftSquareBracket) isToken() {}
+func (recv *LeftSquareBracket) GetSpan() *Span {
+	return &recv.Span
+}
+func (recv *LeftSquareBracket) String() string {
+	return fmt.Sprintf("{kind: LeftSquareBracket, span: %+v}", recv.Span)
+}
+
+type RightSquareBracket struct {
+	Span
+}
+
+func (w RightSquareBracket) isToken() {}
+func (recv *RightSquareBracket) GetSpan() *Span {
+	return &recv.Span
+}
+func (recv *RightSquareBracket) String() string {
+	return fmt.Sprintf("{kind: RightSquareBracket, span: %+v}", recv.Span)
+}
+
 type LeftCurlyBrace struct {
 	Span
 }
@@ -334,7 +479,9 @@ func (recv *UnexpectedCharacter) String() string {
 }
 
 type lexer struct {
-	input                string
+	input string
+	// the input is indexed by runes, not by bytes
+	runes                []rune
 	current_index        uint
 	current_char         rune
 	tokens               []Token
@@ -345,6 +492,7 @@ type lexer struct {
 func lexerNew(input string) lexer {
 	return lexer{
 		input:  input,
+		runes:  []rune(input),
 		tokens: []Token{},
 	}
 }
@@ -360,20 +508,34 @@ func (recv *lexer) new_line() {
 }
 
 func (recv *lexer) get_nth_char(i uint) (rune, bool) {
-	runes := []rune(recv.input)
-	if i >= uint(len(runes)) {
+	if i >= uint(len(recv.runes)) {
 		return ' ', false
 	}
-	return []rune(recv.input)[i], true
+	return recv.runes[i], true
+}
+
+// like increment(1), but keeps track of new lines
+func (recv *lexer) advance() {
+	if recv.runes[recv.current_index] == '\n' {
+		recv.current_index += 1
+		recv.new_line()
+		return
+	}
+	recv.increment(1)
 }
 
 func (recv *lexer) lex() {
 	for {
-		if recv.current_index >= uint(len(recv.input)) {
+		if recv.current_index >= uint(len(recv.runes)) {
 			break
 		}
-		current_char := []rune(recv.input)[recv.current_index]
+		current_char := recv.runes[recv.current_index]
 		recv.current_char = current_char
+		start := Span{
+			StartIndex:       recv.current_index,
+			StartRowIndex:    recv.current_row_index,
+			StartColumnIndex: recv.current_column_index,
+		}
 		var token Token
 		switch current_char {
 		case '=':
@@ -386,6 +548,17 @@ func (recv *lexer) lex() {
 			token = recv.lex_simple(&Dot{})
 		case '$':
 			token = recv.lex_simple(&Dollar{})
+			if next_char, ok := recv.get_nth_char(recv.current_index); ok && next_char == '"' {
+				recv.tokens = append(recv.tokens, token)
+				recv.current_char = next_char
+				token = recv.lex_interpolated_string()
+			}
+		case '?':
+			token = recv.lex_simple(&QuestionMark{})
+		case '[':
+			token = recv.lex_simple(&LeftSquareBracket{})
+		case ']':
+			token = recv.lex_simple(&RightSquareBracket{})
 		case '(':
 			token = recv.lex_simple(&LeftParenthesis{})
 		case ')':
@@ -436,6 +609,16 @@ func (recv *lexer) lex() {
 				}
 			}
 		}
+		// tokens consisting of multiple characters, like operators,
+		// don't set their span themselves
+		if span := token.GetSpan(); span.ExcludedEndIndex == 0 {
+			span.StartIndex = start.StartIndex
+			span.StartRowIndex = start.StartRowIndex
+			span.StartColumnIndex = start.StartColumnIndex
+			span.ExcludedEndIndex = recv.current_index
+			span.EndRowIndex = recv.current_row_index
+			span.EndColumnIndex = recv.current_column_index
+		}
 		recv.tokens = append(recv.tokens, token)
 	}
 }
@@ -501,6 +684,10 @@ func (recv *lexer) lex_equals() Token {
 		recv.increment(1)
 		return &Operator{OperatorVariant: OperatorVariant_Equals}
 	}
+	if current_rune == '>' {
+		recv.increment(1)
+		return &FatArrow{}
+	}
 	return &EqualAssignment{}
 }
 
@@ -527,6 +714,11 @@ func (recv *lexer) lex_lower_than() Token {
 		recv.increment(1)
 		return &Operator{OperatorVariant: OperatorVariant_LowerThanOrEqual}
 	}
+	// like in go `a<-1` is a send and not a comparison
+	if current_rune == '-' {
+		recv.increment(1)
+		return &Operator{OperatorVariant: OperatorVariant_Arrow}
+	}
 	return &Operator{OperatorVariant: OperatorVariant_LowerThan}
 }
 
@@ -544,6 +736,18 @@ func (recv *lexer) lex_greater_than() Token {
 }
 
 func (recv *lexer) lex_string() Token {
+	return recv.lex_string_literal(false)
+}
+
+// lexes the string after `$`, which may contain quotes inside of
+// its `{}` holes, like in `$"{format("{}", x)}"`
+//
+// the holes themselves are parsed by the ast
+func (recv *lexer) lex_interpolated_string() Token {
+	return recv.lex_string_literal(true)
+}
+
+func (recv *lexer) lex_string_literal(interpolated bool) Token {
 	string_literal := StringLiteral{}
 
 	span := string_literal.GetSpan()
@@ -563,7 +767,25 @@ func (recv *lexer) lex_string() Token {
 		if !ok {
 			break
 		}
-		recv.increment(1)
+		if interpolated && c == '{' {
+			if next_char, ok := recv.get_nth_char(recv.current_index + 1); ok && next_char == '{' {
+				// escaped
+				str += "{{"
+				recv.increment(2)
+				continue
+			}
+			end, ok := FindInterpolationHoleEnd(recv.runes, int(recv.current_index))
+			if !ok {
+				// reported like the errors of the parser, see diag.FromPanic
+				panic(fmt.Sprintf("%d:%d: unterminated interpolation hole", recv.current_row_index+1, recv.current_column_index+1))
+			}
+			for recv.current_index <= uint(end) {
+				str += string(recv.runes[recv.current_index])
+				recv.advance()
+			}
+			continue
+		}
+		recv.advance()
 		if c == '"' {
 			break
 		}
@@ -673,3 +895,55 @@ func Tokenize(input string) []Token {
 	lexer.lex()
 	return lexer.tokens
 }
+
+// returns the index of the `}` closing the interpolation hole,
+// which starts with the `{` at the given index
+//
+// braces inside of nested strings are skipped
+func FindInterpolationHoleEnd(runes []rune, start int) (int, bool) {
+	depth := 0
+	for i := start; i < len(runes); i++ {
+		switch runes[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i, true
+			}
+		case '"':
+			interpolated := i > 0 && runes[i-1] == '$'
+			end, ok := findStringEnd(runes, i, interpolated)
+			if !ok {
+				return 0, false
+			}
+			i = end
+		}
+	}
+	return 0, false
+}
+
+// returns the index of the quote closing the string,
+// which starts with the quote at the given index
+func findStringEnd(runes []rune, start int, interpolated bool) (int, bool) {
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '"':
+			return i, true
+		case '{':
+			if !interpolated {
+				continue
+			}
+			if i+1 < len(runes) && runes[i+1] == '{' {
+				i++
+				continue
+			}
+			end, ok := FindInterpolationHoleEnd(runes, i)
+			if !ok {
+				return 0, false
+			}
+			i = end
+		}
+	}
+	return 0, false
+}